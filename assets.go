@@ -0,0 +1,9 @@
+package main
+
+import "embed"
+
+// assets holds the UI, blog and docs pages, so the server does not depend
+// on its working directory. The paths.* settings replace them from disk.
+//
+//go:embed static blog docs
+var assets embed.FS
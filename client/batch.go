@@ -0,0 +1,77 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"wave-generator/models"
+)
+
+// File is an image of a batch.
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Batch processes files in one POST /v1/batch request, sent as
+// multipart/form-data. The results come back in the order of files; images
+// that failed carry an Error. The server streams the results as they
+// complete, so a failure halfway through the response returns the results
+// read so far along with the error.
+func (c *Client) Batch(ctx context.Context, files []File, opts *Options) ([]models.BatchResult, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, f := range files {
+		part, err := mw.CreateFormFile("files", f.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := part.Write(f.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	res, err := c.send(ctx, request{
+		method:      http.MethodPost,
+		path:        "/batch",
+		query:       opts.values(),
+		body:        body.Bytes(),
+		contentType: mw.FormDataContentType(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var results []models.BatchResult
+	sc := bufio.NewScanner(res.Body)
+	sc.Buffer(nil, 64<<20)
+	for sc.Scan() {
+		var r models.BatchResult
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			return sortResults(results), fmt.Errorf("decoding batch result: %w", err)
+		}
+		if r.Index < 0 {
+			// the server could not read the rest of the request
+			return sortResults(results), &Error{StatusCode: res.StatusCode, APIError: *r.Error}
+		}
+		results = append(results, r)
+	}
+	if err := sc.Err(); err != nil {
+		return sortResults(results), fmt.Errorf("reading batch results: %w", err)
+	}
+	return sortResults(results), nil
+}
+
+func sortResults(results []models.BatchResult) []models.BatchResult {
+	sort.Slice(results, func(i, j int) bool { return results[i].Index < results[j].Index })
+	return results
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"wave-generator/models"
+)
+
+func TestClient_Batch(t *testing.T) {
+	c := newTestServer(t)
+	wave := testWavePNG(t)
+
+	results, err := c.Batch(context.Background(), []File{
+		{Name: "a.png", Data: wave},
+		{Name: "broken.png", Data: []byte("not an image")},
+		{Name: "c.png", Data: wave},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, r := range results {
+		if r.Index != i {
+			t.Errorf("result %d has index %d, want input order", i, r.Index)
+		}
+	}
+	if results[0].WaveResponse == nil || results[0].SVG == "" || results[2].Filename != "c.png" {
+		t.Errorf("got %+v", results)
+	}
+	if e := results[1].Error; e == nil || e.Code != models.ErrCodeInvalidImage {
+		t.Errorf("got %+v, want an invalid_image error", e)
+	}
+}
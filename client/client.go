@@ -0,0 +1,284 @@
+// Package client calls the wave generator API from Go. Requests answered
+// 429 Too Many Requests or 503 Service Unavailable are retried with
+// exponential backoff, waiting the Retry-After of the response when it has
+// one, and responses are decoded into the models types. An exceeded
+// monthly quota is not retried.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"wave-generator/models"
+)
+
+// Defaults of New.
+const (
+	DefaultMaxRetries = 3
+	DefaultBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// apiVersion prefixes the paths of the API.
+const apiVersion = "/v1"
+
+// Client is a client of the API served at BaseURL. Its fields must not be
+// changed while requests are in flight.
+type Client struct {
+	// BaseURL is the server address without the version prefix, e.g.
+	// "http://localhost:8899".
+	BaseURL string
+	// APIKey is sent in X-API-Key; GenerateAPIKey works without one.
+	APIKey     string
+	HTTPClient *http.Client
+	// MaxRetries bounds the retries of a request answered 429 or 503;
+	// zero disables retrying.
+	MaxRetries int
+	// Backoff is the wait before the first retry, doubled for every
+	// further one up to MaxBackoff. Retry-After takes precedence; a
+	// response asking for a longer wait than MaxBackoff is returned
+	// without retrying. Zero MaxBackoff means no limit.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// UserAgent is sent with every request when set.
+	UserAgent string
+}
+
+// New returns a client of the API at baseURL authenticating with apiKey,
+// with the default retry settings.
+func New(baseURL, apiKey string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimSuffix(baseURL, "/"),
+		APIKey:     apiKey,
+		HTTPClient: http.DefaultClient,
+		MaxRetries: DefaultMaxRetries,
+		Backoff:    DefaultBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+		UserAgent:  "wave-generator-client",
+	}
+}
+
+// Error is an error response of the API. It unwraps to the
+// *models.APIError of the response body.
+type Error struct {
+	StatusCode int
+	// RetryAfter is the wait suggested by the server, if any.
+	RetryAfter time.Duration
+	models.APIError
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("wave API: %d %s", e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("wave API: %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error { return &e.APIError }
+
+// request is an API call. The body is kept in memory so every attempt can
+// send it again.
+type request struct {
+	method      string
+	path        string
+	query       url.Values
+	body        []byte
+	contentType string
+}
+
+// do sends req, retrying 429 and 503 responses, and decodes a successful
+// JSON response into out unless it is nil. Other responses are returned as
+// *Error.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	res, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(res.Body).Decode(out); err != nil {
+		return fmt.Errorf("decoding %s %s response: %w", req.method, req.path, err)
+	}
+	return nil
+}
+
+// send is do returning the successful response, whose body the caller
+// must close.
+func (c *Client) send(ctx context.Context, req request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		res, err := c.attempt(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode < 300 {
+			return res, nil
+		}
+		apiErr := responseError(res)
+		if !retryable(apiErr) || attempt >= c.MaxRetries {
+			return nil, apiErr
+		}
+		wait := apiErr.RetryAfter
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		if c.MaxBackoff > 0 && wait > c.MaxBackoff {
+			// The server asks for a longer wait than the caller allows
+			return nil, apiErr
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%w (last response: %w)", ctx.Err(), apiErr)
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) attempt(ctx context.Context, req request) (*http.Response, error) {
+	u := c.BaseURL + apiVersion + req.path
+	if len(req.query) > 0 {
+		u += "?" + req.query.Encode()
+	}
+	var body io.Reader
+	if req.body != nil {
+		body = bytes.NewReader(req.body)
+	}
+	hr, err := http.NewRequestWithContext(ctx, req.method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if req.contentType != "" {
+		hr.Header.Set("Content-Type", req.contentType)
+	}
+	if c.APIKey != "" {
+		hr.Header.Set("X-API-Key", c.APIKey)
+	}
+	if c.UserAgent != "" {
+		hr.Header.Set("User-Agent", c.UserAgent)
+	}
+	hc := c.HTTPClient
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	return hc.Do(hr)
+}
+
+// backoff is the wait before retry number attempt+1.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.Backoff
+	for i := 0; i < attempt && (c.MaxBackoff <= 0 || d < c.MaxBackoff); i++ {
+		d *= 2
+	}
+	if c.MaxBackoff > 0 && d > c.MaxBackoff {
+		d = c.MaxBackoff
+	}
+	return d
+}
+
+// retryable reports whether e may succeed when sent again: rate limits and
+// full queues clear up, an exhausted monthly quota does not until the next
+// month.
+func retryable(e *Error) bool {
+	switch {
+	case e.Code == models.ErrCodeQuotaExceeded:
+		return false
+	case e.StatusCode == http.StatusTooManyRequests, e.StatusCode == http.StatusServiceUnavailable:
+		return true
+	}
+	return false
+}
+
+// responseError reads the error envelope of res and closes its body.
+// Bodies that are not an API error keep the status text as message.
+func responseError(res *http.Response) *Error {
+	defer res.Body.Close()
+	e := &Error{StatusCode: res.StatusCode, RetryAfter: parseRetryAfter(res.Header.Get("Retry-After"), time.Now())}
+	var body models.ErrorResponse
+	data, _ := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if json.Unmarshal(data, &body) == nil && body.Error.Code != "" {
+		e.APIError = body.Error
+	} else {
+		e.Message = http.StatusText(res.StatusCode)
+	}
+	return e
+}
+
+// parseRetryAfter reads a Retry-After header, in seconds or as an HTTP
+// date; invalid or past values give zero.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if s, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(s)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
+
+// GenerateWave extracts the wave of an image (PNG or JPEG) with
+// POST /v1/generate-wave.
+func (c *Client) GenerateWave(ctx context.Context, image []byte, opts *Options) (*models.WaveResponse, error) {
+	var res models.WaveResponse
+	err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/generate-wave",
+		query:       opts.values(),
+		body:        image,
+		contentType: http.DetectContentType(image),
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// GenerateWavePNG is GenerateWave returning the wave rendered as PNG,
+// drawn over the image with overlay. With opts.Debug it returns the
+// diagnostic image.
+func (c *Client) GenerateWavePNG(ctx context.Context, image []byte, opts *Options, overlay bool) ([]byte, error) {
+	q := opts.values()
+	q.Set("format", "png")
+	if overlay {
+		q.Set("overlay", "true")
+	}
+	res, err := c.send(ctx, request{
+		method:      http.MethodPost,
+		path:        "/generate-wave",
+		query:       q,
+		body:        image,
+		contentType: http.DetectContentType(image),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return io.ReadAll(res.Body)
+}
+
+// GenerateAPIKey issues a self-service API key labeled with owner, which
+// may be empty. The full key is only returned once.
+func (c *Client) GenerateAPIKey(ctx context.Context, owner string) (*models.IssuedAPIKey, error) {
+	req := request{method: http.MethodPost, path: "/generate-apikey"}
+	if owner != "" {
+		req.body, _ = json.Marshal(map[string]string{"owner": owner})
+		req.contentType = "application/json"
+	}
+	var res models.IssuedAPIKey
+	if err := c.do(ctx, req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wave-generator/config"
+	"wave-generator/handlers"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+// newTestServer serves the API routes the client calls and returns a
+// client holding a key issued by it.
+func newTestServer(t *testing.T) *Client {
+	t.Helper()
+	api := handlers.NewAPI(storage.NewMemory(), config.Default())
+	t.Cleanup(api.Close)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/generate-wave", api.WavePatternHandler)
+	mux.HandleFunc("/v1/generate-apikey", api.GenerateAPIKeyHandler)
+	mux.HandleFunc("POST /v1/jobs", api.CreateJobHandler)
+	mux.HandleFunc("GET /v1/jobs/{id}", api.GetJobHandler)
+	mux.HandleFunc("DELETE /v1/jobs/{id}", api.CancelJobHandler)
+	mux.HandleFunc("POST /v1/batch", api.BatchHandler)
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	c := New(srv.URL+"/", "")
+	issued, err := c.GenerateAPIKey(context.Background(), "client-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.APIKey = issued.Key
+	return c
+}
+
+// testWavePNG returns a PNG encoded 33x10 image with a wave-like pattern.
+func testWavePNG(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 33, 10))
+	for x := 0; x < 33; x++ {
+		for y := 0; y < 10; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(((x+y)%10)*25 + 5)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestClient_GenerateWave(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+
+	res, err := c.GenerateWave(ctx, testWavePNG(t), &Options{Stroke: "red", Exports: []string{"js"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.SVG == "" || len(res.Segments) == 0 || res.Exports["js"] == "" {
+		t.Errorf("got %+v", res)
+	}
+
+	img, err := c.GenerateWavePNG(ctx, testWavePNG(t), nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(img)); err != nil {
+		t.Errorf("expected a PNG: %v", err)
+	}
+
+	_, err = c.GenerateWave(ctx, []byte("not an image"), nil)
+	var apiErr *models.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != models.ErrCodeInvalidImage {
+		t.Errorf("got %v, want an invalid_image error", err)
+	}
+
+	c.APIKey = ""
+	if _, err := c.GenerateWave(ctx, testWavePNG(t), nil); err == nil || err.(*Error).StatusCode != http.StatusUnauthorized {
+		t.Errorf("got %v, want 401 without a key", err)
+	}
+}
+
+func TestClient_Retry(t *testing.T) {
+	var attempts int
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		switch attempts {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = io.WriteString(w, `{"svg":"<svg/>"}`)
+		}
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "key")
+	c.Backoff = time.Millisecond
+
+	res, err := c.GenerateWave(context.Background(), []byte("image"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 3 || res.SVG != "<svg/>" {
+		t.Errorf("got %d attempts, response %+v", attempts, res)
+	}
+	for i, b := range bodies {
+		if b != "image" {
+			t.Errorf("attempt %d sent %q, want the image again", i+1, b)
+		}
+	}
+}
+
+func TestClient_RetryExhausted(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = io.WriteString(w, `{"error":{"code":"rate_limited","message":"Rate limit exceeded"}}`)
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "key")
+	c.MaxRetries, c.Backoff = 2, time.Millisecond
+
+	_, err := c.GenerateWave(context.Background(), []byte("image"), nil)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusTooManyRequests || e.Code != models.ErrCodeRateLimited {
+		t.Fatalf("got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("got %d attempts, want 3", attempts)
+	}
+}
+
+func TestClient_RetryAfter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	c := New(srv.URL, "key")
+	c.MaxBackoff = 2 * time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.GetJob(ctx, "abc")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the context error", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.RetryAfter != time.Minute || e.Message != "Service Unavailable" {
+		t.Errorf("got %+v, want the last response", e)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("expected the wait to end with the context")
+	}
+}
+
+func TestClient_NoRetry(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		body       string
+		wantCode   string
+	}{
+		{"quota exceeded", "1", `{"error":{"code":"quota_exceeded","message":"Monthly quota of 10 requests exceeded"}}`, models.ErrCodeQuotaExceeded},
+		{"wait past MaxBackoff", "3600", `{"error":{"code":"rate_limited","message":"Rate limit exceeded"}}`, models.ErrCodeRateLimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				w.Header().Set("Retry-After", tt.retryAfter)
+				w.WriteHeader(http.StatusTooManyRequests)
+				_, _ = io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			c := New(srv.URL, "key")
+
+			start := time.Now()
+			_, err := c.GenerateWave(context.Background(), []byte("image"), nil)
+			var e *Error
+			if !errors.As(err, &e) || e.Code != tt.wantCode {
+				t.Fatalf("got %v, want %s", err, tt.wantCode)
+			}
+			if attempts != 1 || time.Since(start) > 5*time.Second {
+				t.Errorf("got %d attempts in %s, want the error at once", attempts, time.Since(start))
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for v, want := range map[string]time.Duration{
+		"":                              0,
+		"7":                             7 * time.Second,
+		"-1":                            0,
+		"soon":                          0,
+		"Thu, 01 May 2025 12:00:30 GMT": 30 * time.Second,
+		"Thu, 01 May 2025 11:00:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(v, now); got != want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+func TestClient_Backoff(t *testing.T) {
+	c := &Client{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		if got := c.backoff(attempt); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempt, got, want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+	"wave-generator/models"
+)
+
+// DefaultPollInterval is the wait between polls of WaitJob.
+const DefaultPollInterval = time.Second
+
+// CreateJob queues an image for asynchronous processing with
+// POST /v1/jobs. When webhookURL is set the server POSTs the job to it once
+// it finishes.
+func (c *Client) CreateJob(ctx context.Context, image []byte, opts *Options, webhookURL string) (*models.Job, error) {
+	q := opts.values()
+	if webhookURL != "" {
+		q.Set("webhook_url", webhookURL)
+	}
+	var job models.Job
+	err := c.do(ctx, request{
+		method:      http.MethodPost,
+		path:        "/jobs",
+		query:       q,
+		body:        image,
+		contentType: http.DetectContentType(image),
+	}, &job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJob returns the status of a job and, once it has succeeded, its
+// result.
+func (c *Client) GetJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	if err := c.do(ctx, request{method: http.MethodGet, path: "/jobs/" + url.PathEscape(id)}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// CancelJob cancels a queued or running job. Canceling a finished job
+// fails with a 409 conflict error.
+func (c *Client) CancelJob(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	if err := c.do(ctx, request{method: http.MethodDelete, path: "/jobs/" + url.PathEscape(id)}, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// WaitJob polls a job every interval (DefaultPollInterval when zero) until
+// it is done or ctx ends. A failed or canceled job is returned without
+// error; its Error tells why it failed.
+func (c *Client) WaitJob(ctx context.Context, id string, interval time.Duration) (*models.Job, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		job, err := c.GetJob(ctx, id)
+		if err != nil || job.Done() {
+			return job, err
+		}
+		select {
+		case <-ctx.Done():
+			return job, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
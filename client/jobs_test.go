@@ -0,0 +1,39 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	"wave-generator/models"
+)
+
+func TestClient_Jobs(t *testing.T) {
+	c := newTestServer(t)
+	ctx := context.Background()
+
+	job, err := c.CreateJob(ctx, testWavePNG(t), &Options{Stroke: "blue"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" {
+		t.Fatalf("got %+v", job)
+	}
+	done, err := c.WaitJob(ctx, job.ID, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != models.JobSucceeded || done.Result == nil || done.Result.SVG == "" {
+		t.Errorf("got %+v", done)
+	}
+
+	_, err = c.CancelJob(ctx, job.ID)
+	var e *Error
+	if !errors.As(err, &e) || e.StatusCode != http.StatusConflict {
+		t.Errorf("got %v, want a conflict canceling a finished job", err)
+	}
+	if _, err := c.GetJob(ctx, "unknown"); !errors.As(err, &e) || e.Code != models.ErrCodeNotFound {
+		t.Errorf("got %v, want not_found", err)
+	}
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Options are the styling and output query parameters of /v1/generate-wave,
+// /v1/jobs and /v1/batch. Zero values keep the server defaults; see
+// docs/api-docs.md for the accepted values.
+type Options struct {
+	SVGMode     string   // svg_mode
+	Stroke      string   // stroke color
+	StrokeWidth float64  // stroke_width
+	LineCap     string   // linecap
+	Fill        string   // fill: "none", "below" or "above"
+	FillColor   string   // fill_color
+	Gradient    []string // gradient colors
+	GradientDir string   // gradient_dir
+	Background  string   // background color
+	Responsive  bool     // responsive
+	AspectRatio string   // aspect
+	Layers      int      // layers
+	LayerOffset float64  // layer_offset
+	// Debug adds fit diagnostics to JSON responses; PNG responses become
+	// the diagnostic image.
+	Debug bool
+	// Exports lists the code exports to include (see
+	// services.ExportLanguages).
+	Exports []string
+}
+
+// values returns the query parameters of o, which may be nil.
+func (o *Options) values() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	set := func(name, v string) {
+		if v != "" {
+			q.Set(name, v)
+		}
+	}
+	float := func(f float64) string {
+		if f == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	set("svg_mode", o.SVGMode)
+	set("stroke", o.Stroke)
+	set("stroke_width", float(o.StrokeWidth))
+	set("linecap", o.LineCap)
+	set("fill", o.Fill)
+	set("fill_color", o.FillColor)
+	set("gradient", strings.Join(o.Gradient, ","))
+	set("gradient_dir", o.GradientDir)
+	set("background", o.Background)
+	if o.Responsive {
+		q.Set("responsive", "true")
+	}
+	set("aspect", o.AspectRatio)
+	if o.Layers != 0 {
+		q.Set("layers", strconv.Itoa(o.Layers))
+	}
+	set("layer_offset", float(o.LayerOffset))
+	if o.Debug {
+		q.Set("debug", "true")
+	}
+	set("export", strings.Join(o.Exports, ","))
+	return q
+}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestOptions_Values(t *testing.T) {
+	if q := (*Options)(nil).values(); len(q) != 0 {
+		t.Errorf("got %v for nil options", q)
+	}
+	opts := &Options{
+		Stroke:      "red",
+		StrokeWidth: 2.5,
+		Fill:        "below",
+		Gradient:    []string{"navy", "rgb(0,128,128)"},
+		Responsive:  true,
+		Layers:      3,
+		Debug:       true,
+		Exports:     []string{"js", "python"},
+	}
+	want := url.Values{
+		"stroke":       {"red"},
+		"stroke_width": {"2.5"},
+		"fill":         {"below"},
+		"gradient":     {"navy,rgb(0,128,128)"},
+		"responsive":   {"true"},
+		"layers":       {"3"},
+		"debug":        {"true"},
+		"export":       {"js,python"},
+	}
+	if got := opts.values(); got.Encode() != want.Encode() {
+		t.Errorf("got %s, want %s", got.Encode(), want.Encode())
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// imageExtensions are the files picked from directories.
+var imageExtensions = []string{".png", ".jpg", ".jpeg"}
+
+// inputFile is an image to process. name is its path relative to the
+// directory argument it was found in, or its base name, and names its
+// output file.
+type inputFile struct {
+	path string
+	name string
+}
+
+// expandInputs turns the arguments into the images to process: files as
+// given, the matches of globs and the images under directories, in order
+// and without duplicates.
+func expandInputs(args []string) ([]inputFile, error) {
+	var files []inputFile
+	seen := make(map[string]bool)
+	add := func(path, name string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, inputFile{path: path, name: name})
+		}
+	}
+	for _, arg := range args {
+		paths := []string{arg}
+		if strings.ContainsAny(arg, "*?[") {
+			matches, err := filepath.Glob(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no matching files", arg)
+			}
+			paths = matches
+		}
+		for _, path := range paths {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(path, filepath.Base(path))
+				continue
+			}
+			found := len(files)
+			err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() || !isImage(p) {
+					return err
+				}
+				rel, err := filepath.Rel(path, p)
+				if err != nil {
+					return err
+				}
+				add(p, rel)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(files) == found {
+				return nil, fmt.Errorf("%s: no PNG or JPEG files", path)
+			}
+		}
+	}
+	return files, nil
+}
+
+func isImage(path string) bool {
+	return slices.Contains(imageExtensions, strings.ToLower(filepath.Ext(path)))
+}
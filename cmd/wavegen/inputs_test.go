@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.png", "b.JPG", "notes.txt", filepath.Join("sub", "c.jpeg")} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := expandInputs([]string{filepath.Join(dir, "a.png"), dir, filepath.Join(dir, "*.png")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []inputFile{
+		{filepath.Join(dir, "a.png"), "a.png"},
+		{filepath.Join(dir, "b.JPG"), "b.JPG"},
+		{filepath.Join(dir, "sub", "c.jpeg"), filepath.Join("sub", "c.jpeg")},
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("got %v, want %v", files, want)
+	}
+
+	for _, args := range [][]string{
+		{filepath.Join(dir, "missing.png")},
+		{filepath.Join(dir, "*.gif")},
+		{filepath.Join(dir, "[")},
+	} {
+		if _, err := expandInputs(args); err == nil {
+			t.Errorf("%v: expected an error", args)
+		}
+	}
+	empty := filepath.Join(dir, "empty")
+	if err := os.Mkdir(empty, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := expandInputs([]string{empty}); err == nil {
+		t.Error("expected an error for a directory without images")
+	}
+}
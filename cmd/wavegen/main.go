@@ -0,0 +1,408 @@
+// Command wavegen runs the wave extraction pipeline on image files without
+// the HTTP server:
+//
+//	wavegen [flags] image|glob|directory...
+//
+// Every argument is an image file, a glob such as "photos/*.jpg" or a
+// directory, whose PNG and JPEG files are processed recursively. Images are
+// processed in parallel (-j). The styling flags are named after the query
+// parameters of /v1/generate-wave.
+//
+// With -o, results are written to that file or, for several images, to
+// files named after the images in that directory. Without it, the result of
+// a single image is written to stdout; several images are only supported
+// with -format json, which writes one JSON line per image in the format of
+// the /v1/batch response.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"wave-generator/models"
+	"wave-generator/services"
+)
+
+// Output formats.
+const (
+	formatJSON = "json"
+	formatSVG  = "svg"
+	formatPNG  = "png"
+	formatCode = "code"
+)
+
+// codeExtensions are the file extensions of the code exports.
+var codeExtensions = map[string]string{
+	services.ExportGo:         ".go",
+	services.ExportJavaScript: ".js",
+	services.ExportTypeScript: ".ts",
+	services.ExportPython:     ".py",
+	services.ExportNumPy:      ".py",
+	services.ExportGLSL:       ".glsl",
+	services.ExportWGSL:       ".wgsl",
+	services.ExportCSS:        ".css",
+	services.ExportLaTeX:      ".tex",
+}
+
+// options are the parsed command line.
+type options struct {
+	format   string
+	lang     string // language of -format code
+	output   string
+	parallel int
+	timeout  time.Duration
+	process  services.Options
+	inputs   []string
+}
+
+// usageError is an invalid command line, reported with exit status 2.
+type usageError struct{ error }
+
+// errDecode wraps the errors of images that cannot be decoded.
+var errDecode = errors.New("decoding image")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run executes the command and returns its exit status: 0 on success, 1
+// when any image failed and 2 for an invalid command line.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, "wavegen:", err)
+		var uerr usageError
+		if errors.As(err, &uerr) {
+			return 2
+		}
+		return 1
+	}
+	files, err := expandInputs(opts.inputs)
+	if err != nil {
+		fmt.Fprintln(stderr, "wavegen:", err)
+		return 1
+	}
+	out, err := newWriter(opts, files, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, "wavegen:", err)
+		return 2
+	}
+
+	failed := 0
+	for res := range processAll(ctx, opts, files) {
+		if err := out.write(res); err != nil {
+			res.err = err
+		}
+		if res.err != nil {
+			failed++
+			fmt.Fprintf(stderr, "wavegen: %s: %v\n", res.file.path, res.err)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		fmt.Fprintln(stderr, "wavegen: interrupted:", err)
+		return 1
+	}
+	if failed > 0 {
+		fmt.Fprintf(stderr, "wavegen: %d of %d images failed\n", failed, len(files))
+		return 1
+	}
+	return 0
+}
+
+// parseArgs reads the flags and input arguments.
+func parseArgs(args []string, stderr io.Writer) (*options, error) {
+	fs := flag.NewFlagSet("wavegen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "Usage: wavegen [flags] image|glob|directory...")
+		fs.PrintDefaults()
+	}
+
+	opts := &options{}
+	style, segStyle := services.DefaultSVGStyle(), services.DefaultSegmentStyle()
+	var gradient, exports string
+	fs.StringVar(&opts.format, "format", formatJSON, "output format: json, svg, png or code")
+	fs.StringVar(&opts.lang, "lang", "", "language of -format code: "+strings.Join(services.ExportLanguages, ", "))
+	fs.StringVar(&opts.output, "o", "", "output file, or directory for several images; stdout when empty")
+	fs.IntVar(&opts.parallel, "j", runtime.NumCPU(), "images processed at the same time")
+	fs.DurationVar(&opts.timeout, "timeout", 0, "processing time limit per image, 0 for none")
+	fs.BoolVar(&opts.process.Overlay, "overlay", false, "draw the PNG wave over the image")
+	fs.BoolVar(&opts.process.Debug, "debug", false, "add fit diagnostics; with -format png, output the diagnostic image")
+	fs.StringVar(&exports, "export", "", "comma separated code exports added to JSON output")
+	fs.IntVar(&opts.process.MaxSegments, "max_segments", services.DefaultMaxSegments, "maximum polynomial segments fitted per image")
+	fs.IntVar(&opts.process.SegmentHeight, "segment_svg_height", services.DefaultSegmentHeight, "height of the per-segment SVGs")
+	fs.StringVar(&style.Mode, "svg_mode", style.Mode, "svg rendering: polyline or path")
+	fs.StringVar(&style.Stroke, "stroke", style.Stroke, "stroke color, none hides the line")
+	fs.Float64Var(&style.StrokeWidth, "stroke_width", style.StrokeWidth, "stroke width in pixels")
+	fs.StringVar(&style.LineCap, "linecap", style.LineCap, "line cap: butt, round or square")
+	fs.StringVar(&style.Fill, "fill", style.Fill, "fill the area below or above the wave")
+	fs.StringVar(&style.FillColor, "fill_color", style.FillColor, "fill color, defaults to the stroke color")
+	fs.StringVar(&gradient, "gradient", "", "comma separated gradient colors")
+	fs.StringVar(&style.GradientDir, "gradient_dir", style.GradientDir, "gradient direction: horizontal or vertical")
+	fs.StringVar(&style.Background, "background", style.Background, "background color, transparent when empty")
+	fs.BoolVar(&style.Responsive, "responsive", style.Responsive, "emit viewBox instead of a fixed size")
+	fs.StringVar(&style.AspectRatio, "aspect", style.AspectRatio, "preserveAspectRatio of responsive SVGs")
+	fs.IntVar(&style.Layers, "layers", style.Layers, "number of layered copies of the wave")
+	fs.Float64Var(&style.LayerOffset, "layer_offset", style.LayerOffset, "vertical offset in pixels between layers")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
+		}
+		return nil, usageError{err}
+	}
+
+	opts.inputs = fs.Args()
+	if len(opts.inputs) == 0 {
+		fs.Usage()
+		return nil, usageError{errors.New("no images given")}
+	}
+	if opts.parallel < 1 {
+		return nil, usageError{fmt.Errorf("-j must be positive, got %d", opts.parallel)}
+	}
+
+	// The stroke and background flags apply to the per-segment SVGs too,
+	// as in the API.
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "stroke":
+			segStyle.Stroke = style.Stroke
+		case "stroke_width":
+			segStyle.StrokeWidth = style.StrokeWidth
+		case "linecap":
+			segStyle.LineCap = style.LineCap
+		case "background":
+			segStyle.Background = style.Background
+		}
+	})
+	if style.Fill == "none" {
+		style.Fill = services.FillNone
+	}
+	if gradient != "" {
+		style.Gradient = services.SplitColors(gradient)
+	}
+	if err := style.Validate(); err != nil {
+		return nil, usageError{fmt.Errorf("invalid style: %w", err)}
+	}
+	if err := segStyle.Validate(); err != nil {
+		return nil, usageError{fmt.Errorf("invalid style: %w", err)}
+	}
+	opts.process.Style, opts.process.SegmentStyle = style, segStyle
+
+	if exports != "" {
+		for _, lang := range strings.Split(exports, ",") {
+			opts.process.Exports = append(opts.process.Exports, strings.TrimSpace(lang))
+		}
+	}
+	switch opts.format {
+	case formatJSON, formatSVG:
+	case formatPNG:
+		opts.process.PNG = true
+		if !opts.process.Debug {
+			if err := style.ValidateRaster(); err != nil {
+				return nil, usageError{fmt.Errorf("invalid style: %w", err)}
+			}
+		}
+	case formatCode:
+		if opts.lang == "" {
+			return nil, usageError{errors.New("-format code needs -lang")}
+		}
+		opts.process.Exports = []string{opts.lang}
+	default:
+		return nil, usageError{fmt.Errorf("invalid -format %q: must be json, svg, png or code", opts.format)}
+	}
+	for _, lang := range opts.process.Exports {
+		if !slices.Contains(services.ExportLanguages, lang) {
+			return nil, usageError{fmt.Errorf("invalid export %q: must be one of %s", lang, strings.Join(services.ExportLanguages, ", "))}
+		}
+	}
+	if opts.process.Overlay && opts.format != formatPNG {
+		return nil, usageError{errors.New("-overlay requires -format png")}
+	}
+	return opts, nil
+}
+
+// result is the outcome of processing one input file.
+type result struct {
+	index int
+	file  inputFile
+	res   *services.Result
+	err   error
+}
+
+// processAll processes files with opts.parallel workers and sends the
+// results as they complete.
+func processAll(ctx context.Context, opts *options, files []inputFile) <-chan result {
+	jobs := make(chan int)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < min(opts.parallel, len(files)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				res, err := processFile(ctx, files[i].path, opts)
+				results <- result{index: i, file: files[i], res: res, err: err}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for i := range files {
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// processFile decodes the image at path and runs the pipeline on it.
+func processFile(ctx context.Context, path string, opts *options) (*services.Result, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDecode, err)
+	}
+	if opts.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.timeout)
+		defer cancel()
+	}
+	return services.Process(ctx, img, opts.process)
+}
+
+// writer writes the results to stdout, a file or a directory.
+type writer struct {
+	opts   *options
+	stdout io.Writer
+	// dir is set when every result goes to its own file in it.
+	dir string
+	// ndjson is set when several results go to stdout as JSON lines.
+	ndjson *json.Encoder
+}
+
+func newWriter(opts *options, files []inputFile, stdout io.Writer) (*writer, error) {
+	w := &writer{opts: opts, stdout: stdout}
+	info, statErr := os.Stat(opts.output)
+	switch {
+	case opts.output == "" && len(files) > 1:
+		if opts.format != formatJSON {
+			return nil, fmt.Errorf("-format %s with several images needs -o DIR", opts.format)
+		}
+		w.ndjson = json.NewEncoder(stdout)
+	case opts.output != "" && (len(files) > 1 || (statErr == nil && info.IsDir())):
+		w.dir = opts.output
+		if err := os.MkdirAll(w.dir, 0o755); err != nil {
+			return nil, err
+		}
+		// Different inputs must not overwrite each other's results
+		seen := make(map[string]string)
+		for _, f := range files {
+			name := w.outputName(f)
+			if other, ok := seen[name]; ok {
+				return nil, fmt.Errorf("%s and %s would both be written to %s", other, f.path, name)
+			}
+			seen[name] = f.path
+		}
+	}
+	return w, nil
+}
+
+// outputName is the file the result of f is written to in w.dir: its path
+// relative to the input directory, or its name, with the extension of the
+// output format.
+func (w *writer) outputName(f inputFile) string {
+	ext := "." + w.opts.format
+	if w.opts.format == formatCode {
+		ext = codeExtensions[w.opts.lang]
+	}
+	return filepath.Join(w.dir, strings.TrimSuffix(f.name, filepath.Ext(f.name))+ext)
+}
+
+// write outputs a processed image. Failures are only written as NDJSON
+// lines; the caller reports them.
+func (w *writer) write(r result) error {
+	if w.ndjson != nil {
+		line := models.BatchResult{Index: r.index, Filename: r.file.path}
+		if r.err != nil {
+			line.Error = &models.APIError{Code: errorCode(r.err), Message: r.err.Error()}
+		} else {
+			line.WaveResponse = &r.res.WaveResponse
+		}
+		return w.ndjson.Encode(line)
+	}
+	if r.err != nil {
+		return nil
+	}
+	data, err := w.encode(r.res)
+	if err != nil {
+		return err
+	}
+	switch {
+	case w.dir != "":
+		name := w.outputName(r.file)
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			return err
+		}
+		return os.WriteFile(name, data, 0o644)
+	case w.opts.output != "":
+		return os.WriteFile(w.opts.output, data, 0o644)
+	}
+	_, err = w.stdout.Write(data)
+	return err
+}
+
+// encode returns the output of res in the selected format.
+func (w *writer) encode(res *services.Result) ([]byte, error) {
+	switch w.opts.format {
+	case formatSVG:
+		return []byte(res.SVG + "\n"), nil
+	case formatPNG:
+		return res.PNG, nil
+	case formatCode:
+		return []byte(res.Exports[w.opts.lang]), nil
+	}
+	data, err := json.MarshalIndent(res.WaveResponse, "", "  ")
+	return append(data, '\n'), err
+}
+
+// errorCode maps a processing error to the code the API reports for it.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return models.ErrCodeProcessingTimeout
+	case errors.Is(err, errDecode):
+		return models.ErrCodeInvalidImage
+	}
+	return models.ErrCodeProcessingFailed
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"wave-generator/models"
+)
+
+// writeWavePNG writes a 33x10 image with a wave-like pattern to path.
+func writeWavePNG(t *testing.T, path string) {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 33, 10))
+	for x := 0; x < 33; x++ {
+		for y := 0; y < 10; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(((x+y)%10)*25 + 5)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func runCLI(t *testing.T, args ...string) (code int, stdout, stderr string) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), args, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun_SingleImage(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "wave.png")
+	writeWavePNG(t, img)
+
+	code, stdout, stderr := runCLI(t, "-export", "js", img)
+	if code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	var res models.WaveResponse
+	if err := json.Unmarshal([]byte(stdout), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.SVG == "" || len(res.Segments) == 0 || res.Exports["js"] == "" {
+		t.Errorf("got %+v", res)
+	}
+
+	code, stdout, _ = runCLI(t, "-format", "svg", "-stroke", "red", img)
+	if code != 0 || !strings.HasPrefix(stdout, "<svg") || !strings.Contains(stdout, "red") {
+		t.Errorf("exit %d, got %q", code, stdout)
+	}
+
+	out := filepath.Join(dir, "wave-out.png")
+	if code, _, stderr = runCLI(t, "-format", "png", "-overlay", "-o", out, img); code != 0 {
+		t.Fatalf("exit %d: %s", code, stderr)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := png.Decode(f); err != nil {
+		t.Errorf("expected a PNG: %v", err)
+	}
+
+	code, stdout, _ = runCLI(t, "-format", "code", "-lang", "python", img)
+	if code != 0 || !strings.Contains(stdout, "def wave(") {
+		t.Errorf("exit %d, got %q", code, stdout)
+	}
+}
+
+func TestRun_Directory(t *testing.T) {
+	in, out := t.TempDir(), t.TempDir()
+	writeWavePNG(t, filepath.Join(in, "a.png"))
+	writeWavePNG(t, filepath.Join(in, "nested", "b.png"))
+	if err := os.WriteFile(filepath.Join(in, "broken.png"), []byte("not an image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	code, _, stderr := runCLI(t, "-format", "svg", "-j", "2", "-o", out, in)
+	if code != 1 || !strings.Contains(stderr, "broken.png") || !strings.Contains(stderr, "1 of 3 images failed") {
+		t.Errorf("exit %d: %s", code, stderr)
+	}
+	for _, name := range []string{"a.svg", filepath.Join("nested", "b.svg")} {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil || !strings.HasPrefix(string(data), "<svg") {
+			t.Errorf("%s: got %q, %v", name, data, err)
+		}
+	}
+
+	// several images without -o are written as NDJSON batch results
+	code, stdout, _ := runCLI(t, filepath.Join(in, "*.png"))
+	if code != 1 {
+		t.Errorf("exit %d, want 1 for the broken image", code)
+	}
+	results := make(map[string]models.BatchResult)
+	sc := bufio.NewScanner(strings.NewReader(stdout))
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var r models.BatchResult
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		results[filepath.Base(r.Filename)] = r
+	}
+	if r := results["a.png"]; r.WaveResponse == nil || r.SVG == "" {
+		t.Errorf("a.png: got %+v", r)
+	}
+	if r := results["broken.png"]; r.Error == nil || r.Error.Code != models.ErrCodeInvalidImage {
+		t.Errorf("broken.png: got %+v", r)
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	dir := t.TempDir()
+	img := filepath.Join(dir, "wave.png")
+	writeWavePNG(t, img)
+	writeWavePNG(t, filepath.Join(dir, "other", "wave.png"))
+
+	for name, tc := range map[string]struct {
+		args []string
+		want string
+	}{
+		"no images":       {nil, "no images given"},
+		"invalid format":  {[]string{"-format", "gif", img}, `invalid -format "gif"`},
+		"code needs lang": {[]string{"-format", "code", img}, "-format code needs -lang"},
+		"invalid export":  {[]string{"-export", "cobol", img}, `invalid export "cobol"`},
+		"invalid style":   {[]string{"-stroke", "red;x", img}, "invalid style"},
+		"NaN stroke":      {[]string{"-stroke_width", "NaN", img}, "invalid style"},
+		"overlay":         {[]string{"-overlay", img}, "-overlay requires -format png"},
+		"svg to stdout":   {[]string{"-format", "svg", dir}, "needs -o DIR"},
+		"same output":     {[]string{"-o", filepath.Join(dir, "out"), img, filepath.Join(dir, "other", "wave.png")}, "would both be written"},
+	} {
+		code, _, stderr := runCLI(t, tc.args...)
+		if code != 2 || !strings.Contains(stderr, tc.want) {
+			t.Errorf("%s: exit %d, got %q, want it to contain %q", name, code, stderr, tc.want)
+		}
+	}
+
+	if code, _, stderr := runCLI(t, filepath.Join(dir, "*.jpg")); code != 1 || !strings.Contains(stderr, "no matching files") {
+		t.Errorf("exit %d: %s", code, stderr)
+	}
+}
@@ -0,0 +1,525 @@
+// Package config loads the server configuration from defaults, an
+// optional YAML file, environment variables and command-line flags, in
+// increasing order of precedence, and validates it.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"wave-generator/jobs"
+	"wave-generator/services"
+	"wave-generator/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Rate-limit tiers of the default configuration.
+const (
+	TierFree     = "free"
+	TierStandard = "standard"
+	TierPro      = "pro"
+)
+
+// Config is the configuration of the server. Its YAML keys are also the
+// names of the command-line flags, e.g. -server.port.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Storage    Storage    `yaml:"storage"`
+	Auth       Auth       `yaml:"auth"`
+	RateLimits RateLimits `yaml:"rate_limits"`
+	Processing Processing `yaml:"processing"`
+	Jobs       Jobs       `yaml:"jobs"`
+	Cache      Cache      `yaml:"cache"`
+	Paths      Paths      `yaml:"paths"`
+	// LogLevel is debug, info, warn or error.
+	LogLevel string `yaml:"log_level"`
+}
+
+// Server configures the HTTP server. Uploads and processing must fit in
+// ReadTimeout and WriteTimeout; batches lift them for their own requests.
+type Server struct {
+	Port              int           `yaml:"port"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long shutdown waits for in-flight requests
+	// and jobs before canceling them.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// TrustProxy takes the client IP from X-Forwarded-For.
+	TrustProxy bool `yaml:"trust_proxy"`
+	// TrustedOrigins may use UI sessions besides the server itself.
+	TrustedOrigins []string `yaml:"trusted_origins"`
+	// CORSOrigins may call the API from a browser with an API key; "*"
+	// allows any origin.
+	CORSOrigins []string `yaml:"cors_origins"`
+	// ContentSecurityPolicy is sent with the pages; empty leaves it out.
+	ContentSecurityPolicy string `yaml:"content_security_policy"`
+}
+
+// Storage selects the key and rate-limit store. Load picks the backend
+// when none is set: redis when RedisAddr is set, as servers always used
+// Redis at REDIS_ADDR before the backend could be chosen, memory
+// otherwise.
+type Storage struct {
+	Backend   string `yaml:"backend"`
+	RedisAddr string `yaml:"redis_addr"`
+}
+
+// DefaultRedisAddr is the Redis address of the redis backend when
+// RedisAddr is not set.
+const DefaultRedisAddr = "localhost:6379"
+
+// resolve fills in the backend and Redis address left empty.
+func (s *Storage) resolve() {
+	if s.Backend == "" {
+		s.Backend = storage.BackendMemory
+		if s.RedisAddr != "" {
+			s.Backend = storage.BackendRedis
+		}
+	}
+	if s.Backend == storage.BackendRedis && s.RedisAddr == "" {
+		s.RedisAddr = DefaultRedisAddr
+	}
+}
+
+// Auth holds the secrets of the server. Empty values disable the admin
+// endpoints and generate a random session secret, respectively.
+type Auth struct {
+	AdminToken    string `yaml:"admin_token"`
+	SessionSecret string `yaml:"session_secret"`
+}
+
+// RateLimits configures the rate limits. Tiers read from a file or
+// RATE_LIMIT_TIERS are added to the default ones, replacing those with the
+// same name.
+type RateLimits struct {
+	Anonymous   Limit            `yaml:"anonymous"`
+	KeyIssue    Limit            `yaml:"key_issue"`
+	Tiers       map[string]Limit `yaml:"tiers"`
+	DefaultTier string           `yaml:"default_tier"`
+}
+
+// Processing configures image processing.
+type Processing struct {
+	// Timeout bounds the processing of each image; zero disables it.
+	Timeout time.Duration `yaml:"timeout"`
+	// MaxConcurrent bounds the requests processing images at the same
+	// time; zero means no limit.
+	MaxConcurrent int `yaml:"max_concurrent"`
+	// MaxUploadBytes bounds the image uploaded to a single-image request.
+	MaxUploadBytes   int64 `yaml:"max_upload_bytes"`
+	BatchParallelism int   `yaml:"batch_parallelism"`
+	MaxSegments      int   `yaml:"max_segments"`
+	SegmentHeight    int   `yaml:"segment_svg_height"`
+}
+
+// Jobs sizes the asynchronous job manager.
+type Jobs struct {
+	Workers   int           `yaml:"workers"`
+	QueueSize int           `yaml:"queue_size"`
+	ResultTTL time.Duration `yaml:"result_ttl"`
+	Timeout   time.Duration `yaml:"timeout"`
+	// AllowPrivateWebhooks lets webhooks reach loopback, private and
+	// link-local addresses.
+	AllowPrivateWebhooks bool `yaml:"allow_private_webhooks"`
+}
+
+// Cache configures the result cache of /generate-wave.
+type Cache struct {
+	Backend  string        `yaml:"backend"`
+	MaxBytes int64         `yaml:"max_bytes"`
+	TTL      time.Duration `yaml:"ttl"`
+}
+
+// Paths are directories the UI, blog and docs pages are served from instead
+// of the files embedded in the binary, for editing them without a rebuild.
+// Empty paths use the embedded files.
+type Paths struct {
+	Static string `yaml:"static"`
+	Blog   string `yaml:"blog"`
+	Docs   string `yaml:"docs"`
+}
+
+// Limit is a rate limit, written as requests/period, e.g. "300/1h".
+type Limit storage.Limit
+
+// UnmarshalText parses a limit such as "300/1h".
+func (l *Limit) UnmarshalText(b []byte) error {
+	n, period, ok := strings.Cut(string(b), "/")
+	if !ok {
+		return fmt.Errorf("invalid limit %q: must be requests/period, e.g. 300/1h", b)
+	}
+	requests, err := strconv.ParseInt(strings.TrimSpace(n), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid limit %q: invalid number of requests", b)
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil {
+		return fmt.Errorf("invalid limit %q: invalid period", b)
+	}
+	*l = Limit{Requests: requests, Period: d}
+	return nil
+}
+
+// MarshalText writes the limit as requests/period.
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(strconv.FormatInt(l.Requests, 10) + "/" + shortDuration(l.Period)), nil
+}
+
+// shortDuration formats d without zero trailing units, e.g. "1h" instead
+// of "1h0m0s".
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
+
+// DefaultContentSecurityPolicy allows the inline scripts and styles of the
+// pages, the highlight.js and MathJax CDNs and the image previews of the
+// UI, and forbids framing the pages.
+const DefaultContentSecurityPolicy = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdnjs.cloudflare.com https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdnjs.cloudflare.com; " +
+	"img-src 'self' data: blob:; font-src 'self' https://cdn.jsdelivr.net; connect-src 'self'; " +
+	"object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// Default returns the configuration used when nothing else is set.
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Port:                  8899,
+			ReadHeaderTimeout:     10 * time.Second,
+			ReadTimeout:           time.Minute,
+			WriteTimeout:          2 * time.Minute,
+			IdleTimeout:           2 * time.Minute,
+			ShutdownTimeout:       30 * time.Second,
+			ContentSecurityPolicy: DefaultContentSecurityPolicy,
+		},
+		RateLimits: RateLimits{
+			Anonymous: Limit{Requests: 300, Period: time.Hour},
+			KeyIssue:  Limit{Requests: 10, Period: time.Hour},
+			Tiers: map[string]Limit{
+				TierFree:     {Requests: 100, Period: time.Hour},
+				TierStandard: {Requests: 1000, Period: time.Hour},
+				TierPro:      {Requests: 10000, Period: time.Hour},
+			},
+			DefaultTier: TierStandard,
+		},
+		Processing: Processing{
+			Timeout:          30 * time.Second,
+			MaxConcurrent:    2 * runtime.NumCPU(),
+			MaxUploadBytes:   32 << 20,
+			BatchParallelism: runtime.NumCPU(),
+			MaxSegments:      services.DefaultMaxSegments,
+			SegmentHeight:    services.DefaultSegmentHeight,
+		},
+		Jobs: Jobs{
+			Workers:   runtime.NumCPU(),
+			QueueSize: jobs.DefaultQueueSize,
+			ResultTTL: jobs.DefaultTTL,
+			Timeout:   jobs.DefaultTimeout,
+		},
+		Cache: Cache{
+			Backend:  storage.CacheMemory,
+			MaxBytes: 64 << 20,
+			TTL:      24 * time.Hour,
+		},
+		LogLevel: "info",
+	}
+}
+
+// setting is a configuration value that can be set by an environment
+// variable and a flag named after its YAML key.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	field func(c *Config) any // pointer to the value
+}
+
+var settings = []setting{
+	{"server.port", "PORT", "HTTP port", func(c *Config) any { return &c.Server.Port }},
+	{"server.read_header_timeout", "READ_HEADER_TIMEOUT", "time to read request headers", func(c *Config) any { return &c.Server.ReadHeaderTimeout }},
+	{"server.read_timeout", "READ_TIMEOUT", "time to read a request", func(c *Config) any { return &c.Server.ReadTimeout }},
+	{"server.write_timeout", "WRITE_TIMEOUT", "time to write a response", func(c *Config) any { return &c.Server.WriteTimeout }},
+	{"server.idle_timeout", "IDLE_TIMEOUT", "time to keep idle connections open", func(c *Config) any { return &c.Server.IdleTimeout }},
+	{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", "time to wait for requests and jobs on shutdown", func(c *Config) any { return &c.Server.ShutdownTimeout }},
+	{"server.trust_proxy", "TRUST_PROXY", "take the client IP from X-Forwarded-For", func(c *Config) any { return &c.Server.TrustProxy }},
+	{"server.trusted_origins", "TRUSTED_ORIGINS", "comma separated origins allowed to use UI sessions", func(c *Config) any { return &c.Server.TrustedOrigins }},
+	{"server.cors_origins", "CORS_ORIGINS", "comma separated origins allowed to call the API with a key, * for any", func(c *Config) any { return &c.Server.CORSOrigins }},
+	{"server.content_security_policy", "CONTENT_SECURITY_POLICY", "Content-Security-Policy of the pages, empty for none", func(c *Config) any { return &c.Server.ContentSecurityPolicy }},
+	{"storage.backend", "STORAGE_BACKEND", "key and rate-limit store: memory or redis; redis when a Redis address is set", func(c *Config) any { return &c.Storage.Backend }},
+	{"storage.redis_addr", "REDIS_ADDR", "Redis address of the redis backend, " + DefaultRedisAddr + " when unset", func(c *Config) any { return &c.Storage.RedisAddr }},
+	{"auth.admin_token", "ADMIN_TOKEN", "token of the admin endpoints", func(c *Config) any { return &c.Auth.AdminToken }},
+	{"auth.session_secret", "SESSION_SECRET", "secret signing UI session cookies", func(c *Config) any { return &c.Auth.SessionSecret }},
+	{"rate_limits.anonymous", "RATE_LIMIT_ANONYMOUS", "limit per client IP of UI requests, e.g. 300/1h", func(c *Config) any { return &c.RateLimits.Anonymous }},
+	{"rate_limits.key_issue", "RATE_LIMIT_KEY_ISSUE", "limit per client IP of self-service keys", func(c *Config) any { return &c.RateLimits.KeyIssue }},
+	{"rate_limits.tiers", "RATE_LIMIT_TIERS", "extra or overridden tiers, e.g. gold=50000/1h", func(c *Config) any { return &c.RateLimits.Tiers }},
+	{"rate_limits.default_tier", "RATE_LIMIT_DEFAULT_TIER", "tier of keys without one", func(c *Config) any { return &c.RateLimits.DefaultTier }},
+	{"processing.timeout", "PROCESSING_TIMEOUT", "processing time limit per image, 0 for none", func(c *Config) any { return &c.Processing.Timeout }},
+	{"processing.max_concurrent", "MAX_CONCURRENT_PROCESSING", "requests processing images at the same time, 0 for no limit", func(c *Config) any { return &c.Processing.MaxConcurrent }},
+	{"processing.max_upload_bytes", "MAX_UPLOAD_BYTES", "size limit of an uploaded image", func(c *Config) any { return &c.Processing.MaxUploadBytes }},
+	{"processing.batch_parallelism", "BATCH_PARALLELISM", "images of a batch processed at the same time", func(c *Config) any { return &c.Processing.BatchParallelism }},
+	{"processing.max_segments", "MAX_SEGMENTS", "maximum polynomial segments fitted per image", func(c *Config) any { return &c.Processing.MaxSegments }},
+	{"processing.segment_svg_height", "SEGMENT_SVG_HEIGHT", "height of the per-segment SVGs", func(c *Config) any { return &c.Processing.SegmentHeight }},
+	{"jobs.workers", "JOB_WORKERS", "jobs processed concurrently", func(c *Config) any { return &c.Jobs.Workers }},
+	{"jobs.queue_size", "JOB_QUEUE_SIZE", "jobs that may wait for a worker", func(c *Config) any { return &c.Jobs.QueueSize }},
+	{"jobs.result_ttl", "JOB_RESULT_TTL", "how long finished jobs are kept", func(c *Config) any { return &c.Jobs.ResultTTL }},
+	{"jobs.timeout", "JOB_TIMEOUT", "processing time limit per job", func(c *Config) any { return &c.Jobs.Timeout }},
+	{"jobs.allow_private_webhooks", "JOB_ALLOW_PRIVATE_WEBHOOKS", "let webhooks reach loopback, private and link-local addresses", func(c *Config) any { return &c.Jobs.AllowPrivateWebhooks }},
+	{"cache.backend", "CACHE_BACKEND", "result cache: memory, store or off", func(c *Config) any { return &c.Cache.Backend }},
+	{"cache.max_bytes", "CACHE_MAX_BYTES", "size limit of the memory cache", func(c *Config) any { return &c.Cache.MaxBytes }},
+	{"cache.ttl", "CACHE_TTL", "how long results stay cached", func(c *Config) any { return &c.Cache.TTL }},
+	{"paths.static", "STATIC_DIR", "directory replacing the embedded UI files", func(c *Config) any { return &c.Paths.Static }},
+	{"paths.blog", "BLOG_DIR", "directory replacing the embedded blog posts", func(c *Config) any { return &c.Paths.Blog }},
+	{"paths.docs", "DOCS_DIR", "directory replacing the embedded API docs", func(c *Config) any { return &c.Paths.Docs }},
+	{"log_level", "LOG_LEVEL", "debug, info, warn or error", func(c *Config) any { return &c.LogLevel }},
+}
+
+// Load returns the configuration made of the defaults, the YAML file named
+// by -config or CONFIG_FILE, the environment variables read by getenv and
+// the flags in args, each overriding the previous ones. It registers the
+// flags on fs, which may hold flags of the caller, and parses args with
+// it. The result is validated; every invalid value is reported.
+func Load(fs *flag.FlagSet, args []string, getenv func(string) string) (*Config, error) {
+	path := fs.String("config", "", "YAML configuration file (env CONFIG_FILE)")
+	type flagValue struct {
+		s setting
+		v string
+	}
+	var flags []flagValue
+	for _, s := range settings {
+		fs.Func(s.key, s.usage+" (env "+s.env+")", func(v string) error {
+			flags = append(flags, flagValue{s, v})
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	if *path == "" {
+		*path = getenv("CONFIG_FILE")
+	}
+	if *path != "" {
+		if err := cfg.readFile(*path); err != nil {
+			return nil, err
+		}
+	}
+	var errs []error
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := set(s.field(cfg), v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	for _, f := range flags {
+		if err := set(f.s.field(cfg), f.v); err != nil {
+			errs = append(errs, fmt.Errorf("-%s: %w", f.s.key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	cfg.Storage.resolve()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// readFile merges the YAML file at path into c. Unknown keys are errors.
+func (c *Config) readFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	defer f.Close()
+	dec := yaml.NewDecoder(f)
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// set parses v into the value ptr points to.
+func set(ptr any, v string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = v
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", v)
+		}
+		*p = b
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*p = n
+	case *int64:
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", v)
+		}
+		*p = n
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, e.g. 30s or 5m", v)
+		}
+		*p = d
+	case *[]string:
+		*p = splitList(v)
+	case *Limit:
+		return p.UnmarshalText([]byte(v))
+	case *map[string]Limit:
+		if *p == nil {
+			*p = make(map[string]Limit)
+		}
+		for _, item := range splitList(v) {
+			name, limit, ok := strings.Cut(item, "=")
+			if !ok {
+				return fmt.Errorf("invalid tier %q: must be name=requests/period", item)
+			}
+			var l Limit
+			if err := l.UnmarshalText([]byte(limit)); err != nil {
+				return err
+			}
+			(*p)[strings.TrimSpace(name)] = l
+		}
+	default:
+		panic(fmt.Sprintf("config: unsupported setting type %T", ptr))
+	}
+	return nil
+}
+
+// splitList splits a comma separated list, dropping empty items.
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate reports every invalid value of c, by YAML key.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]any{key}, args...)...))
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, key, "must be positive, got %s", d)
+	}
+	oneOf := func(key, v string, allowed ...string) {
+		check(slices.Contains(allowed, v), key, "must be one of %s, got %q", strings.Join(allowed, ", "), v)
+	}
+	limit := func(key string, l Limit) {
+		check(l.Requests > 0 && l.Period > 0, key, "requests and period must be positive")
+		// buckets refill at millisecond resolution
+		check(l.Period <= 0 || l.Period >= time.Millisecond, key, "period must be at least 1ms, got %s", l.Period)
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port <= 65535, "server.port", "must be between 1 and 65535, got %d", c.Server.Port)
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	for _, o := range c.Server.TrustedOrigins {
+		check(validOrigin(o), "server.trusted_origins", "invalid origin %q: must be scheme://host[:port]", o)
+	}
+	for _, o := range c.Server.CORSOrigins {
+		check(o == "*" || validOrigin(o), "server.cors_origins", "invalid origin %q: must be scheme://host[:port] or *", o)
+	}
+	check(!strings.ContainsAny(c.Server.ContentSecurityPolicy, "\r\n"), "server.content_security_policy", "must be a single line")
+
+	oneOf("storage.backend", c.Storage.Backend, storage.BackendMemory, storage.BackendRedis)
+	check(c.Storage.Backend != storage.BackendRedis || c.Storage.RedisAddr != "", "storage.redis_addr", "must be set for the redis backend")
+
+	limit("rate_limits.anonymous", c.RateLimits.Anonymous)
+	limit("rate_limits.key_issue", c.RateLimits.KeyIssue)
+	for _, name := range slices.Sorted(maps.Keys(c.RateLimits.Tiers)) {
+		check(name != "", "rate_limits.tiers", "tier names must not be empty")
+		limit("rate_limits.tiers."+name, c.RateLimits.Tiers[name])
+	}
+	_, ok := c.RateLimits.Tiers[c.RateLimits.DefaultTier]
+	check(ok, "rate_limits.default_tier", "unknown tier %q", c.RateLimits.DefaultTier)
+
+	check(c.Processing.Timeout >= 0, "processing.timeout", "must not be negative, got %s", c.Processing.Timeout)
+	check(c.Processing.MaxConcurrent >= 0, "processing.max_concurrent", "must not be negative, got %d", c.Processing.MaxConcurrent)
+	check(c.Processing.MaxUploadBytes > 0, "processing.max_upload_bytes", "must be positive, got %d", c.Processing.MaxUploadBytes)
+	check(c.Processing.BatchParallelism > 0, "processing.batch_parallelism", "must be positive, got %d", c.Processing.BatchParallelism)
+	check(c.Processing.MaxSegments > 0, "processing.max_segments", "must be positive, got %d", c.Processing.MaxSegments)
+	check(c.Processing.SegmentHeight > 0, "processing.segment_svg_height", "must be positive, got %d", c.Processing.SegmentHeight)
+
+	check(c.Jobs.Workers > 0, "jobs.workers", "must be positive, got %d", c.Jobs.Workers)
+	check(c.Jobs.QueueSize > 0, "jobs.queue_size", "must be positive, got %d", c.Jobs.QueueSize)
+	positive("jobs.result_ttl", c.Jobs.ResultTTL)
+	positive("jobs.timeout", c.Jobs.Timeout)
+
+	oneOf("cache.backend", c.Cache.Backend, storage.CacheMemory, storage.CacheStore, storage.CacheOff)
+	check(c.Cache.MaxBytes > 0, "cache.max_bytes", "must be positive, got %d", c.Cache.MaxBytes)
+	positive("cache.ttl", c.Cache.TTL)
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "log_level", "must be debug, info, warn or error, got %q", c.LogLevel)
+	return errors.Join(errs...)
+}
+
+// validOrigin reports whether o is an origin such as https://example.com.
+func validOrigin(o string) bool {
+	u, err := url.Parse(o)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" && strings.Trim(u.Path, "/") == ""
+}
+
+// Level returns the log level; Validate ensures it parses.
+func (c *Config) Level() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// Write writes c as YAML, the format of the configuration file, with the
+// secrets redacted.
+func (c *Config) Write(w io.Writer) error {
+	redacted := *c
+	for _, s := range []*string{&redacted.Auth.AdminToken, &redacted.Auth.SessionSecret} {
+		if *s != "" {
+			*s = "REDACTED"
+		}
+	}
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&redacted); err != nil {
+		return err
+	}
+	return enc.Close()
+}
@@ -0,0 +1,171 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/storage"
+)
+
+func load(t *testing.T, args []string, env map[string]string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Load(fs, args, func(key string) string { return env[key] })
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := load(t, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Default()
+	want.Storage.Backend = storage.BackendMemory
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("got %+v, want the defaults", cfg)
+	}
+}
+
+func TestLoad_StorageBackend(t *testing.T) {
+	for name, tc := range map[string]struct {
+		env      map[string]string
+		want     string
+		wantAddr string
+	}{
+		"default":            {want: storage.BackendMemory},
+		"redis address only": {env: map[string]string{"REDIS_ADDR": "redis:6379"}, want: storage.BackendRedis, wantAddr: "redis:6379"},
+		"redis backend only": {env: map[string]string{"STORAGE_BACKEND": "redis"}, want: storage.BackendRedis, wantAddr: DefaultRedisAddr},
+		"explicit memory":    {env: map[string]string{"STORAGE_BACKEND": "memory", "REDIS_ADDR": "redis:6379"}, want: storage.BackendMemory, wantAddr: "redis:6379"},
+	} {
+		cfg, err := load(t, nil, tc.env)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if cfg.Storage.Backend != tc.want || cfg.Storage.RedisAddr != tc.wantAddr {
+			t.Errorf("%s: got %+v, want backend %s at %q", name, cfg.Storage, tc.want, tc.wantAddr)
+		}
+	}
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, `
+server:
+  port: 1000
+  trusted_origins: [https://ui.example.org]
+jobs:
+  workers: 3
+rate_limits:
+  anonymous: 50/1m
+  tiers:
+    gold: 50000/1h
+log_level: debug
+`)
+	cfg, err := load(t, []string{"-server.port=3000", "-jobs.queue_size", "7"}, map[string]string{
+		"CONFIG_FILE":      path,
+		"PORT":             "2000",
+		"JOB_QUEUE_SIZE":   "5",
+		"CACHE_TTL":        "1h",
+		"RATE_LIMIT_TIERS": "free=1/1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 3000 || cfg.Jobs.QueueSize != 7 {
+		t.Errorf("got port %d and queue size %d, want the flags to win", cfg.Server.Port, cfg.Jobs.QueueSize)
+	}
+	if cfg.Jobs.Workers != 3 || cfg.LogLevel != "debug" || cfg.Server.TrustedOrigins[0] != "https://ui.example.org" {
+		t.Errorf("expected the file values, got %+v", cfg)
+	}
+	if cfg.Cache.TTL != time.Hour {
+		t.Errorf("got cache TTL %s, want the environment value", cfg.Cache.TTL)
+	}
+	if cfg.RateLimits.Anonymous != (Limit{Requests: 50, Period: time.Minute}) {
+		t.Errorf("got anonymous limit %+v", cfg.RateLimits.Anonymous)
+	}
+	tiers := cfg.RateLimits.Tiers
+	if tiers["gold"].Requests != 50000 || tiers["free"].Requests != 1 || tiers[TierStandard].Requests != 1000 {
+		t.Errorf("got tiers %+v, want the extra tiers merged into the defaults", tiers)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args []string
+		env  map[string]string
+		want []string
+	}{
+		"invalid env":     {env: map[string]string{"PORT": "http"}, want: []string{`PORT: invalid integer "http"`}},
+		"invalid flag":    {args: []string{"-cache.ttl=soon"}, want: []string{`-cache.ttl: invalid duration "soon"`}},
+		"unknown flag":    {args: []string{"-prot=1"}, want: []string{"-prot"}},
+		"missing file":    {args: []string{"-config=/nonexistent.yaml"}, want: []string{"reading config file"}},
+		"unknown key":     {env: map[string]string{"CONFIG_FILE": writeFile(t, "server:\n  prot: 1\n")}, want: []string{"field prot not found"}},
+		"invalid limit":   {env: map[string]string{"RATE_LIMIT_ANONYMOUS": "300"}, want: []string{"must be requests/period"}},
+		"short period":    {env: map[string]string{"RATE_LIMIT_ANONYMOUS": "300/500us"}, want: []string{"rate_limits.anonymous: period must be at least 1ms, got 500µs"}},
+		"invalid origin":  {env: map[string]string{"TRUSTED_ORIGINS": "ui.example.org"}, want: []string{`server.trusted_origins: invalid origin "ui.example.org"`}},
+		"invalid cors":    {env: map[string]string{"CORS_ORIGINS": "*.example.org"}, want: []string{`server.cors_origins: invalid origin "*.example.org"`}},
+		"invalid csp":     {env: map[string]string{"CONTENT_SECURITY_POLICY": "default-src 'self'\nSet-Cookie: x"}, want: []string{"server.content_security_policy: must be a single line"}},
+		"unknown tier":    {env: map[string]string{"RATE_LIMIT_DEFAULT_TIER": "gold"}, want: []string{`rate_limits.default_tier: unknown tier "gold"`}},
+		"invalid backend": {env: map[string]string{"STORAGE_BACKEND": "disk"}, want: []string{"storage.backend: must be one of memory, redis"}},
+		"every invalid value": {
+			env:  map[string]string{"PORT": "0", "JOB_WORKERS": "-1", "LOG_LEVEL": "loud"},
+			want: []string{"server.port: must be between 1 and 65535", "jobs.workers: must be positive", "log_level: must be"},
+		},
+	} {
+		_, err := load(t, tc.args, tc.env)
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+			continue
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("%s: got %q, want it to contain %q", name, err, want)
+			}
+		}
+	}
+}
+
+func TestConfig_Write(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.AdminToken = "s3cret"
+	cfg.Processing.Timeout = 0
+	cfg.Server.TrustedOrigins = []string{"https://ui.example.org"}
+	cfg.Server.CORSOrigins = []string{"*"}
+
+	var sb strings.Builder
+	if err := cfg.Write(&sb); err != nil {
+		t.Fatal(err)
+	}
+	out := sb.String()
+	if strings.Contains(out, "s3cret") || !strings.Contains(out, "admin_token: REDACTED") {
+		t.Errorf("expected the admin token to be redacted:\n%s", out)
+	}
+	for _, line := range []string{"port: 8899", "standard: 1000/1h", "ttl: 24h0m0s"} {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing %q in\n%s", line, out)
+		}
+	}
+
+	// the output is a valid configuration file
+	read := Default()
+	if err := read.readFile(writeFile(t, out)); err != nil {
+		t.Fatal(err)
+	}
+	read.Auth.AdminToken = cfg.Auth.AdminToken
+	if !reflect.DeepEqual(read, cfg) {
+		t.Errorf("got %+v, want %+v", read, cfg)
+	}
+}
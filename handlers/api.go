@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"io/fs"
+	"sync"
+	"time"
+	"wave-generator/config"
+	"wave-generator/jobs"
+	"wave-generator/storage"
+)
+
+// API holds the dependencies of the handlers that authenticate requests or
+// persist state. Those handlers are methods on it so tests and alternative
+// deployments can swap the store instead of relying on package globals.
+type API struct {
+	Store storage.Store
+	// Tiers maps rate-limit tier names to the limit applied per API key.
+	Tiers map[string]storage.Limit
+	// DefaultTier is used for keys without a tier.
+	DefaultTier string
+	// AnonymousLimit applies per client IP to UI requests without a key.
+	AnonymousLimit storage.Limit
+	// KeyIssueLimit applies per client IP to self-service key creation.
+	KeyIssueLimit storage.Limit
+	// TrustProxy makes the client IP come from X-Forwarded-For. Only set
+	// it behind a reverse proxy that sets the header.
+	TrustProxy bool
+	// AdminToken protects the key management endpoints. They are disabled
+	// when it is empty.
+	AdminToken string
+	// TrustedOrigins lists extra origins (scheme://host[:port]) allowed to
+	// call the API with a UI session, e.g. when the UI is served from
+	// another host name. The server's own origin is always trusted.
+	TrustedOrigins []string
+	// CORSOrigins lists the origins allowed to call the API from a browser
+	// with an API key; "*" allows any origin.
+	CORSOrigins []string
+	// ContentSecurityPolicy is sent with the pages; empty leaves it out.
+	ContentSecurityPolicy string
+	// SessionSecret signs UI session cookies.
+	SessionSecret []byte
+	// Jobs runs the asynchronous jobs of /jobs.
+	Jobs *jobs.Manager
+	// BatchParallelism is the number of images of a batch processed at
+	// the same time; zero means one per CPU.
+	BatchParallelism int
+	// Cache keeps /generate-wave results by content key for CacheTTL; nil
+	// disables caching.
+	Cache    storage.Cache
+	CacheTTL time.Duration
+	// ProcessingTimeout bounds the processing of each image of a
+	// /generate-wave or /batch request; zero disables the deadline.
+	ProcessingTimeout time.Duration
+	// MaxConcurrent bounds the /generate-wave and /batch requests
+	// processing images at the same time; others are answered 503. Zero
+	// means no limit. It must be set before serving requests.
+	MaxConcurrent int
+	// MaxUploadBytes bounds the image uploaded to /generate-wave and
+	// /jobs; larger bodies are answered 413. Zero means 32 MiB.
+	MaxUploadBytes int64
+	// MaxSegments and SegmentHeight set services.Options of every image;
+	// zero means the services defaults.
+	MaxSegments   int
+	SegmentHeight int
+	// Assets holds the static, blog and docs directories of the pages,
+	// usually embedded in the binary. Without it they are read from the
+	// working directory.
+	Assets fs.FS
+	// StaticDir, BlogDir and DocsDir replace the directories of Assets
+	// with ones on disk, read at every request, e.g. to edit the pages
+	// without rebuilding.
+	StaticDir string
+	BlogDir   string
+	DocsDir   string
+	// assetCache keeps the embedded assets and the pages rendered from
+	// them.
+	assetCache sync.Map
+
+	slotsOnce sync.Once
+	slots     chan struct{}
+}
+
+// NewAPI returns an API backed by store and configured by cfg. Without
+// a session secret a random one is used, so sessions do not survive
+// restarts and are not shared between instances.
+func NewAPI(store storage.Store, cfg *config.Config) *API {
+	return &API{
+		Store:                 store,
+		Tiers:                 tierLimits(cfg.RateLimits.Tiers),
+		DefaultTier:           cfg.RateLimits.DefaultTier,
+		AnonymousLimit:        storage.Limit(cfg.RateLimits.Anonymous),
+		KeyIssueLimit:         storage.Limit(cfg.RateLimits.KeyIssue),
+		TrustProxy:            cfg.Server.TrustProxy,
+		AdminToken:            cfg.Auth.AdminToken,
+		TrustedOrigins:        normalizeOrigins(cfg.Server.TrustedOrigins),
+		CORSOrigins:           normalizeOrigins(cfg.Server.CORSOrigins),
+		SessionSecret:         loadSessionSecret(cfg.Auth.SessionSecret),
+		ContentSecurityPolicy: cfg.Server.ContentSecurityPolicy,
+		Jobs: jobs.NewManager(jobs.Config{
+			Workers:              cfg.Jobs.Workers,
+			QueueSize:            cfg.Jobs.QueueSize,
+			TTL:                  cfg.Jobs.ResultTTL,
+			Timeout:              cfg.Jobs.Timeout,
+			AllowPrivateWebhooks: cfg.Jobs.AllowPrivateWebhooks,
+		}),
+		BatchParallelism:  cfg.Processing.BatchParallelism,
+		Cache:             newCache(cfg.Cache, store),
+		CacheTTL:          cfg.Cache.TTL,
+		ProcessingTimeout: cfg.Processing.Timeout,
+		MaxConcurrent:     cfg.Processing.MaxConcurrent,
+		MaxUploadBytes:    cfg.Processing.MaxUploadBytes,
+		MaxSegments:       cfg.Processing.MaxSegments,
+		SegmentHeight:     cfg.Processing.SegmentHeight,
+		StaticDir:         cfg.Paths.Static,
+		BlogDir:           cfg.Paths.Blog,
+		DocsDir:           cfg.Paths.Docs,
+	}
+}
+
+// Close stops the job manager, canceling running jobs.
+func (a *API) Close() {
+	if a.Jobs != nil {
+		a.Jobs.Close()
+	}
+}
+
+// Shutdown stops accepting jobs and waits until the queued and running
+// ones finish or ctx is done, whichever comes first; see jobs.Manager.
+func (a *API) Shutdown(ctx context.Context) error {
+	if a.Jobs == nil {
+		return nil
+	}
+	return a.Jobs.Shutdown(ctx)
+}
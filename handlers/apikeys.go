@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+// apiKeyPrefix starts every key so leaked keys are easy to recognize.
+const apiKeyPrefix = "wg_"
+
+// defaultScopes are granted to self-service keys.
+var defaultScopes = []string{models.ScopeGenerate}
+
+// apiKeyError is an authentication failure with the status to report.
+type apiKeyError struct {
+	status  int
+	code    string
+	message string
+}
+
+func (e *apiKeyError) Error() string { return e.message }
+
+var (
+	errMissingKey = &apiKeyError{http.StatusUnauthorized, models.ErrCodeMissingAPIKey, "Missing X-API-Key header"}
+	errInvalidKey = &apiKeyError{http.StatusUnauthorized, models.ErrCodeInvalidAPIKey, "Invalid API key"}
+	errInactive   = &apiKeyError{http.StatusUnauthorized, models.ErrCodeInactiveAPIKey, "API key expired or revoked"}
+	errScope      = &apiKeyError{http.StatusForbidden, models.ErrCodeInsufficientScope, "API key lacks the required scope"}
+)
+
+// Keys have the form wg_<id>_<secret>. The id is 8 random bytes in hex,
+// stored in clear to look the key up; the secret is 32 random bytes in
+// base64url and only its SHA-256 hash is stored.
+
+func newKeyID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func newKeySecret() (secret, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return secret, hashSecret(secret), nil
+}
+
+func formatAPIKey(id, secret string) string {
+	return apiKeyPrefix + id + "_" + secret
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseAPIKey splits a key into its ID and secret.
+func parseAPIKey(key string) (id, secret string, ok bool) {
+	rest, found := strings.CutPrefix(key, apiKeyPrefix)
+	if !found {
+		return "", "", false
+	}
+	id, secret, ok = strings.Cut(rest, "_")
+	return id, secret, ok && len(id) == 16 && secret != ""
+}
+
+// issueAPIKey creates and stores a new key with the owner, scopes, tier,
+// quota and expiry of meta, returning the full key once.
+func (a *API) issueAPIKey(ctx context.Context, meta models.APIKey) (models.APIKey, string, error) {
+	id, err := newKeyID()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	secret, hash, err := newKeySecret()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	meta.ID = id
+	meta.Hash = hash
+	meta.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	if err := a.Store.SaveKey(ctx, meta); err != nil {
+		return models.APIKey{}, "", err
+	}
+	return meta, formatAPIKey(id, secret), nil
+}
+
+// authenticateAPIKey validates a raw X-API-Key value and checks that it
+// grants scope; an empty scope accepts any active key. On success the key's
+// last used time is updated. Store failures are returned as they are, not
+// as an *apiKeyError, so they are not reported as an invalid key.
+func (a *API) authenticateAPIKey(ctx context.Context, raw, scope string) (models.APIKey, error) {
+	if raw == "" {
+		return models.APIKey{}, errMissingKey
+	}
+	id, secret, ok := parseAPIKey(raw)
+	if !ok {
+		return models.APIKey{}, errInvalidKey
+	}
+	meta, err := a.Store.GetKey(ctx, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		return models.APIKey{}, errInvalidKey
+	}
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("looking up API key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(meta.Hash), []byte(hashSecret(secret))) != 1 {
+		return models.APIKey{}, errInvalidKey
+	}
+	now := time.Now().UTC()
+	if !meta.Active(now) {
+		return models.APIKey{}, errInactive
+	}
+	if scope != "" && !meta.HasScope(scope) {
+		return models.APIKey{}, errScope
+	}
+	if err := a.Store.TouchKey(ctx, id, now); err == nil {
+		meta.LastUsed = &now
+	}
+	return meta, nil
+}
+
+// writeKeyError responds with the status of an authentication failure,
+// or 503 when the key could not be looked up.
+func writeKeyError(w http.ResponseWriter, r *http.Request, err error) {
+	var keyErr *apiKeyError
+	if !errors.As(err, &keyErr) {
+		slog.ErrorContext(r.Context(), "authenticating API key", "err", err)
+		writeError(w, r, http.StatusServiceUnavailable, models.ErrCodeUnavailable, "API keys cannot be checked, retry later")
+		return
+	}
+	writeError(w, r, keyErr.status, keyErr.code, keyErr.message)
+}
+
+// admitKey authenticates the X-API-Key of r for scope and applies the
+// key's monthly quota and rate limit. When it returns false the error
+// response has been written.
+func (a *API) admitKey(w http.ResponseWriter, r *http.Request, scope string) (models.APIKey, bool) {
+	key, err := a.authenticateAPIKey(r.Context(), r.Header.Get("X-API-Key"), scope)
+	if err != nil {
+		writeKeyError(w, r, err)
+		return models.APIKey{}, false
+	}
+	if !a.checkQuota(w, r, key) || !a.allow(w, r, "key:"+key.ID, a.keyLimit(key)) {
+		return models.APIKey{}, false
+	}
+	return key, true
+}
+
+// GenerateAPIKeyHandler issues a self-service API key with the default
+// scopes. An optional JSON body {"owner": "..."} labels the key. Issuance
+// is rate limited per client IP, and browsers must send the CSRF token of
+// a UI session (see checkCSRF) so other sites cannot issue keys.
+func (a *API) GenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost, "POST only")
+		return
+	}
+	if !a.checkCSRF(w, r) {
+		return
+	}
+	if !a.allow(w, r, "issue:"+a.clientIP(r), a.KeyIssueLimit) {
+		return
+	}
+	var req struct {
+		Owner string `json:"owner"`
+	}
+	if err := decodeOptionalJSON(r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	meta, key, err := a.issueAPIKey(r.Context(), models.APIKey{Owner: req.Owner, Scopes: defaultScopes})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not store API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.IssuedAPIKey{Key: key, APIKey: meta})
+}
+
+// authorizeAdmin checks for "Authorization: Bearer <AdminToken>" and writes
+// the error response when it is missing or wrong.
+func (a *API) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if a.AdminToken == "" {
+		writeError(w, r, http.StatusForbidden, models.ErrCodeAdminDisabled, "Admin API disabled")
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.AdminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, r, http.StatusUnauthorized, models.ErrCodeUnauthorized, "Invalid admin credentials")
+		return false
+	}
+	return true
+}
+
+// ListAPIKeysHandler returns the metadata of every key (GET /admin/keys).
+func (a *API) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+	keys, err := a.Store.ListKeys(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not list API keys")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string][]models.APIKey{"keys": keys})
+}
+
+// CreateAPIKeyHandler issues a key with explicit owner, scopes, rate-limit
+// tier, monthly quota and expiry (POST /admin/keys). expires_in is a Go
+// duration such as "720h".
+func (a *API) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Owner        string   `json:"owner"`
+		Scopes       []string `json:"scopes"`
+		Tier         string   `json:"tier"`
+		MonthlyQuota int64    `json:"monthly_quota"`
+		ExpiresIn    string   `json:"expires_in"`
+	}
+	if err := decodeOptionalJSON(r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	if len(req.Scopes) == 0 {
+		req.Scopes = defaultScopes
+	}
+	if err := a.validateLimits(req.Tier, req.MonthlyQuota); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	var expiresAt *time.Time
+	if req.ExpiresIn != "" {
+		d, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || d <= 0 {
+			writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid expires_in: must be a positive duration such as 720h")
+			return
+		}
+		t := time.Now().UTC().Add(d).Truncate(time.Second)
+		expiresAt = &t
+	}
+	meta, key, err := a.issueAPIKey(r.Context(), models.APIKey{
+		Owner:        req.Owner,
+		Scopes:       req.Scopes,
+		Tier:         req.Tier,
+		MonthlyQuota: req.MonthlyQuota,
+		ExpiresAt:    expiresAt,
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not store API key")
+		return
+	}
+	writeJSON(w, http.StatusCreated, models.IssuedAPIKey{Key: key, APIKey: meta})
+}
+
+// UpdateAPIKeyHandler changes the rate-limit tier and monthly quota of a
+// key (PATCH /admin/keys/{id}). Omitted fields are left unchanged; a quota
+// of 0 removes the quota.
+func (a *API) UpdateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+	var req struct {
+		Tier         *string `json:"tier"`
+		MonthlyQuota *int64  `json:"monthly_quota"`
+	}
+	if err := decodeOptionalJSON(r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid request body: "+err.Error())
+		return
+	}
+	meta, ok := a.loadKeyForAdmin(w, r)
+	if !ok {
+		return
+	}
+	if req.Tier != nil {
+		meta.Tier = *req.Tier
+	}
+	if req.MonthlyQuota != nil {
+		meta.MonthlyQuota = *req.MonthlyQuota
+	}
+	if err := a.validateLimits(meta.Tier, meta.MonthlyQuota); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if err := a.Store.SaveKey(r.Context(), meta); err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not update API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, meta)
+}
+
+// validateLimits checks a tier and monthly quota requested by an admin.
+func (a *API) validateLimits(tier string, quota int64) error {
+	if _, ok := a.Tiers[tier]; tier != "" && !ok {
+		return fmt.Errorf("unknown tier %q", tier)
+	}
+	if quota < 0 {
+		return errors.New("monthly_quota must not be negative")
+	}
+	return nil
+}
+
+// RotateAPIKeyHandler replaces the secret of a key, keeping its ID and
+// metadata (POST /admin/keys/{id}/rotate). The old secret stops working
+// immediately.
+func (a *API) RotateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+	meta, ok := a.loadKeyForAdmin(w, r)
+	if !ok {
+		return
+	}
+	if meta.RevokedAt != nil {
+		writeError(w, r, http.StatusConflict, models.ErrCodeConflict, "API key is revoked")
+		return
+	}
+	secret, hash, err := newKeySecret()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not rotate API key")
+		return
+	}
+	meta.Hash = hash
+	if err := a.Store.SaveKey(r.Context(), meta); err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not rotate API key")
+		return
+	}
+	writeJSON(w, http.StatusOK, models.IssuedAPIKey{Key: formatAPIKey(meta.ID, secret), APIKey: meta})
+}
+
+// RevokeAPIKeyHandler revokes a key (DELETE /admin/keys/{id}). The record is
+// kept so it still shows up when listing keys.
+func (a *API) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+	meta, ok := a.loadKeyForAdmin(w, r)
+	if !ok {
+		return
+	}
+	if meta.RevokedAt == nil {
+		now := time.Now().UTC().Truncate(time.Second)
+		meta.RevokedAt = &now
+		if err := a.Store.SaveKey(r.Context(), meta); err != nil {
+			writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not revoke API key")
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, meta)
+}
+
+func (a *API) loadKeyForAdmin(w http.ResponseWriter, r *http.Request) (models.APIKey, bool) {
+	meta, err := a.Store.GetKey(r.Context(), r.PathValue("id"))
+	if errors.Is(err, storage.ErrNotFound) {
+		writeError(w, r, http.StatusNotFound, models.ErrCodeNotFound, "API key not found")
+		return meta, false
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not load API key")
+		return meta, false
+	}
+	return meta, true
+}
+
+// decodeOptionalJSON decodes a JSON request body into v, accepting an empty body.
+func decodeOptionalJSON(r *http.Request, v any) error {
+	if r.Body == nil {
+		return nil
+	}
+	err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(v)
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+	return err
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+func adminRequest(method, target, body string) *http.Request {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer s3cret")
+	return req
+}
+
+func decodeIssued(t *testing.T, rec *httptest.ResponseRecorder) models.IssuedAPIKey {
+	t.Helper()
+	var out models.IssuedAPIKey
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	return out
+}
+
+func TestGenerateAPIKeyHandler(t *testing.T) {
+	api := newTestAPI(t)
+	mr := useMiniredis(t, api)
+
+	req := httptest.NewRequest(http.MethodPost, "/generate-apikey", strings.NewReader(`{"owner":"team-a"}`))
+	rec := httptest.NewRecorder()
+	api.GenerateAPIKeyHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	out := decodeIssued(t, rec)
+	id, secret, ok := parseAPIKey(out.Key)
+	if !ok || id != out.ID || len(secret) < 40 {
+		t.Fatalf("unexpected key format %q", out.Key)
+	}
+	if out.Owner != "team-a" || !out.HasScope(models.ScopeGenerate) {
+		t.Errorf("unexpected metadata: %+v", out.APIKey)
+	}
+	if strings.Contains(mr.Dump(), secret) {
+		t.Error("secret must not be stored in plaintext")
+	}
+	if _, err := api.authenticateAPIKey(context.Background(), out.Key, models.ScopeGenerate); err != nil {
+		t.Errorf("issued key does not authenticate: %v", err)
+	}
+
+	t.Run("empty body", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.GenerateAPIKeyHandler(rec, httptest.NewRequest(http.MethodPost, "/generate-apikey", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("got status %d, want 200", rec.Code)
+		}
+	})
+
+	t.Run("wrong method", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.GenerateAPIKeyHandler(rec, httptest.NewRequest(http.MethodGet, "/generate-apikey", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("got status %d, want 405", rec.Code)
+		}
+	})
+
+	t.Run("cross-site request", func(t *testing.T) {
+		for name, set := range map[string]func(*http.Request){
+			"no session": func(r *http.Request) { r.Header.Set("Origin", "https://evil.example.net") },
+			"no token": func(r *http.Request) {
+				asUI(r)
+				r.Header.Del(CSRFHeader)
+				r.Header.Set("Sec-Fetch-Site", "cross-site")
+				r.Header.Del("Origin")
+			},
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/generate-apikey", nil)
+			set(req)
+			rec := httptest.NewRecorder()
+			api.GenerateAPIKeyHandler(rec, req)
+			if rec.Code != http.StatusForbidden || decodeError(t, rec).Code != models.ErrCodeCSRFRejected {
+				t.Errorf("%s: got status %d, want 403", name, rec.Code)
+			}
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/generate-apikey", nil)
+		asUI(req)
+		rec := httptest.NewRecorder()
+		api.GenerateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("got status %d, want the UI to get a key", rec.Code)
+		}
+	})
+
+	t.Run("rate limited per IP", func(t *testing.T) {
+		api.KeyIssueLimit = storage.Limit{Requests: 1, Period: time.Hour}
+		req := httptest.NewRequest(http.MethodPost, "/generate-apikey", nil)
+		req.RemoteAddr = "198.51.100.7:4321"
+		rec := httptest.NewRecorder()
+		api.GenerateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200", rec.Code)
+		}
+		rec = httptest.NewRecorder()
+		api.GenerateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %d, want 429", rec.Code)
+		}
+	})
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	_, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: []string{"other:scope"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _, _ := parseAPIKey(key)
+
+	tests := []struct {
+		name string
+		raw  string
+		want *apiKeyError
+	}{
+		{"missing", "", errMissingKey},
+		{"legacy format", "api_1712345678901234567", errInvalidKey},
+		{"wrong secret", formatAPIKey(id, "nope"), errInvalidKey},
+		{"unknown id", formatAPIKey("0123456789abcdef", "nope"), errInvalidKey},
+		{"missing scope", key, errScope},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := api.authenticateAPIKey(ctx, tt.raw, models.ScopeGenerate); err != tt.want {
+				t.Errorf("got error %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateAPIKey_StoreDown(t *testing.T) {
+	api := newTestAPI(t)
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Store = downStore{api.Store}
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/generate-wave", nil)
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	if _, ok := api.admitKey(rec, req, models.ScopeGenerate); ok {
+		t.Fatal("expected the key to be refused")
+	}
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("got status %d, want 503: %s", rec.Code, rec.Body.String())
+	}
+	var resp models.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Error.Code != models.ErrCodeUnavailable {
+		t.Errorf("got %+v (%v)", resp, err)
+	}
+}
+
+func TestAdminKeyHandlers(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+
+	t.Run("disabled without token", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.ListAPIKeysHandler(rec, adminRequest(http.MethodGet, "/admin/keys", ""))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("got status %d, want 403", rec.Code)
+		}
+	})
+
+	api.AdminToken = "s3cret"
+
+	t.Run("wrong token", func(t *testing.T) {
+		req := adminRequest(http.MethodGet, "/admin/keys", "")
+		req.Header.Set("Authorization", "Bearer guess")
+		rec := httptest.NewRecorder()
+		api.ListAPIKeysHandler(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	api.CreateAPIKeyHandler(rec, adminRequest(http.MethodPost, "/admin/keys", `{"owner":"billing","scopes":["wave:generate"],"tier":"pro","expires_in":"24h"}`))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: got status %d, want 201: %s", rec.Code, rec.Body.String())
+	}
+	created := decodeIssued(t, rec)
+	if created.ExpiresAt == nil || created.Owner != "billing" || created.Tier != TierPro {
+		t.Fatalf("unexpected created key: %+v", created.APIKey)
+	}
+
+	t.Run("unknown tier", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.CreateAPIKeyHandler(rec, adminRequest(http.MethodPost, "/admin/keys", `{"tier":"platinum"}`))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("invalid expiry", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.CreateAPIKeyHandler(rec, adminRequest(http.MethodPost, "/admin/keys", `{"expires_in":"soon"}`))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.ListAPIKeysHandler(rec, adminRequest(http.MethodGet, "/admin/keys", ""))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200", rec.Code)
+		}
+		_, secret, _ := parseAPIKey(created.Key)
+		if strings.Contains(rec.Body.String(), secret) || strings.Contains(rec.Body.String(), hashSecret(secret)) {
+			t.Error("listing must not expose secrets or hashes")
+		}
+		var out struct {
+			Keys []models.APIKey `json:"keys"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&out); err != nil || len(out.Keys) != 1 || out.Keys[0].ID != created.ID {
+			t.Errorf("unexpected listing: %+v, %v", out, err)
+		}
+	})
+
+	t.Run("update limits", func(t *testing.T) {
+		req := adminRequest(http.MethodPatch, "/admin/keys/"+created.ID, `{"monthly_quota":500}`)
+		req.SetPathValue("id", created.ID)
+		rec := httptest.NewRecorder()
+		api.UpdateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		stored, _ := api.Store.GetKey(ctx, created.ID)
+		if stored.MonthlyQuota != 500 || stored.Tier != TierPro {
+			t.Errorf("expected quota 500 and unchanged tier, got %+v", stored)
+		}
+
+		req = adminRequest(http.MethodPatch, "/admin/keys/"+created.ID, `{"tier":"platinum"}`)
+		req.SetPathValue("id", created.ID)
+		rec = httptest.NewRecorder()
+		api.UpdateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("unknown tier: got status %d, want 400", rec.Code)
+		}
+	})
+
+	t.Run("rotate", func(t *testing.T) {
+		req := adminRequest(http.MethodPost, "/admin/keys/"+created.ID+"/rotate", "")
+		req.SetPathValue("id", created.ID)
+		rec := httptest.NewRecorder()
+		api.RotateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		rotated := decodeIssued(t, rec)
+		if rotated.ID != created.ID || rotated.Key == created.Key {
+			t.Fatalf("expected new secret for the same ID, got %+v", rotated)
+		}
+		if _, err := api.authenticateAPIKey(ctx, created.Key, models.ScopeGenerate); err != errInvalidKey {
+			t.Errorf("old secret should stop working, got %v", err)
+		}
+		if _, err := api.authenticateAPIKey(ctx, rotated.Key, models.ScopeGenerate); err != nil {
+			t.Errorf("rotated key should work, got %v", err)
+		}
+		created = rotated
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		req := adminRequest(http.MethodDelete, "/admin/keys/"+created.ID, "")
+		req.SetPathValue("id", created.ID)
+		rec := httptest.NewRecorder()
+		api.RevokeAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		if _, err := api.authenticateAPIKey(ctx, created.Key, models.ScopeGenerate); err != errInactive {
+			t.Errorf("revoked key should be rejected, got %v", err)
+		}
+
+		req = adminRequest(http.MethodPost, "/admin/keys/"+created.ID+"/rotate", "")
+		req.SetPathValue("id", created.ID)
+		rec = httptest.NewRecorder()
+		api.RotateAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("rotating a revoked key: got status %d, want 409", rec.Code)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		req := adminRequest(http.MethodDelete, "/admin/keys/missing", "")
+		req.SetPathValue("id", "missing")
+		rec := httptest.NewRecorder()
+		api.RevokeAPIKeyHandler(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want 404", rec.Code)
+		}
+	})
+}
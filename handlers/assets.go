@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/fs"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Directories of the page assets in Assets.
+const (
+	staticDir = "static"
+	blogDir   = "blog"
+	docsDir   = "docs"
+)
+
+// How long browsers and proxies may cache the pages and the files under
+// /static/ when they are embedded. Assets read from disk are revalidated
+// on every request instead.
+const (
+	pageMaxAge   = 5 * time.Minute
+	staticMaxAge = 24 * time.Hour
+)
+
+// pageAssets are the files the index, blog and docs pages are served
+// from, relative to Assets.
+var pageAssets = []string{
+	staticDir + "/index.html",
+	staticDir + "/page_template.html",
+	blogDir + "/wave-generator-math-tutorial.md",
+	docsDir + "/api-docs.md",
+}
+
+// asset is a file of the pages, or a page rendered from files, with the
+// ETag of its content.
+type asset struct {
+	data []byte
+	etag string
+	// onDisk assets may change between requests.
+	onDisk bool
+}
+
+// assetFS returns the asset directory sub: the override directory of the
+// API when set, the embedded Assets otherwise. Without Assets, sub is read
+// relative to the working directory.
+func (a *API) assetFS(sub string) fs.FS {
+	if dir := a.assetDir(sub); dir != "" {
+		return os.DirFS(dir)
+	}
+	if a.Assets != nil {
+		if fsys, err := fs.Sub(a.Assets, sub); err == nil {
+			return fsys
+		}
+	}
+	return os.DirFS(sub)
+}
+
+func (a *API) assetDir(sub string) string {
+	switch sub {
+	case staticDir:
+		return a.StaticDir
+	case blogDir:
+		return a.BlogDir
+	case docsDir:
+		return a.DocsDir
+	}
+	return ""
+}
+
+// onDisk reports whether any of the asset directories is read from disk,
+// so what is built from it must not be cached.
+func (a *API) onDisk(subs ...string) bool {
+	for _, sub := range subs {
+		if a.Assets == nil || a.assetDir(sub) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// readAsset returns the content of the file name of the asset directory
+// sub.
+func (a *API) readAsset(sub, name string) ([]byte, error) {
+	return fs.ReadFile(a.assetFS(sub), name)
+}
+
+// loadAsset returns the asset built by load from the asset directories
+// subs. Embedded assets never change, so they are built once and kept
+// under key.
+func (a *API) loadAsset(key string, load func() ([]byte, error), subs ...string) (*asset, error) {
+	onDisk := a.onDisk(subs...)
+	if !onDisk {
+		if v, ok := a.assetCache.Load(key); ok {
+			return v.(*asset), nil
+		}
+	}
+	data, err := load()
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	as := &asset{data: data, etag: `"` + hex.EncodeToString(sum[:12]) + `"`, onDisk: onDisk}
+	if !onDisk {
+		a.assetCache.Store(key, as)
+	}
+	return as, nil
+}
+
+// serveAsset writes as, named name, with its ETag, answering 304 to a
+// matching If-None-Match and serving ranges. Embedded assets may be cached
+// for maxAge; those read from disk and a zero maxAge must be revalidated.
+func serveAsset(w http.ResponseWriter, r *http.Request, name string, as *asset, maxAge time.Duration) {
+	h := w.Header()
+	h.Set("ETag", as.etag)
+	if h.Get("Cache-Control") == "" {
+		if as.onDisk || maxAge == 0 {
+			h.Set("Cache-Control", "no-cache")
+		} else {
+			h.Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+		}
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(as.data))
+}
+
+// StaticHandler serves the files of the static directory under /static/.
+func (a *API) StaticHandler(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if !fs.ValidPath(name) || name == "." {
+		http.NotFound(w, r)
+		return
+	}
+	as, err := a.loadAsset(staticDir+"/"+name, func() ([]byte, error) { return a.readAsset(staticDir, name) }, staticDir)
+	if err != nil {
+		// directories cannot be read either
+		http.NotFound(w, r)
+		return
+	}
+	serveAsset(w, r, name, as, staticMaxAge)
+}
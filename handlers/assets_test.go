@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func embeddedAPI(t *testing.T) *API {
+	t.Helper()
+	api := newTestAPI(t)
+	api.StaticDir, api.BlogDir, api.DocsDir = "", "", ""
+	api.Assets = fstest.MapFS{
+		"static/index.html":                    {Data: []byte("<h1>embedded</h1>")},
+		"static/page_template.html":            {Data: []byte("<title>{{TITLE}}</title><main><!--CONTENT--></main>")},
+		"static/app.js":                        {Data: []byte("console.log(1)")},
+		"static/img/logo.svg":                  {Data: []byte("<svg/>")},
+		"blog/wave-generator-math-tutorial.md": {Data: []byte("# Blog")},
+		"docs/api-docs.md":                     {Data: []byte("# Docs")},
+	}
+	return api
+}
+
+func get(t *testing.T, h http.HandlerFunc, path, etag string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestStaticHandler(t *testing.T) {
+	api := embeddedAPI(t)
+
+	t.Run("embedded file", func(t *testing.T) {
+		rec := get(t, api.StaticHandler, "/static/app.js", "")
+		if rec.Code != http.StatusOK || rec.Body.String() != "console.log(1)" {
+			t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "public, max-age=86400" {
+			t.Errorf("Cache-Control = %q", got)
+		}
+		if !strings.Contains(rec.Header().Get("Content-Type"), "javascript") {
+			t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+		}
+
+		rec = get(t, api.StaticHandler, "/static/app.js", rec.Header().Get("ETag"))
+		if rec.Code != http.StatusNotModified {
+			t.Errorf("expected 304 for a matching ETag, got %d", rec.Code)
+		}
+	})
+
+	t.Run("nested file", func(t *testing.T) {
+		if rec := get(t, api.StaticHandler, "/static/img/logo.svg", ""); rec.Code != http.StatusOK {
+			t.Errorf("got %d", rec.Code)
+		}
+	})
+
+	for _, path := range []string{"/static/", "/static/img", "/static/missing.js", "/static/../go.mod", "/static//app.js"} {
+		t.Run("not found "+path, func(t *testing.T) {
+			if rec := get(t, api.StaticHandler, path, ""); rec.Code != http.StatusNotFound {
+				t.Errorf("got %d", rec.Code)
+			}
+		})
+	}
+
+	t.Run("override directory", func(t *testing.T) {
+		dir := t.TempDir()
+		api := embeddedAPI(t)
+		api.StaticDir = dir
+		createTempMarkdown(t, filepath.Join(dir, "app.js"), "v1")
+
+		rec := get(t, api.StaticHandler, "/static/app.js", "")
+		if rec.Body.String() != "v1" || rec.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("got %q with %v", rec.Body.String(), rec.Header())
+		}
+		etag := rec.Header().Get("ETag")
+
+		// Files on disk are read again, so edits show without a restart
+		if err := os.WriteFile(filepath.Join(dir, "app.js"), []byte("v2"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		rec = get(t, api.StaticHandler, "/static/app.js", etag)
+		if rec.Code != http.StatusOK || rec.Body.String() != "v2" {
+			t.Errorf("got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestEmbeddedPages(t *testing.T) {
+	api := embeddedAPI(t)
+
+	for path, tc := range map[string]struct {
+		h    http.HandlerFunc
+		want string
+	}{
+		"/":                                  {api.IndexHandler, "<h1>embedded</h1>"},
+		"/blog/wave-generator-math-tutorial": {api.BlogPostHandler, "<h1>Blog</h1>"},
+		"/docs/api-docs":                     {api.APIDocsHandler, "<h1>Docs</h1>"},
+	} {
+		t.Run(path, func(t *testing.T) {
+			rec := get(t, tc.h, path, "")
+			if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), tc.want) {
+				t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+			}
+			if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+				t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+			}
+			rec = get(t, tc.h, path, rec.Header().Get("ETag"))
+			if rec.Code != http.StatusNotModified {
+				t.Errorf("expected 304 for a matching ETag, got %d", rec.Code)
+			}
+		})
+	}
+
+	t.Run("index is not shared", func(t *testing.T) {
+		rec := get(t, api.IndexHandler, "/", "")
+		if got := rec.Header().Get("Cache-Control"); got != "private, no-cache" {
+			t.Errorf("Cache-Control = %q", got)
+		}
+	})
+
+	t.Run("rendered pages are cached", func(t *testing.T) {
+		rec := get(t, api.APIDocsHandler, "/docs/api-docs", "")
+		if got := rec.Header().Get("Cache-Control"); got != "public, max-age=300" {
+			t.Errorf("Cache-Control = %q", got)
+		}
+		if _, ok := api.assetCache.Load(docsDir + "/api-docs.md.html"); !ok {
+			t.Error("rendered docs not cached")
+		}
+	})
+
+	t.Run("missing page", func(t *testing.T) {
+		api := embeddedAPI(t)
+		delete(api.Assets.(fstest.MapFS), "docs/api-docs.md")
+		if rec := get(t, api.APIDocsHandler, "/docs/api-docs", ""); rec.Code != http.StatusNotFound {
+			t.Errorf("got %d", rec.Code)
+		}
+	})
+}
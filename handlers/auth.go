@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sessionCookieName = "wave_session"
+	sessionTTL        = 24 * time.Hour
+)
+
+// normalizeOrigins lower-cases origins and strips trailing slashes, to
+// compare them with the Origin header.
+func normalizeOrigins(list []string) []string {
+	var origins []string
+	for _, o := range list {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, strings.ToLower(o))
+		}
+	}
+	return origins
+}
+
+func loadSessionSecret(secret string) []byte {
+	if secret != "" {
+		return []byte(secret)
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic("cannot generate session secret: " + err.Error())
+	}
+	return b
+}
+
+// newSessionCookie issues a signed session cookie for the bundled UI. The
+// value is "<expiry>.<nonce>.<signature>" where the signature is an
+// HMAC-SHA256 of the expiry and nonce.
+func (a *API) newSessionCookie(now time.Time, secure bool) *http.Cookie {
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	expires := now.Add(sessionTTL)
+	payload := strconv.FormatInt(expires.Unix(), 10) + "." + hex.EncodeToString(nonce)
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    payload + "." + a.signSession(payload),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func (a *API) signSession(payload string) string {
+	mac := hmac.New(sha256.New, a.SessionSecret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// validSession reports whether the request carries an unexpired session
+// cookie signed with SessionSecret.
+func (a *API) validSession(r *http.Request, now time.Time) bool {
+	c, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return false
+	}
+	payload, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.signSession(payload))) {
+		return false
+	}
+	expiry, _, _ := strings.Cut(payload, ".")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	return err == nil && now.Before(time.Unix(unix, 0))
+}
+
+// originAllowed reports whether the browser-supplied Origin (or, failing
+// that, the Referer) is the server itself or one of TrustedOrigins.
+// Requests without either header are not considered browser requests.
+func (a *API) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || origin == "null" {
+		ref, err := url.Parse(r.Referer())
+		if err != nil || ref.Host == "" {
+			return false
+		}
+		origin = ref.Scheme + "://" + ref.Host
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, o := range a.TrustedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+// isSameOrigin reports whether the request comes from the bundled UI: it
+// must carry a valid session cookie (issued by IndexHandler) and originate
+// from the server's own origin or a trusted one, and state-changing
+// requests must send the session's CSRF token. Such requests skip API key
+// authentication.
+func (a *API) isSameOrigin(r *http.Request) bool {
+	return a.validSession(r, time.Now()) && a.originAllowed(r) && (safeMethod(r.Method) || a.validCSRF(r))
+}
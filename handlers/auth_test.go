@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"wave-generator/config"
+	"wave-generator/jobs"
+	"wave-generator/models"
+	"wave-generator/storage"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// testSessionSecret signs the session cookies of every test API.
+var testSessionSecret = []byte("test session secret")
+
+// newTestAPI returns an API backed by an in-memory store, with the rate
+// limits of the default configuration.
+func newTestAPI(t *testing.T) *API {
+	t.Helper()
+	limits := config.Default().RateLimits
+	api := &API{
+		Store:          storage.NewMemory(),
+		Tiers:          tierLimits(limits.Tiers),
+		DefaultTier:    limits.DefaultTier,
+		AnonymousLimit: storage.Limit(limits.Anonymous),
+		KeyIssueLimit:  storage.Limit(limits.KeyIssue),
+		SessionSecret:  testSessionSecret,
+		Jobs:           jobs.NewManager(jobs.Config{Workers: 2}),
+	}
+	t.Cleanup(api.Close)
+	return api
+}
+
+// asUI makes req look like it comes from the bundled UI: a valid session
+// cookie, its CSRF token and an Origin matching the request host.
+func asUI(req *http.Request) {
+	ui := &API{SessionSecret: testSessionSecret}
+	session := ui.newSessionCookie(time.Now(), false)
+	req.AddCookie(session)
+	req.Header.Set(CSRFHeader, ui.csrfToken(session.Value))
+	req.Header.Set("Origin", "http://"+req.Host)
+}
+
+// useMiniredis backs api with an in-process Redis stand-in.
+func useMiniredis(t *testing.T, api *API) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	api.Store = storage.NewRedis(mr.Addr())
+	t.Cleanup(func() { _ = api.Store.Close() })
+	return mr
+}
+
+func TestValidSession(t *testing.T) {
+	api := newTestAPI(t)
+	now := time.Now()
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave", nil)
+	req.AddCookie(api.newSessionCookie(now, false))
+
+	if !api.validSession(req, now) {
+		t.Error("expected fresh session to be valid")
+	}
+	if api.validSession(req, now.Add(sessionTTL+time.Minute)) {
+		t.Error("expected expired session to be rejected")
+	}
+
+	forged := api.newSessionCookie(now, false)
+	forged.Value = strings.Replace(forged.Value, forged.Value[:10], "9999999999", 1)
+	req = httptest.NewRequest(http.MethodPost, "/generate-wave", nil)
+	req.AddCookie(forged)
+	if api.validSession(req, now) {
+		t.Error("expected tampered session to be rejected")
+	}
+}
+
+func TestOriginAllowed(t *testing.T) {
+	api := newTestAPI(t)
+	api.TrustedOrigins = normalizeOrigins([]string{"https://ui.example.org/", " HTTPS://Other.example.org"})
+
+	tests := []struct {
+		name    string
+		origin  string
+		referer string
+		want    bool
+	}{
+		{"same host", "http://example.com", "", true},
+		{"trusted origin", "https://ui.example.org", "", true},
+		{"trusted origin case insensitive", "https://other.example.org", "", true},
+		{"foreign origin", "https://evil.example.net", "", false},
+		{"referer fallback", "", "http://example.com/index.html", true},
+		{"foreign referer", "", "https://evil.example.net/", false},
+		{"no headers", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/generate-wave", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			if got := api.originAllowed(req); got != tt.want {
+				t.Errorf("originAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWavePatternHandler_Auth(t *testing.T) {
+	api := newTestAPI(t)
+	api.Tiers[TierStandard] = storage.Limit{Requests: 2, Period: time.Hour}
+	mr := useMiniredis(t, api)
+	meta, apiKey, err := api.issueAPIKey(context.Background(), models.APIKey{Owner: "test", Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := testWavePNG(t).Bytes()
+	send := func(prepare func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave", bytes.NewReader(body))
+		prepare(req)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+		return rec
+	}
+
+	t.Run("missing key", func(t *testing.T) {
+		if rec := send(func(*http.Request) {}); rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("invalid key", func(t *testing.T) {
+		rec := send(func(r *http.Request) { r.Header.Set("X-API-Key", "api_1712345678901234567") })
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("session from foreign origin", func(t *testing.T) {
+		rec := send(func(r *http.Request) {
+			asUI(r)
+			r.Header.Set("Origin", "https://evil.example.net")
+		})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("session without CSRF token", func(t *testing.T) {
+		rec := send(func(r *http.Request) {
+			asUI(r)
+			r.Header.Del(CSRFHeader)
+		})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("origin without session", func(t *testing.T) {
+		rec := send(func(r *http.Request) { r.Header.Set("Origin", "http://"+r.Host) })
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("ui session", func(t *testing.T) {
+		if rec := send(asUI); rec.Code != http.StatusOK {
+			t.Errorf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		if !mr.Exists("ratelimit:ip:192.0.2.1") {
+			t.Error("UI requests should be rate limited by client IP")
+		}
+	})
+
+	t.Run("valid key and rate limit", func(t *testing.T) {
+		withKey := func(r *http.Request) { r.Header.Set("X-API-Key", apiKey) }
+		for i := 0; i < 2; i++ {
+			rec := send(withKey)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("request %d: got status %d, want 200: %s", i, rec.Code, rec.Body.String())
+			}
+			if got, want := rec.Header().Get("RateLimit-Remaining"), strconv.Itoa(1-i); got != want {
+				t.Errorf("request %d: got RateLimit-Remaining %q, want %q", i, got, want)
+			}
+		}
+		rec := send(withKey)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("got status %d, want 429", rec.Code)
+		}
+		if rec.Header().Get("Retry-After") == "" || rec.Header().Get("RateLimit-Limit") != "2" {
+			t.Errorf("expected Retry-After and RateLimit-Limit headers, got %v", rec.Header())
+		}
+		if ttl := mr.TTL("ratelimit:key:" + meta.ID); ttl <= 0 || ttl > time.Hour {
+			t.Errorf("expected the rate limit bucket to expire within an hour, got %v", ttl)
+		}
+	})
+
+	t.Run("redis unavailable", func(t *testing.T) {
+		mr.Close()
+		// A key that cannot be checked is not an invalid key
+		rec := send(func(r *http.Request) { r.Header.Set("X-API-Key", apiKey) })
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d, want 503", rec.Code)
+		}
+	})
+}
@@ -0,0 +1,456 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"wave-generator/models"
+	"wave-generator/services"
+)
+
+// Batch limits. Zip archives are read into memory, so maxBatchBytes bounds
+// the memory a batch needs besides the images being processed.
+const (
+	maxBatchBytes      = 256 << 20
+	maxBatchImageBytes = 32 << 20
+	maxBatchFiles      = 1000
+)
+
+// Batch deadlines. An upload may take batchReadGrace plus the time to send
+// what has been read at batchMinRate; each write of the results must finish
+// within batchWriteTimeout. They replace the server timeouts, which are
+// too short for large batches.
+const (
+	batchReadGrace    = 30 * time.Second
+	batchMinRate      = 64 << 10 // bytes per second
+	batchWriteTimeout = 30 * time.Second
+)
+
+// Batch output formats, selected by the output query parameter.
+const (
+	batchNDJSON = "ndjson"
+	batchZip    = "zip"
+)
+
+// batchItem is one image of a batch, in input order.
+type batchItem struct {
+	index int
+	name  string
+	data  []byte
+	err   error // set when the file could not be read
+}
+
+// BatchHandler processes many images in one request. The body is either a
+// zip archive (application/zip) or multipart/form-data with one file per
+// image. Images are processed concurrently, up to BatchParallelism at a
+// time, each taking one of the MaxConcurrent processing slots while it is
+// decoded and processed; images wait for a free slot rather than failing
+// with 503. The results are streamed as they complete: one NDJSON line per
+// image by default, or a zip of SVGs with output=zip. It takes the query
+// parameters of WavePatternHandler except format=png.
+//
+// Batches require an API key. Every image takes a token from the key's
+// rate limit and counts towards its monthly quota; images over either
+// limit get a rate_limited or quota_exceeded error instead of a result.
+func (a *API) BatchHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := a.admitKey(w, r, models.ScopeGenerate)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	opts, err := a.processOptions(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if opts.PNG {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Batches return SVG; format=png is not supported")
+		return
+	}
+	output := q.Get("output")
+	switch output {
+	case "":
+		output = batchNDJSON
+	case batchNDJSON, batchZip:
+	default:
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, fmt.Sprintf("invalid output %q: must be ndjson or zip", output))
+		return
+	}
+	budget, err := a.newBatchBudget(r.Context(), key)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Quota check error")
+		return
+	}
+
+	// Uploading and streaming a batch may take longer than the server
+	// timeouts allow, so the deadlines move along as long as the client
+	// keeps up: see batchReader and batchWriter.
+	rc := http.NewResponseController(w)
+	r.Body = http.MaxBytesReader(w, &batchReader{ReadCloser: r.Body, setDeadline: rc.SetReadDeadline, start: time.Now()}, maxBatchBytes)
+	read, err := batchSource(r)
+	if err != nil {
+		status := http.StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		writeError(w, r, status, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	items := make(chan batchItem)
+	readDone := make(chan error, 1)
+	go func() {
+		defer close(items)
+		readDone <- read(func(it batchItem) bool {
+			select {
+			case items <- it:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+
+	results := make(chan models.BatchResult)
+	var wg sync.WaitGroup
+	for i := 0; i < a.batchParallelism(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for it := range items {
+				res := a.processBatchItem(ctx, key.ID, budget, it, opts)
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	out := newBatchWriter(w, output)
+	for res := range results {
+		if err := out.write(res); err != nil {
+			// the client is gone; stop reading and processing
+			cancel()
+		}
+	}
+	if err := <-readDone; err != nil && ctx.Err() == nil {
+		_ = out.write(models.BatchResult{Index: -1, Error: &models.APIError{Code: models.ErrCodeInvalidRequest, Message: err.Error()}})
+	}
+	_ = out.close()
+}
+
+func (a *API) batchParallelism() int {
+	if a.BatchParallelism > 0 {
+		return a.BatchParallelism
+	}
+	return runtime.NumCPU()
+}
+
+// processBatchItem admits, decodes and processes one image and meters it
+// like a synchronous request.
+func (a *API) processBatchItem(ctx context.Context, keyID string, budget *batchBudget, it batchItem, opts services.Options) models.BatchResult {
+	res := models.BatchResult{Index: it.index, Filename: it.name}
+	if it.err != nil {
+		res.Error = &models.APIError{Code: models.ErrCodeInvalidRequest, Message: it.err.Error()}
+		return res
+	}
+	if res.Error = budget.take(ctx); res.Error != nil {
+		return res
+	}
+	release, err := a.waitSlot(ctx)
+	if err != nil {
+		_, res.Error = a.processingError(err)
+		return res
+	}
+	defer release()
+
+	start := time.Now()
+	status := http.StatusOK
+	var pixels int64
+	defer func() { a.recordUsage(keyID, start, status, pixels) }()
+
+	img, _, err := image.Decode(bytes.NewReader(it.data))
+	services.TimingsFrom(ctx).Since(services.StageDecode, start)
+	if err != nil {
+		status = http.StatusBadRequest
+		res.Error = &models.APIError{Code: models.ErrCodeInvalidImage, Message: "Error decoding image: " + err.Error()}
+		return res
+	}
+	pixels = imagePixels(img)
+	ctx, cancel := a.processingContext(ctx)
+	defer cancel()
+	out, err := services.Process(ctx, img, opts)
+	if err != nil {
+		status, res.Error = a.processingError(err)
+		return res
+	}
+	observeImage(pixels, out)
+	res.WaveResponse = &out.WaveResponse
+	return res
+}
+
+// batchBudget hands out the rate-limit tokens and monthly quota of a
+// batch, one image at a time. The first image uses the token taken when
+// the request was admitted.
+type batchBudget struct {
+	a     *API
+	key   models.APIKey
+	mu    sync.Mutex
+	first bool
+	quota int64 // requests left this month, or -1 without a quota
+}
+
+func (a *API) newBatchBudget(ctx context.Context, key models.APIKey) (*batchBudget, error) {
+	b := &batchBudget{a: a, key: key, first: true, quota: -1}
+	if key.MonthlyQuota > 0 {
+		month, err := a.Store.MonthUsage(ctx, key.ID, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		b.quota = key.MonthlyQuota - month.Requests
+	}
+	return b, nil
+}
+
+func (b *batchBudget) take(ctx context.Context) *models.APIError {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.quota == 0 {
+		rateLimitRejections.Inc("quota")
+		return &models.APIError{Code: models.ErrCodeQuotaExceeded, Message: fmt.Sprintf("Monthly quota of %d requests exceeded", b.key.MonthlyQuota)}
+	}
+	if b.first {
+		b.first = false
+	} else {
+		d, err := b.a.Store.Allow(ctx, "ratelimit:key:"+b.key.ID, b.a.keyLimit(b.key))
+		if err != nil {
+			return &models.APIError{Code: models.ErrCodeInternal, Message: "Rate limit error"}
+		}
+		if !d.Allowed {
+			rateLimitRejections.Inc("key")
+			return &models.APIError{
+				Code:    models.ErrCodeRateLimited,
+				Message: "Rate limit exceeded. Try again in " + seconds(d.RetryAfter) + "s",
+				Details: map[string]any{"retry_after": math.Ceil(d.RetryAfter.Seconds()), "limit": d.Limit},
+			}
+		}
+	}
+	if b.quota > 0 {
+		b.quota--
+	}
+	return nil
+}
+
+// batchSource returns a function that reads the images of a zip or
+// multipart body in order and passes them to emit until it returns false.
+// Entries that are directories or hidden files are skipped.
+func batchSource(r *http.Request) (func(emit func(batchItem) bool) error, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, errors.New("content type must be application/zip or multipart/form-data")
+	}
+	switch mediaType {
+	case "application/zip", "application/x-zip-compressed":
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		if err != nil {
+			return nil, fmt.Errorf("invalid zip archive: %w", err)
+		}
+		var files []*zip.File
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() && !skipBatchFile(f.Name) {
+				files = append(files, f)
+			}
+		}
+		if len(files) > maxBatchFiles {
+			return nil, fmt.Errorf("too many files: %d, at most %d per batch", len(files), maxBatchFiles)
+		}
+		return func(emit func(batchItem) bool) error {
+			for i, f := range files {
+				it := batchItem{index: i, name: f.Name}
+				if rc, err := f.Open(); err != nil {
+					it.err = err
+				} else {
+					it.data, it.err = readBatchFile(rc)
+					rc.Close()
+				}
+				if !emit(it) {
+					return nil
+				}
+			}
+			return nil
+		}, nil
+	case "multipart/form-data":
+		mr, err := r.MultipartReader()
+		if err != nil {
+			return nil, err
+		}
+		return func(emit func(batchItem) bool) error {
+			for i := 0; ; {
+				part, err := mr.NextPart()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return fmt.Errorf("reading multipart body: %w", err)
+				}
+				if part.FileName() == "" || skipBatchFile(part.FileName()) {
+					continue
+				}
+				if i == maxBatchFiles {
+					return fmt.Errorf("too many files: at most %d per batch", maxBatchFiles)
+				}
+				it := batchItem{index: i, name: part.FileName()}
+				it.data, it.err = readBatchFile(part)
+				i++
+				if !emit(it) {
+					return nil
+				}
+			}
+		}, nil
+	}
+	return nil, errors.New("content type must be application/zip or multipart/form-data")
+}
+
+// skipBatchFile reports whether an archive entry is metadata rather than
+// an image, such as __MACOSX/ entries and dot files.
+func skipBatchFile(name string) bool {
+	name = strings.ReplaceAll(name, `\`, "/")
+	return strings.HasPrefix(name, "__MACOSX/") || strings.HasPrefix(path.Base(name), ".")
+}
+
+func readBatchFile(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxBatchImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxBatchImageBytes {
+		return nil, fmt.Errorf("file larger than %d MiB", maxBatchImageBytes>>20)
+	}
+	return data, nil
+}
+
+// batchReader extends the read deadline of the connection before each
+// Read, allowing batchReadGrace plus the time to read n bytes at
+// batchMinRate, so a client that stalls cannot hold the request open.
+type batchReader struct {
+	io.ReadCloser
+	setDeadline func(time.Time) error
+	start       time.Time
+	n           int64
+}
+
+func (br *batchReader) Read(p []byte) (int, error) {
+	_ = br.setDeadline(br.start.Add(batchReadGrace + time.Duration(br.n)*time.Second/batchMinRate))
+	n, err := br.ReadCloser.Read(p)
+	br.n += int64(n)
+	return n, err
+}
+
+// batchWriter streams batch results as NDJSON or as a zip of SVGs. In the
+// zip, failed images are listed in errors.ndjson.
+type batchWriter struct {
+	w      http.ResponseWriter
+	rc     *http.ResponseController
+	zw     *zip.Writer
+	names  map[string]bool
+	failed []models.BatchResult
+}
+
+func newBatchWriter(w http.ResponseWriter, output string) *batchWriter {
+	bw := &batchWriter{w: w, rc: http.NewResponseController(w)}
+	if output == batchZip {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="waves.zip"`)
+		bw.zw = zip.NewWriter(w)
+		bw.names = make(map[string]bool)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.WriteHeader(http.StatusOK)
+	return bw
+}
+
+func (bw *batchWriter) write(res models.BatchResult) error {
+	_ = bw.rc.SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+	if bw.zw == nil {
+		if err := json.NewEncoder(bw.w).Encode(res); err != nil {
+			return err
+		}
+		_ = bw.rc.Flush()
+		return nil
+	}
+	if res.Error != nil {
+		bw.failed = append(bw.failed, res)
+		return nil
+	}
+	f, err := bw.zw.Create(bw.svgName(res.Filename))
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, res.SVG); err != nil {
+		return err
+	}
+	return bw.zw.Flush()
+}
+
+func (bw *batchWriter) close() error {
+	if bw.zw == nil {
+		return nil
+	}
+	_ = bw.rc.SetWriteDeadline(time.Now().Add(batchWriteTimeout))
+	if len(bw.failed) > 0 {
+		f, err := bw.zw.Create("errors.ndjson")
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		for _, res := range bw.failed {
+			if err := enc.Encode(res); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.zw.Close()
+}
+
+// svgName maps an input file name to a unique, relative .svg path in the
+// output archive.
+func (bw *batchWriter) svgName(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+	base := strings.TrimSuffix(name, path.Ext(name))
+	if base == "" {
+		base = "wave"
+	}
+	out := base + ".svg"
+	for i := 2; bw.names[out]; i++ {
+		out = fmt.Sprintf("%s-%d.svg", base, i)
+	}
+	bw.names[out] = true
+	return out
+}
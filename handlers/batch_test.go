@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+// testZip returns a zip archive with the given files.
+func testZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sendBatch(t *testing.T, api *API, key, query, contentType string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/batch"+query, bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	api.BatchHandler(rec, req)
+	return rec
+}
+
+// batchLines decodes an NDJSON batch response keyed by file name.
+func batchLines(t *testing.T, rec *httptest.ResponseRecorder) map[string]models.BatchResult {
+	t.Helper()
+	lines := make(map[string]models.BatchResult)
+	sc := bufio.NewScanner(rec.Body)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var res models.BatchResult
+		if err := json.Unmarshal(sc.Bytes(), &res); err != nil {
+			t.Fatalf("invalid line %s: %v", sc.Text(), err)
+		}
+		lines[res.Filename] = res
+	}
+	return lines
+}
+
+func TestBatchHandler_Zip(t *testing.T) {
+	api := newTestAPI(t)
+	api.BatchParallelism = 2
+	ctx := context.Background()
+	meta, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wave := testWavePNG(t).Bytes()
+	body := testZip(t, map[string][]byte{
+		"a.png":              wave,
+		"skylines/b.png":     wave,
+		"broken.png":         []byte("not an image"),
+		"__MACOSX/._a.png":   []byte("metadata"),
+		"skylines/.DS_Store": []byte("metadata"),
+	})
+
+	rec := sendBatch(t, api, key, "?svg_mode=path", "application/zip", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("got status %d (%s): %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	lines := batchLines(t, rec)
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 3: %v", len(lines), lines)
+	}
+	for _, name := range []string{"a.png", "skylines/b.png"} {
+		res := lines[name]
+		if res.Error != nil || res.WaveResponse == nil || len(res.Segments) == 0 || !strings.Contains(res.SVG, "<path") {
+			t.Errorf("%s: unexpected result %+v", name, res)
+		}
+	}
+	if res := lines["broken.png"]; res.Error == nil || res.Error.Code != models.ErrCodeInvalidImage || res.WaveResponse != nil {
+		t.Errorf("broken.png: unexpected result %+v", res)
+	}
+	if lines["a.png"].Index == lines["skylines/b.png"].Index {
+		t.Error("expected distinct indexes")
+	}
+
+	month, err := api.Store.MonthUsage(ctx, meta.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.Requests != 3 || month.Errors != 1 || month.Pixels != 2*33*10 {
+		t.Errorf("unexpected usage %+v", month)
+	}
+}
+
+func TestBatchHandler_Multipart(t *testing.T) {
+	api := newTestAPI(t)
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, name := range []string{"one.png", "two.png"} {
+		part, err := mw.CreateFormFile("images", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		part.Write(testWavePNG(t).Bytes())
+	}
+	mw.WriteField("note", "not a file")
+	mw.Close()
+
+	rec := sendBatch(t, api, key, "", mw.FormDataContentType(), body.Bytes())
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+	lines := batchLines(t, rec)
+	if len(lines) != 2 || lines["one.png"].Error != nil || lines["two.png"].Error != nil {
+		t.Errorf("unexpected results %+v", lines)
+	}
+}
+
+func TestBatchHandler_ZipOutput(t *testing.T) {
+	api := newTestAPI(t)
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wave := testWavePNG(t).Bytes()
+	body := testZip(t, map[string][]byte{
+		"a.png":      wave,
+		"a.jpg":      wave,
+		"../b.png":   wave,
+		"broken.png": []byte("not an image"),
+	})
+
+	rec := sendBatch(t, api, key, "?output=zip", "application/zip", body)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("got status %d (%s): %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+	zr, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	for _, name := range []string{"a.svg", "a-2.svg", "b.svg"} {
+		if !strings.HasPrefix(files[name], "<svg") {
+			t.Errorf("%s: expected an SVG, got %q", name, files[name])
+		}
+	}
+	if !strings.Contains(files["errors.ndjson"], `"filename":"broken.png"`) {
+		t.Errorf("expected broken.png in errors.ndjson, got %q", files["errors.ndjson"])
+	}
+	if len(files) != 4 {
+		t.Errorf("unexpected files %v", files)
+	}
+}
+
+func TestBatchHandler_Limits(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	_, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes, MonthlyQuota: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wave := testWavePNG(t).Bytes()
+	body := testZip(t, map[string][]byte{"1.png": wave, "2.png": wave, "3.png": wave})
+
+	lines := batchLines(t, sendBatch(t, api, key, "", "application/zip", body))
+	var exceeded int
+	for _, res := range lines {
+		if res.Error != nil && res.Error.Code == models.ErrCodeQuotaExceeded {
+			exceeded++
+		}
+	}
+	if len(lines) != 3 || exceeded != 1 {
+		t.Errorf("expected one image over quota, got %+v", lines)
+	}
+
+	api.Tiers[TierFree] = storage.Limit{Requests: 2, Period: time.Hour}
+	_, free, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes, Tier: TierFree})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines = batchLines(t, sendBatch(t, api, free, "", "application/zip", body))
+	var limited int
+	for _, res := range lines {
+		if res.Error != nil && res.Error.Code == models.ErrCodeRateLimited {
+			limited++
+		}
+	}
+	if len(lines) != 3 || limited != 1 {
+		t.Errorf("expected one rate-limited image, got %+v", lines)
+	}
+}
+
+func TestBatchHandler_InvalidRequests(t *testing.T) {
+	api := newTestAPI(t)
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := testZip(t, map[string][]byte{"a.png": testWavePNG(t).Bytes()})
+	tests := []struct {
+		name        string
+		key         string
+		query       string
+		contentType string
+		body        []byte
+		want        int
+	}{
+		{"missing key", "", "", "application/zip", body, http.StatusUnauthorized},
+		{"png output", key, "?format=png", "application/zip", body, http.StatusBadRequest},
+		{"unknown output", key, "?output=tar", "application/zip", body, http.StatusBadRequest},
+		{"single image", key, "", "image/png", testWavePNG(t).Bytes(), http.StatusBadRequest},
+		{"corrupt zip", key, "", "application/zip", []byte("PK not really"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := sendBatch(t, api, tt.key, tt.query, tt.contentType, tt.body); rec.Code != tt.want {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestBatchHandler_Slots(t *testing.T) {
+	api := newTestAPI(t)
+	api.MaxConcurrent = 1
+	api.BatchParallelism = 3
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("images wait for a slot", func(t *testing.T) {
+		wave := testWavePNG(t).Bytes()
+		body := testZip(t, map[string][]byte{"a.png": wave, "b.png": wave, "c.png": wave})
+		rec := sendBatch(t, api, key, "", "application/zip", body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+		}
+		for name, res := range batchLines(t, rec) {
+			if res.Error != nil {
+				t.Errorf("%s: %+v", name, res.Error)
+			}
+		}
+	})
+
+	t.Run("stalled upload holds no slot", func(t *testing.T) {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		req := httptest.NewRequest(http.MethodPost, "/v1/batch", pr)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		req.Header.Set("X-API-Key", key)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			api.BatchHandler(httptest.NewRecorder(), req)
+		}()
+		// Start the upload, then stall it
+		part, _ := mw.CreateFormFile("images", "one.png")
+		part.Write(testWavePNG(t).Bytes()[:16])
+
+		req = httptest.NewRequest(http.MethodPost, "/generate-wave", testWavePNG(t))
+		asUI(req)
+		req.Header.Set("Content-Type", "image/png")
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("got status %d while a batch upload stalled: %s", rec.Code, rec.Body.String())
+		}
+		pw.CloseWithError(io.ErrUnexpectedEOF)
+		<-done
+	})
+}
+
+func TestBatchReader(t *testing.T) {
+	var deadlines []time.Time
+	start := time.Now()
+	br := &batchReader{
+		ReadCloser:  io.NopCloser(strings.NewReader(strings.Repeat("x", 3*batchMinRate))),
+		setDeadline: func(d time.Time) error { deadlines = append(deadlines, d); return nil },
+		start:       start,
+	}
+	buf := make([]byte, batchMinRate)
+	for i := 0; i < 3; i++ {
+		if _, err := br.Read(buf); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []time.Time{
+		start.Add(batchReadGrace),
+		start.Add(batchReadGrace + time.Second),
+		start.Add(batchReadGrace + 2*time.Second),
+	}
+	if len(deadlines) != len(want) {
+		t.Fatalf("got %d deadlines, want %d", len(deadlines), len(want))
+	}
+	for i := range want {
+		if !deadlines[i].Equal(want[i]) {
+			t.Errorf("deadline %d = %v, want %v", i, deadlines[i].Sub(start), want[i].Sub(start))
+		}
+	}
+}
+
+func TestBatchWriter_SVGName(t *testing.T) {
+	bw := &batchWriter{names: make(map[string]bool)}
+	for _, tt := range []struct{ in, want string }{
+		{"a.png", "a.svg"},
+		{"a.jpeg", "a-2.svg"},
+		{"dir/b.png", "dir/b.svg"},
+		{"../../etc/c.png", "etc/c.svg"},
+		{`win\d.png`, "win/d.svg"},
+		{"", "wave.svg"},
+	} {
+		if got := bw.svgName(tt.in); got != tt.want {
+			t.Errorf("svgName(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
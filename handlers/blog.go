@@ -2,19 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
 	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/yuin/goldmark"
 )
 
-func renderPageTemplate(title string, content []byte) ([]byte, error) {
-	templatePath := filepath.Join("static", "page_template.html")
-	tpl, err := os.ReadFile(templatePath)
+// errTemplate wraps the errors of reading the page template.
+var errTemplate = errors.New("page template")
+
+func (a *API) renderPageTemplate(title string, content []byte) ([]byte, error) {
+	tpl, err := a.readAsset(staticDir, "page_template.html")
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", errTemplate, err)
 	}
 	html := string(tpl)
 	// Si el contenido no tiene <h1>, agrega uno pero con clases y estructura consistente
@@ -31,44 +34,39 @@ func renderPageTemplate(title string, content []byte) ([]byte, error) {
 	return []byte(html), nil
 }
 
-func BlogPostHandler(w http.ResponseWriter, r *http.Request) {
-	mdPath := filepath.Join("blog", "wave-generator-math-tutorial.md")
-	mdBytes, err := os.ReadFile(mdPath)
-	if err != nil {
-		http.Error(w, "Blog post not found", http.StatusNotFound)
-		return
-	}
-	var htmlBuf bytes.Buffer
-	if err := goldmark.Convert(mdBytes, &htmlBuf); err != nil {
-		http.Error(w, "Error rendering markdown", http.StatusInternalServerError)
-		return
-	}
-	page, err := renderPageTemplate("Wave Generator Blog", htmlBuf.Bytes())
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
-		return
-	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = w.Write(page)
+func (a *API) BlogPostHandler(w http.ResponseWriter, r *http.Request) {
+	a.serveMarkdownPage(w, r, blogDir, "wave-generator-math-tutorial.md", "Wave Generator Blog", "Blog post not found")
 }
 
-func APIDocsHandler(w http.ResponseWriter, r *http.Request) {
-	mdPath := filepath.Join("docs", "api-docs.md")
-	mdBytes, err := os.ReadFile(mdPath)
-	if err != nil {
-		http.Error(w, "API docs not found", http.StatusNotFound)
+func (a *API) APIDocsHandler(w http.ResponseWriter, r *http.Request) {
+	a.serveMarkdownPage(w, r, docsDir, "api-docs.md", "Wave Generator API Docs", "API docs not found")
+}
+
+// serveMarkdownPage renders the markdown file name of the asset directory
+// sub into the page template. Embedded pages are rendered once.
+func (a *API) serveMarkdownPage(w http.ResponseWriter, r *http.Request, sub, name, title, notFound string) {
+	page, err := a.loadAsset(sub+"/"+name+".html", func() ([]byte, error) {
+		mdBytes, err := a.readAsset(sub, name)
+		if err != nil {
+			return nil, err
+		}
+		var htmlBuf bytes.Buffer
+		if err := goldmark.Convert(mdBytes, &htmlBuf); err != nil {
+			return nil, err
+		}
+		return a.renderPageTemplate(title, htmlBuf.Bytes())
+	}, sub, staticDir)
+	switch {
+	case errors.Is(err, errTemplate):
+		http.Error(w, "Template error", http.StatusInternalServerError)
 		return
-	}
-	var htmlBuf bytes.Buffer
-	if err := goldmark.Convert(mdBytes, &htmlBuf); err != nil {
-		http.Error(w, "Error rendering markdown", http.StatusInternalServerError)
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, notFound, http.StatusNotFound)
 		return
-	}
-	page, err := renderPageTemplate("Wave Generator API Docs", htmlBuf.Bytes())
-	if err != nil {
-		http.Error(w, "Template error", http.StatusInternalServerError)
+	case err != nil:
+		http.Error(w, "Error rendering markdown", http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	_, _ = w.Write(page)
+	serveAsset(w, r, name+".html", page, pageMaxAge)
 }
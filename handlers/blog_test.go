@@ -49,7 +49,7 @@ func TestBlogPostHandler_OK(t *testing.T) {
 
 	req := httptest.NewRequest("GET", "/blog/wave-generator-math-tutorial", nil)
 	w := httptest.NewRecorder()
-	BlogPostHandler(w, req)
+	newTestAPI(t).BlogPostHandler(w, req)
 
 	resp := w.Result()
 	defer func() { _ = resp.Body.Close() }()
@@ -71,7 +71,7 @@ func TestBlogPostHandler_NotFound(t *testing.T) {
 
 	req := httptest.NewRequest("GET", "/blog/wave-generator-math-tutorial", nil)
 	w := httptest.NewRecorder()
-	BlogPostHandler(w, req)
+	newTestAPI(t).BlogPostHandler(w, req)
 
 	resp := w.Result()
 	defer func() { _ = resp.Body.Close() }()
@@ -107,7 +107,7 @@ func TestAPIDocsHandler_OK(t *testing.T) {
 
 	req := httptest.NewRequest("GET", "/docs/api-docs", nil)
 	w := httptest.NewRecorder()
-	APIDocsHandler(w, req)
+	newTestAPI(t).APIDocsHandler(w, req)
 
 	resp := w.Result()
 	defer func() { _ = resp.Body.Close() }()
@@ -126,7 +126,7 @@ func TestAPIDocsHandler_NotFound(t *testing.T) {
 
 	req := httptest.NewRequest("GET", "/docs/api-docs", nil)
 	w := httptest.NewRecorder()
-	APIDocsHandler(w, req)
+	newTestAPI(t).APIDocsHandler(w, req)
 
 	resp := w.Result()
 	defer func() { _ = resp.Body.Close() }()
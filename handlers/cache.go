@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"wave-generator/config"
+	"wave-generator/services"
+	"wave-generator/storage"
+)
+
+// cacheVersion is part of every result key. Bump it when a change to the
+// pipeline alters its output, so older cached results are not served.
+const cacheVersion = "1"
+
+// resultKey is the content address of a /generate-wave result: the
+// SHA-256 of the image bytes and the canonical hash of the options.
+func resultKey(image []byte, opts services.Options) (string, error) {
+	hash, err := opts.Hash()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(image)
+	return "wave:" + cacheVersion + ":" + hex.EncodeToString(sum[:]) + ":" + hash, nil
+}
+
+// resultETag derives the strong ETag of a result from its key. Results
+// are deterministic, so equal keys mean equal bytes.
+func resultETag(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatch reports whether an If-None-Match header lists etag. Weak
+// validators match too, as If-None-Match uses the weak comparison. "*"
+// does not: on a POST it never means 304 Not Modified (RFC 9110 13.1.2),
+// and the uploaded image, not a stored resource, is what the ETag names.
+func etagMatch(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// cachedResult looks a result up in the cache. Cache failures are logged
+// and treated as misses.
+func (a *API) cachedResult(ctx context.Context, key string) ([]byte, bool) {
+	if a.Cache == nil {
+		return nil, false
+	}
+	body, err := a.Cache.GetCached(ctx, key)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			slog.WarnContext(ctx, "reading cached result", "err", err)
+		}
+		return nil, false
+	}
+	return body, true
+}
+
+func (a *API) cacheResult(ctx context.Context, key string, body []byte) {
+	if a.Cache == nil {
+		return
+	}
+	if err := a.Cache.SetCached(ctx, key, body, a.CacheTTL); err != nil {
+		slog.WarnContext(ctx, "caching result", "err", err)
+	}
+}
+
+// newCache opens the result cache selected by cfg. An unknown backend is
+// logged and replaced by the memory cache.
+func newCache(cfg config.Cache, store storage.Store) storage.Cache {
+	c, err := storage.NewCache(cfg.Backend, store, cfg.MaxBytes)
+	if err != nil {
+		slog.Warn("using the memory cache", "err", err)
+		return storage.NewLRU(cfg.MaxBytes)
+	}
+	return c
+}
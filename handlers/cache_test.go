@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/models"
+	"wave-generator/services"
+	"wave-generator/storage"
+)
+
+func TestResultKey(t *testing.T) {
+	resultKey := func(image []byte, opts services.Options) string {
+		t.Helper()
+		key, err := resultKey(image, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	opts := services.Options{Style: services.DefaultSVGStyle()}
+	key := resultKey([]byte("image"), opts)
+	if key != resultKey([]byte("image"), opts) {
+		t.Error("expected equal inputs to share a key")
+	}
+	if key == resultKey([]byte("other"), opts) {
+		t.Error("expected different images to have different keys")
+	}
+	opts.PNG = true
+	if key == resultKey([]byte("image"), opts) {
+		t.Error("expected different options to have different keys")
+	}
+}
+
+func TestEtagMatch(t *testing.T) {
+	const etag = `"abc"`
+	for header, want := range map[string]bool{
+		"":               false,
+		`"abc"`:          true,
+		`W/"abc"`:        true,
+		`"x", "abc"`:     true,
+		`*`:              false,
+		`"abcd"`:         false,
+		`abc`:            false,
+		`"x" , W/"abc" `: true,
+	} {
+		if got := etagMatch(header, etag); got != want {
+			t.Errorf("etagMatch(%q) = %v, want %v", header, got, want)
+		}
+	}
+}
+
+func TestWavePatternHandler_Cache(t *testing.T) {
+	api := newTestAPI(t)
+	cache := storage.NewLRU(1 << 20)
+	api.Cache, api.CacheTTL = cache, time.Hour
+	ctx := context.Background()
+	meta, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wave := testWavePNG(t).Bytes()
+	send := func(query, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave"+query, bytes.NewReader(wave))
+		req.Header.Set("X-API-Key", key)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+		return rec
+	}
+
+	first := send("", "")
+	if first.Code != http.StatusOK || first.Header().Get("X-Cache") != "MISS" || first.Header().Get("ETag") == "" {
+		t.Fatalf("first request: status %d, headers %v", first.Code, first.Header())
+	}
+	second := send("", "")
+	if second.Header().Get("X-Cache") != "HIT" || second.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("second request: headers %v", second.Header())
+	}
+	if !bytes.Equal(first.Body.Bytes(), second.Body.Bytes()) || first.Header().Get("ETag") != second.Header().Get("ETag") {
+		t.Error("expected the cached response to match the original")
+	}
+
+	png := send("?format=png", "")
+	if png.Header().Get("X-Cache") != "MISS" || png.Header().Get("ETag") == first.Header().Get("ETag") {
+		t.Errorf("other options: headers %v", png.Header())
+	}
+	if png = send("?format=png", ""); png.Header().Get("X-Cache") != "HIT" || png.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("cached PNG: headers %v", png.Header())
+	}
+	if cache.Len() != 2 {
+		t.Errorf("got %d cached results, want 2", cache.Len())
+	}
+
+	notModified := send("", first.Header().Get("ETag"))
+	if notModified.Code != http.StatusNotModified || notModified.Body.Len() != 0 || notModified.Header().Get("ETag") != first.Header().Get("ETag") {
+		t.Errorf("If-None-Match: status %d, body %q", notModified.Code, notModified.Body.String())
+	}
+
+	month, err := api.Store.MonthUsage(ctx, meta.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.Requests != 5 || month.Errors != 0 || month.Pixels != 5*33*10 {
+		t.Errorf("expected cached responses to be metered, got %+v", month)
+	}
+}
+
+func TestWavePatternHandler_NoCache(t *testing.T) {
+	api := newTestAPI(t)
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave", testWavePNG(t))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" {
+			t.Errorf("request %d: status %d, X-Cache %q", i, rec.Code, rec.Header().Get("X-Cache"))
+		}
+	}
+}
+
+func TestWavePatternHandler_IfNoneMatchAny(t *testing.T) {
+	api := newTestAPI(t)
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave", strings.NewReader("not an image"))
+	asUI(req)
+	req.Header.Set("If-None-Match", "*")
+	rec := httptest.NewRecorder()
+	api.WavePatternHandler(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("got status %d, want the image to be decoded and rejected", rec.Code)
+	}
+}
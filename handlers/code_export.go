@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"wave-generator/models"
+	"wave-generator/services"
+)
+
+// ExportCodeHandler converts previously fitted segments into source code.
+// It accepts a POST with a JSON body holding the segments (the response of
+// /generate-wave can be sent back as is) and the target language in the
+// lang query parameter, and responds with the generated code as plain text.
+func ExportCodeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost, "Use POST with segments JSON in body")
+		return
+	}
+	var payload models.ResponsePayload
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&payload); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Error decoding segments: "+err.Error())
+		return
+	}
+	code, err := services.ExportCode(payload.Segments, r.URL.Query().Get("lang"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write([]byte(code))
+}
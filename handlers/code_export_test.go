@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExportCodeHandler(t *testing.T) {
+	body := `{"segments":[{"domain_start":0,"domain_end":15,"a3":0,"a2":0,"a1":1,"a0":2}]}`
+
+	tests := []struct {
+		name       string
+		method     string
+		target     string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"javascript", http.MethodPost, "/export-code?lang=js", body, http.StatusOK, "export function wave(x)"},
+		{"latex", http.MethodPost, "/export-code?lang=latex", body, http.StatusOK, `\begin{cases}`},
+		{"unknown language", http.MethodPost, "/export-code?lang=cobol", body, http.StatusBadRequest, "unsupported"},
+		{"no segments", http.MethodPost, "/export-code?lang=go", `{"segments":[]}`, http.StatusBadRequest, "no segments"},
+		{"invalid json", http.MethodPost, "/export-code?lang=go", "{", http.StatusBadRequest, "Error decoding"},
+		{"wrong method", http.MethodGet, "/export-code?lang=go", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+			rec := httptest.NewRecorder()
+			ExportCodeHandler(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
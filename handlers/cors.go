@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"wave-generator/models"
+)
+
+// corsMaxAge is how long browsers may cache a preflight response.
+const corsMaxAge = 10 * time.Minute
+
+// corsHeaders are the request headers cross-origin API calls may send.
+var corsHeaders = []string{"Content-Type", "X-API-Key", RequestIDHeader, "If-None-Match", CSRFHeader}
+
+// corsExposed are the response headers cross-origin callers may read.
+var corsExposed = []string{
+	RequestIDHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "RateLimit-Policy",
+	"Retry-After", "ETag", "X-Cache", "Location", "Deprecation", "Link",
+}
+
+// CORSPolicy is the cross-origin policy of a route. Requests from other
+// origins get CORS headers only when their origin is allowed, and
+// preflight requests are validated against Methods and Headers.
+type CORSPolicy struct {
+	// Origins may call the route without credentials; "*" allows any
+	// origin.
+	Origins []string
+	// CredentialOrigins may also send cookies, i.e. use UI sessions.
+	CredentialOrigins []string
+	Methods           []string
+	Headers           []string
+	ExposeHeaders     []string
+	MaxAge            time.Duration
+}
+
+// PublicCORS is the policy of the API routes: clients authenticating with
+// an API key from CORSOrigins, and the UI from TrustedOrigins.
+func (a *API) PublicCORS(methods ...string) *CORSPolicy {
+	return &CORSPolicy{
+		Origins:           a.CORSOrigins,
+		CredentialOrigins: a.TrustedOrigins,
+		Methods:           methods,
+		Headers:           corsHeaders,
+		ExposeHeaders:     corsExposed,
+		MaxAge:            corsMaxAge,
+	}
+}
+
+// SessionCORS is the policy of the routes only the UI may call from
+// another origin, such as self-service key creation.
+func (a *API) SessionCORS(methods ...string) *CORSPolicy {
+	p := a.PublicCORS(methods...)
+	p.Origins = nil
+	return p
+}
+
+// allow reports whether origin may call the route, and whether with
+// credentials.
+func (p *CORSPolicy) allow(origin string) (allowed, credentials bool) {
+	origin = strings.ToLower(origin)
+	if slices.Contains(p.CredentialOrigins, origin) {
+		return true, true
+	}
+	return slices.Contains(p.Origins, "*") || slices.Contains(p.Origins, origin), false
+}
+
+// Handler applies the policy to next. Preflight requests are answered
+// without calling next: 204 when the origin, method and headers are
+// allowed, 403 otherwise.
+func (p *CORSPolicy) Handler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next(w, r)
+			return
+		}
+		allowed, credentials := p.allow(origin)
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			p.preflight(w, r, allowed, credentials)
+			return
+		}
+		if allowed {
+			p.allowOrigin(h, origin, credentials)
+			if len(p.ExposeHeaders) > 0 {
+				h.Set("Access-Control-Expose-Headers", strings.Join(p.ExposeHeaders, ", "))
+			}
+		}
+		next(w, r)
+	}
+}
+
+func (p *CORSPolicy) preflight(w http.ResponseWriter, r *http.Request, allowed, credentials bool) {
+	h := w.Header()
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if !allowed {
+		writeError(w, r, http.StatusForbidden, models.ErrCodeCORSRejected, "Origin not allowed")
+		return
+	}
+	if method := r.Header.Get("Access-Control-Request-Method"); !slices.Contains(p.Methods, method) {
+		writeErrorDetails(w, r, http.StatusForbidden, models.ErrCodeCORSRejected, "Method not allowed: "+method,
+			map[string]any{"allowed": p.Methods})
+		return
+	}
+	for _, name := range strings.Split(r.Header.Get("Access-Control-Request-Headers"), ",") {
+		name = strings.TrimSpace(name)
+		if name != "" && !slices.ContainsFunc(p.Headers, func(allowed string) bool { return strings.EqualFold(allowed, name) }) {
+			writeErrorDetails(w, r, http.StatusForbidden, models.ErrCodeCORSRejected, "Header not allowed: "+name,
+				map[string]any{"allowed": p.Headers})
+			return
+		}
+	}
+	p.allowOrigin(h, r.Header.Get("Origin"), credentials)
+	h.Set("Access-Control-Allow-Methods", strings.Join(p.Methods, ", "))
+	h.Set("Access-Control-Allow-Headers", strings.Join(p.Headers, ", "))
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *CORSPolicy) allowOrigin(h http.Header, origin string, credentials bool) {
+	h.Set("Access-Control-Allow-Origin", origin)
+	if credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"wave-generator/models"
+)
+
+func corsRequest(method, origin string, header map[string]string) *http.Request {
+	req := httptest.NewRequest(method, "/v1/jobs", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestCORSPolicy(t *testing.T) {
+	api := newTestAPI(t)
+	api.CORSOrigins = []string{"https://app.example.org"}
+	api.TrustedOrigins = []string{"https://ui.example.org"}
+	policy := api.PublicCORS(http.MethodPost)
+	called := 0
+	h := policy.Handler(func(w http.ResponseWriter, r *http.Request) { called++ })
+
+	for _, tc := range []struct {
+		origin, allow, credentials string
+	}{
+		{"", "", ""},
+		{"https://app.example.org", "https://app.example.org", ""},
+		{"HTTPS://UI.example.org", "HTTPS://UI.example.org", "true"},
+		{"https://evil.example.com", "", ""},
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, corsRequest(http.MethodPost, tc.origin, nil))
+		got := rec.Header()
+		if got.Get("Access-Control-Allow-Origin") != tc.allow || got.Get("Access-Control-Allow-Credentials") != tc.credentials {
+			t.Errorf("origin %q: got allow %q, credentials %q", tc.origin, got.Get("Access-Control-Allow-Origin"), got.Get("Access-Control-Allow-Credentials"))
+		}
+		if got.Get("Vary") != "Origin" {
+			t.Errorf("origin %q: got Vary %q", tc.origin, got.Values("Vary"))
+		}
+		if exposed := got.Get("Access-Control-Expose-Headers"); (tc.allow != "") != strings.Contains(exposed, RequestIDHeader) {
+			t.Errorf("origin %q: got exposed headers %q", tc.origin, exposed)
+		}
+	}
+	if called != 4 {
+		t.Errorf("got %d calls, want requests from every origin to be served", called)
+	}
+
+	api.CORSOrigins = []string{"*"}
+	rec := httptest.NewRecorder()
+	api.PublicCORS(http.MethodPost).Handler(func(http.ResponseWriter, *http.Request) {})(rec, corsRequest(http.MethodPost, "https://any.example.net", nil))
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://any.example.net" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("got %v, want any origin allowed without credentials", rec.Header())
+	}
+	if allowed, _ := api.SessionCORS(http.MethodPost).allow("https://any.example.net"); allowed {
+		t.Error("expected the session policy to only allow trusted origins")
+	}
+}
+
+func TestCORSPolicy_Preflight(t *testing.T) {
+	api := newTestAPI(t)
+	api.CORSOrigins = []string{"https://app.example.org"}
+	policy := api.PublicCORS(http.MethodGet, http.MethodDelete)
+	h := policy.Handler(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("preflight requests must not reach the handler")
+	})
+
+	rec := httptest.NewRecorder()
+	h(rec, corsRequest(http.MethodOptions, "https://app.example.org", map[string]string{
+		"Access-Control-Request-Method":  http.MethodDelete,
+		"Access-Control-Request-Headers": "x-api-key, content-type",
+	}))
+	got := rec.Header()
+	if rec.Code != http.StatusNoContent || got.Get("Access-Control-Allow-Origin") != "https://app.example.org" {
+		t.Fatalf("got %d %v", rec.Code, got)
+	}
+	if got.Get("Access-Control-Allow-Methods") != "GET, DELETE" || !strings.Contains(got.Get("Access-Control-Allow-Headers"), "X-API-Key") || got.Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("got %v", got)
+	}
+	if vary := strings.Join(got.Values("Vary"), ", "); vary != "Origin, Access-Control-Request-Method, Access-Control-Request-Headers" {
+		t.Errorf("got Vary %q", vary)
+	}
+
+	for name, req := range map[string]*http.Request{
+		"origin": corsRequest(http.MethodOptions, "https://evil.example.com", map[string]string{"Access-Control-Request-Method": http.MethodGet}),
+		"method": corsRequest(http.MethodOptions, "https://app.example.org", map[string]string{"Access-Control-Request-Method": http.MethodPut}),
+		"header": corsRequest(http.MethodOptions, "https://app.example.org", map[string]string{
+			"Access-Control-Request-Method":  http.MethodGet,
+			"Access-Control-Request-Headers": "X-API-Key, Authorization",
+		}),
+	} {
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s: got %d %v", name, rec.Code, rec.Header())
+		}
+		if e := decodeError(t, rec); e.Code != models.ErrCodeCORSRejected {
+			t.Errorf("%s: got code %q", name, e.Code)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"net/http"
+	"wave-generator/models"
+)
+
+// CSRFHeader carries the CSRF token of state-changing requests made by
+// the bundled UI.
+const CSRFHeader = "X-CSRF-Token"
+
+// csrfCookieName holds the CSRF token for the UI's script to read; unlike
+// the session cookie it is not HttpOnly.
+const csrfCookieName = "wave_csrf"
+
+// csrfToken derives the CSRF token of a session from its cookie value, so
+// tokens need no storage and change with every session.
+func (a *API) csrfToken(session string) string {
+	return a.signSession("csrf." + session)
+}
+
+// newCSRFCookie returns the cookie handing the token of session to the UI.
+func (a *API) newCSRFCookie(session *http.Cookie) *http.Cookie {
+	return &http.Cookie{
+		Name:     csrfCookieName,
+		Value:    a.csrfToken(session.Value),
+		Path:     "/",
+		Expires:  session.Expires,
+		Secure:   session.Secure,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// validCSRF reports whether the request sends the CSRF token of its
+// session cookie in CSRFHeader.
+func (a *API) validCSRF(r *http.Request) bool {
+	c, err := r.Cookie(sessionCookieName)
+	token := r.Header.Get(CSRFHeader)
+	return err == nil && token != "" && hmac.Equal([]byte(token), []byte(a.csrfToken(c.Value)))
+}
+
+// safeMethod reports whether method does not change state.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// browserRequest reports whether a browser sent the request on behalf of
+// a page: browsers set Origin on cross-origin and POST requests, and
+// Sec-Fetch-Site on every request, "none" meaning the user typed the URL.
+func browserRequest(r *http.Request) bool {
+	site := r.Header.Get("Sec-Fetch-Site")
+	return r.Header.Get("Origin") != "" || (site != "" && site != "none")
+}
+
+// checkCSRF rejects state-changing browser requests without a valid
+// session and CSRF token, writing the error response. Other clients, such
+// as scripts calling the API directly, are not affected.
+func (a *API) checkCSRF(w http.ResponseWriter, r *http.Request) bool {
+	if safeMethod(r.Method) || !browserRequest(r) || a.validCSRF(r) {
+		return true
+	}
+	writeError(w, r, http.StatusForbidden, models.ErrCodeCSRFRejected, "Missing or invalid CSRF token")
+	return false
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestValidCSRF(t *testing.T) {
+	api := newTestAPI(t)
+	session := api.newSessionCookie(time.Now(), false)
+	other := api.newSessionCookie(time.Now(), false)
+
+	for name, tc := range map[string]struct {
+		session *http.Cookie
+		token   string
+		want    bool
+	}{
+		"matching token":      {session, api.csrfToken(session.Value), true},
+		"no token":            {session, "", false},
+		"token of another":    {session, api.csrfToken(other.Value), false},
+		"token of no session": {nil, api.csrfToken(""), false},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/generate-apikey", nil)
+		if tc.session != nil {
+			req.AddCookie(tc.session)
+		}
+		if tc.token != "" {
+			req.Header.Set(CSRFHeader, tc.token)
+		}
+		if got := api.validCSRF(req); got != tc.want {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+	}
+}
+
+func TestCheckCSRF(t *testing.T) {
+	api := newTestAPI(t)
+
+	for name, tc := range map[string]struct {
+		method string
+		header map[string]string
+		want   bool
+	}{
+		"script":            {http.MethodPost, nil, true},
+		"typed url":         {http.MethodPost, map[string]string{"Sec-Fetch-Site": "none"}, true},
+		"safe method":       {http.MethodGet, map[string]string{"Origin": "https://evil.example.net"}, true},
+		"cross-site form":   {http.MethodPost, map[string]string{"Origin": "https://evil.example.net"}, false},
+		"same-site request": {http.MethodPost, map[string]string{"Sec-Fetch-Site": "same-origin"}, false},
+	} {
+		req := httptest.NewRequest(tc.method, "/generate-apikey", nil)
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		if got := api.checkCSRF(rec, req); got != tc.want {
+			t.Errorf("%s: got %v, want %v", name, got, tc.want)
+		}
+		if !tc.want && rec.Code != http.StatusForbidden {
+			t.Errorf("%s: got status %d, want 403", name, rec.Code)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"wave-generator/models"
+)
+
+// writeError responds with the JSON error envelope
+// {"error": {"code", "message", "details", "request_id"}}.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	writeErrorDetails(w, r, status, code, message, nil)
+}
+
+// writeErrorDetails is writeError with machine-readable details, e.g. the
+// seconds to wait before retrying.
+func writeErrorDetails(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, status, models.ErrorResponse{Error: models.APIError{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: RequestID(r.Context()),
+	}})
+}
+
+// methodNotAllowed responds 405 listing the allowed method.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request, allowed, message string) {
+	w.Header().Set("Allow", allowed)
+	writeErrorDetails(w, r, http.StatusMethodNotAllowed, models.ErrCodeMethodNotAllowed, message,
+		map[string]any{"allowed": []string{allowed}})
+}
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wave-generator/models"
+)
+
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) models.APIError {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("got Content-Type %q, want application/json", ct)
+	}
+	var body models.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatalf("failed to decode error body: %v", err)
+	}
+	return body.Error
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WithRequestID(func(w http.ResponseWriter, r *http.Request) {
+		writeErrorDetails(w, r, http.StatusTooManyRequests, models.ErrCodeRateLimited, "slow down", map[string]any{"retry_after": 3})
+	})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429", rec.Code)
+	}
+	e := decodeError(t, rec)
+	if e.Code != models.ErrCodeRateLimited || e.Message != "slow down" || e.Details["retry_after"] != float64(3) {
+		t.Errorf("unexpected error %+v", e)
+	}
+	if e.RequestID == "" || e.RequestID != rec.Header().Get(RequestIDHeader) {
+		t.Errorf("expected the request ID %q in the body, got %q", rec.Header().Get(RequestIDHeader), e.RequestID)
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	api := newTestAPI(t)
+	rec := httptest.NewRecorder()
+	api.WavePatternHandler(rec, httptest.NewRequest(http.MethodGet, "/v1/generate-wave", nil))
+
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != http.MethodPost {
+		t.Errorf("got status %d and Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	if e := decodeError(t, rec); e.Code != models.ErrCodeMethodNotAllowed {
+		t.Errorf("got code %q", e.Code)
+	}
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"io/fs"
+	"net/http"
+	"strings"
+	"time"
+	"wave-generator/models"
+)
+
+// readyTimeout bounds the store check of /readyz, so a hung Redis fails
+// the probe instead of timing it out.
+const readyTimeout = 2 * time.Second
+
+// HealthzHandler is the liveness probe: it answers 200 as long as the
+// process serves requests, without checking its dependencies.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, models.HealthResponse{Status: models.HealthOK})
+}
+
+// ReadyzHandler is the readiness probe. It checks the key store, the page
+// assets, the job queue and the processing slots, and answers 503 with
+// the per-check results when any of them fails.
+func (a *API) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readyTimeout)
+	defer cancel()
+
+	res := models.HealthResponse{
+		Status: models.HealthOK,
+		Checks: map[string]models.HealthCheck{
+			"store":      a.checkStore(ctx),
+			"assets":     a.checkAssets(),
+			"processing": a.checkProcessing(),
+		},
+	}
+	if a.Jobs != nil {
+		res.Checks["jobs"] = a.checkJobs()
+	}
+	status := http.StatusOK
+	for _, c := range res.Checks {
+		if c.Status != models.HealthOK {
+			res.Status = models.HealthFail
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, res)
+}
+
+// checkStore pings the key and rate-limit store.
+func (a *API) checkStore(ctx context.Context) models.HealthCheck {
+	if a.Store == nil {
+		return failed("no store configured", nil)
+	}
+	if err := a.Store.Ping(ctx); err != nil {
+		return failed(err.Error(), nil)
+	}
+	return models.HealthCheck{Status: models.HealthOK}
+}
+
+// checkAssets checks that the page assets can be read.
+func (a *API) checkAssets() models.HealthCheck {
+	var missing []string
+	for _, path := range pageAssets {
+		sub, name, _ := strings.Cut(path, "/")
+		if _, err := fs.Stat(a.assetFS(sub), name); err != nil {
+			missing = append(missing, path)
+		}
+	}
+	if len(missing) > 0 {
+		return failed("missing assets", map[string]any{"missing": missing})
+	}
+	return models.HealthCheck{Status: models.HealthOK}
+}
+
+// checkJobs fails once the job manager stops accepting jobs or its queue
+// is full.
+func (a *API) checkJobs() models.HealthCheck {
+	s := a.Jobs.Stats()
+	details := map[string]any{
+		"workers":    s.Workers,
+		"running":    s.Running,
+		"queued":     s.Queued,
+		"queue_size": s.QueueSize,
+	}
+	switch {
+	case s.Closed:
+		return failed("shutting down", details)
+	case s.Queued >= s.QueueSize:
+		return failed("job queue is full", details)
+	}
+	return models.HealthCheck{Status: models.HealthOK, Details: details}
+}
+
+// checkProcessing fails while every MaxConcurrent slot is taken, when
+// /generate-wave and /batch answer 503.
+func (a *API) checkProcessing() models.HealthCheck {
+	slots := a.processingSlots()
+	if slots == nil {
+		return models.HealthCheck{Status: models.HealthOK}
+	}
+	details := map[string]any{"in_use": len(slots), "limit": cap(slots)}
+	if len(slots) >= cap(slots) {
+		return failed("all processing slots are busy", details)
+	}
+	return models.HealthCheck{Status: models.HealthOK, Details: details}
+}
+
+func failed(reason string, details map[string]any) models.HealthCheck {
+	return models.HealthCheck{Status: models.HealthFail, Error: reason, Details: details}
+}
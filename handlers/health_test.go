@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+// downStore is a store whose backend is unreachable.
+type downStore struct {
+	storage.Store
+}
+
+func (downStore) Ping(context.Context) error { return errors.New("connection refused") }
+
+func (downStore) GetKey(context.Context, string) (models.APIKey, error) {
+	return models.APIKey{}, errors.New("connection refused")
+}
+
+// inAssetsDir runs the test in a directory holding the page assets.
+func inAssetsDir(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, path := range pageAssets {
+		createTempMarkdown(t, filepath.Join(dir, path), "test")
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+}
+
+func readyz(t *testing.T, api *API) (int, models.HealthResponse) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	api.ReadyzHandler(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var res models.HealthResponse
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, res
+}
+
+func TestHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	HealthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("got %d, Cache-Control %q", rec.Code, rec.Header().Get("Cache-Control"))
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	api := newTestAPI(t)
+	inAssetsDir(t)
+	api.MaxConcurrent = 1
+
+	code, res := readyz(t, api)
+	if code != http.StatusOK || res.Status != models.HealthOK {
+		t.Fatalf("got %d %+v", code, res)
+	}
+	for _, name := range []string{"store", "assets", "jobs", "processing"} {
+		if res.Checks[name].Status != models.HealthOK {
+			t.Errorf("check %s: got %+v", name, res.Checks[name])
+		}
+	}
+
+	release, _ := api.acquire(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/", nil))
+	code, res = readyz(t, api)
+	if code != http.StatusServiceUnavailable || res.Checks["processing"].Status != models.HealthFail {
+		t.Errorf("got %d %+v, want busy processing to fail", code, res.Checks["processing"])
+	}
+	release()
+
+	api.Close()
+	if _, res = readyz(t, api); res.Checks["jobs"].Error != "shutting down" {
+		t.Errorf("got %+v, want a closed job manager to fail", res.Checks["jobs"])
+	}
+}
+
+func TestReadyzHandler_Failures(t *testing.T) {
+	api := newTestAPI(t)
+	api.Store = downStore{}
+
+	code, res := readyz(t, api)
+	if code != http.StatusServiceUnavailable || res.Status != models.HealthFail {
+		t.Fatalf("got %d %+v", code, res)
+	}
+	if c := res.Checks["store"]; c.Status != models.HealthFail || c.Error != "connection refused" {
+		t.Errorf("store: got %+v", c)
+	}
+	// the tests run without the page assets
+	if c := res.Checks["assets"]; c.Status != models.HealthFail || len(c.Details["missing"].([]any)) != len(pageAssets) {
+		t.Errorf("assets: got %+v", c)
+	}
+	if res.Checks["jobs"].Status != models.HealthOK {
+		t.Errorf("jobs: got %+v", res.Checks["jobs"])
+	}
+}
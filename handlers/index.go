@@ -1,23 +1,36 @@
 package handlers
 
 import (
+	"errors"
+	"io/fs"
 	"net/http"
-	"os"
-	"path/filepath"
+	"time"
 )
 
-func IndexHandler(w http.ResponseWriter, r *http.Request) {
+// IndexHandler serves the UI with a new session. The page is revalidated
+// on every load, as each response carries its own session cookie.
+func (a *API) IndexHandler(w http.ResponseWriter, r *http.Request) {
 	if r.URL.Path != "/" {
 		http.NotFound(w, r)
 		return
 	}
 
-	indexPath := filepath.Join("static", "index.html")
-	if _, err := os.Stat(indexPath); os.IsNotExist(err) {
+	page, err := a.loadAsset(staticDir+"/index.html", func() ([]byte, error) { return a.readAsset(staticDir, "index.html") }, staticDir)
+	if errors.Is(err, fs.ErrNotExist) {
 		http.Error(w, "index.html not found", http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		http.Error(w, "Error reading index.html", http.StatusInternalServerError)
+		return
+	}
 
+	// The session cookie lets the UI call the API without an API key; its
+	// script sends the token of the CSRF cookie along.
+	session := a.newSessionCookie(time.Now(), r.TLS != nil)
+	http.SetCookie(w, session)
+	http.SetCookie(w, a.newCSRFCookie(session))
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	http.ServeFile(w, r, indexPath)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	serveAsset(w, r, "index.html", page, 0)
 }
@@ -6,9 +6,12 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestIndexHandler(t *testing.T) {
+	api := newTestAPI(t)
+
 	// Create temporary test directory structure
 	tmpDir := filepath.Join(os.TempDir(), "wave-generator-test")
 	staticDir := filepath.Join(tmpDir, "static")
@@ -41,7 +44,7 @@ func TestIndexHandler(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		rec := httptest.NewRecorder()
 
-		IndexHandler(rec, req)
+		api.IndexHandler(rec, req)
 
 		if rec.Code != http.StatusOK {
 			t.Errorf("expected status 200, got %d", rec.Code)
@@ -50,6 +53,23 @@ func TestIndexHandler(t *testing.T) {
 		if contentType := rec.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
 			t.Errorf("expected Content-Type 'text/html; charset=utf-8', got '%s'", contentType)
 		}
+
+		// The page must hand out a UI session so it can call the API
+		next := httptest.NewRequest(http.MethodPost, "/generate-wave", nil)
+		for _, c := range rec.Result().Cookies() {
+			next.AddCookie(c)
+		}
+		if !api.validSession(next, time.Now()) {
+			t.Error("expected a valid session cookie")
+		}
+		csrf, err := next.Cookie(csrfCookieName)
+		if err != nil {
+			t.Fatal("expected a CSRF cookie")
+		}
+		next.Header.Set(CSRFHeader, csrf.Value)
+		if csrf.HttpOnly || !api.validCSRF(next) {
+			t.Errorf("expected the page to be able to send the CSRF token, got %+v", csrf)
+		}
 	})
 
 	// Test missing file
@@ -61,7 +81,7 @@ func TestIndexHandler(t *testing.T) {
 
 		req := httptest.NewRequest(http.MethodGet, "/", nil)
 		rec := httptest.NewRecorder()
-		IndexHandler(rec, req)
+		api.IndexHandler(rec, req)
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("expected status 404, got %d", rec.Code)
 		}
@@ -71,7 +91,7 @@ func TestIndexHandler(t *testing.T) {
 	t.Run("invalid path", func(t *testing.T) {
 		req := httptest.NewRequest(http.MethodGet, "/invalid", nil)
 		rec := httptest.NewRecorder()
-		IndexHandler(rec, req)
+		api.IndexHandler(rec, req)
 		if rec.Code != http.StatusNotFound {
 			t.Errorf("expected status 404, got %d", rec.Code)
 		}
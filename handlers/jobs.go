@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"wave-generator/jobs"
+	"wave-generator/models"
+	"wave-generator/services"
+)
+
+// queueRetryAfter is suggested to clients when the job queue is full.
+const queueRetryAfter = 5 * time.Second
+
+// CreateJobHandler queues an image for asynchronous processing and answers
+// 202 Accepted with the job and its Location. It takes the query
+// parameters of WavePatternHandler except format=png, plus webhook_url:
+// an http(s) URL of a public host the job is POSTed to once it finishes.
+// Jobs require an API key; submitting counts towards its quota and rate
+// limit and the job is metered when it runs.
+//
+// Responds with 400 for invalid parameters or an undecodable image, 413
+// when the image is larger than MaxUploadBytes and 503 when the queue is
+// full.
+func (a *API) CreateJobHandler(w http.ResponseWriter, r *http.Request) {
+	key, ok := a.admitKey(w, r, models.ScopeGenerate)
+	if !ok {
+		return
+	}
+	opts, err := a.processOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	if opts.PNG {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Jobs return JSON; format=png is not supported")
+		return
+	}
+	webhook, err := parseWebhookURL(r.URL.Query().Get("webhook_url"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+
+	// Queued jobs keep their upload in memory until a worker takes them.
+	body, ok := a.readUpload(w, r)
+	if !ok {
+		return
+	}
+	// Only the header is checked here; the image is decoded by the worker.
+	if _, _, err := image.DecodeConfig(bytes.NewReader(body)); err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidImage, "Error decoding image: "+err.Error())
+		return
+	}
+
+	job, err := a.Jobs.Submit(key.ID, webhook, a.processJob(key.ID, body, opts))
+	if errors.Is(err, jobs.ErrQueueFull) {
+		w.Header().Set("Retry-After", seconds(queueRetryAfter))
+		writeError(w, r, http.StatusServiceUnavailable, models.ErrCodeQueueFull, "Job queue is full, retry later")
+		return
+	}
+	if errors.Is(err, jobs.ErrWebhookBlocked) {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "webhook_url must address a public host")
+		return
+	}
+	if errors.Is(err, jobs.ErrClosed) {
+		writeError(w, r, http.StatusServiceUnavailable, models.ErrCodeUnavailable, "Server shutting down, retry later")
+		return
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not queue job")
+		return
+	}
+	w.Header().Set("Location", strings.TrimSuffix(r.URL.Path, "/")+"/"+job.ID)
+	writeJSON(w, http.StatusAccepted, job)
+}
+
+// processJob returns the work of a job: decoding the uploaded image and
+// running the pipeline, metered like a synchronous request.
+func (a *API) processJob(keyID string, body []byte, opts services.Options) jobs.Func {
+	return func(ctx context.Context) (*models.WaveResponse, error) {
+		start := time.Now()
+		status := http.StatusOK
+		var pixels int64
+		defer func() { a.recordUsage(keyID, start, status, pixels) }()
+
+		img, _, err := image.Decode(bytes.NewReader(body))
+		if err != nil {
+			status = http.StatusBadRequest
+			return nil, &models.APIError{Code: models.ErrCodeInvalidImage, Message: "Error decoding image: " + err.Error()}
+		}
+		pixels = imagePixels(img)
+		// Jobs run outside of a request, so they observe their own stages.
+		timings := &services.Timings{}
+		defer observeStages(timings)
+		res, err := services.Process(services.WithTimings(ctx, timings), img, opts)
+		if err != nil {
+			status, _ = a.processingError(err)
+			return nil, err
+		}
+		observeImage(pixels, res)
+		return &res.WaveResponse, nil
+	}
+}
+
+// parseWebhookURL validates the optional webhook_url parameter.
+func parseWebhookURL(raw string) (string, error) {
+	if raw == "" {
+		return "", nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid webhook_url %q: must be an absolute http(s) URL", raw)
+	}
+	return u.String(), nil
+}
+
+// GetJobHandler reports the status of a job and, once it has succeeded,
+// its result in the format of WavePatternHandler. Polling is not rate
+// limited. Jobs are only visible to the key that created them.
+func (a *API) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.ownJob(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// CancelJobHandler cancels a queued or running job. Canceling a finished
+// job responds with 409 Conflict.
+func (a *API) CancelJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, ok := a.ownJob(w, r)
+	if !ok {
+		return
+	}
+	job, err := a.Jobs.Cancel(job.ID)
+	switch {
+	case errors.Is(err, jobs.ErrFinished):
+		writeError(w, r, http.StatusConflict, models.ErrCodeConflict, "Job already "+job.Status)
+		return
+	case errors.Is(err, jobs.ErrNotFound):
+		writeError(w, r, http.StatusNotFound, models.ErrCodeNotFound, "Job not found")
+		return
+	case err != nil:
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not cancel job")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// ownJob authenticates the request and loads the job named by the {id}
+// path value, answering 404 for jobs of other keys.
+func (a *API) ownJob(w http.ResponseWriter, r *http.Request) (models.Job, bool) {
+	key, err := a.authenticateAPIKey(r.Context(), r.Header.Get("X-API-Key"), models.ScopeGenerate)
+	if err != nil {
+		writeKeyError(w, r, err)
+		return models.Job{}, false
+	}
+	job, err := a.Jobs.Get(r.PathValue("id"))
+	if err != nil || job.KeyID != key.ID {
+		writeError(w, r, http.StatusNotFound, models.ErrCodeNotFound, "Job not found")
+		return models.Job{}, false
+	}
+	return job, true
+}
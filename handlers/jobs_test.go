@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/jobs"
+	"wave-generator/models"
+)
+
+// waitJob polls the job until it is done.
+func waitJob(t *testing.T, api *API, key, id string) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		req := httptest.NewRequest(http.MethodGet, "/v1/jobs/"+id, nil)
+		req.SetPathValue("id", id)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		api.GetJobHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("get job: status %d: %s", rec.Code, rec.Body.String())
+		}
+		var job models.Job
+		if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+			t.Fatal(err)
+		}
+		if job.Done() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func submitJob(t *testing.T, api *API, key, query string, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/v1/jobs"+query, bytes.NewReader(body))
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	api.CreateJobHandler(rec, req)
+	return rec
+}
+
+func TestJobHandlers(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	meta, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := submitJob(t, api, key, "?svg_mode=path&export=go", testWavePNG(t).Bytes())
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+	var job models.Job
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if loc := rec.Header().Get("Location"); loc != "/v1/jobs/"+job.ID {
+		t.Errorf("unexpected Location %q", loc)
+	}
+	if rec.Header().Get("RateLimit-Limit") == "" {
+		t.Error("expected submissions to be rate limited")
+	}
+
+	job = waitJob(t, api, key, job.ID)
+	if job.Status != models.JobSucceeded || job.Result == nil {
+		t.Fatalf("unexpected job %+v", job)
+	}
+	if !strings.Contains(job.Result.SVG, "<path") || job.Result.Exports["go"] == "" || len(job.Result.Segments) == 0 {
+		t.Errorf("unexpected result %+v", job.Result)
+	}
+	if job.ExpiresAt == nil || job.FinishedAt == nil || !job.ExpiresAt.After(*job.FinishedAt) {
+		t.Errorf("expected the result to expire after it finished, got %+v", job)
+	}
+	month, err := api.Store.MonthUsage(ctx, meta.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.Requests != 1 || month.Pixels != 33*10 {
+		t.Errorf("unexpected usage %+v", month)
+	}
+
+	t.Run("other key", func(t *testing.T) {
+		_, other, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest(http.MethodGet, "/v1/jobs/"+job.ID, nil)
+		req.SetPathValue("id", job.ID)
+		req.Header.Set("X-API-Key", other)
+		rec := httptest.NewRecorder()
+		api.GetJobHandler(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("got status %d, want 404", rec.Code)
+		}
+	})
+
+	t.Run("cancel finished", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/v1/jobs/"+job.ID, nil)
+		req.SetPathValue("id", job.ID)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		api.CancelJobHandler(rec, req)
+		if rec.Code != http.StatusConflict {
+			t.Errorf("got status %d, want 409", rec.Code)
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			key   string
+			query string
+			body  []byte
+			want  int
+		}{
+			{"missing key", "", "", testWavePNG(t).Bytes(), http.StatusUnauthorized},
+			{"png output", key, "?format=png", testWavePNG(t).Bytes(), http.StatusBadRequest},
+			{"bad style", key, "?linecap=wavy", testWavePNG(t).Bytes(), http.StatusBadRequest},
+			{"bad webhook", key, "?webhook_url=ftp://example.com/hook", testWavePNG(t).Bytes(), http.StatusBadRequest},
+			{"private webhook", key, "?webhook_url=http://169.254.169.254/latest", testWavePNG(t).Bytes(), http.StatusBadRequest},
+			{"not an image", key, "", []byte("not an image"), http.StatusBadRequest},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				if rec := submitJob(t, api, tt.key, tt.query, tt.body); rec.Code != tt.want {
+					t.Errorf("got status %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+				}
+			})
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		img := testWavePNG(t).Bytes()
+		api.MaxUploadBytes = int64(len(img)) - 1
+		defer func() { api.MaxUploadBytes = 0 }()
+		if rec := submitJob(t, api, key, "", img); rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("got status %d, want 413: %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestJobHandlers_Webhook(t *testing.T) {
+	api := newTestAPI(t)
+	// The stub listens on loopback
+	api.Jobs.Close()
+	api.Jobs = jobs.NewManager(jobs.Config{Workers: 1, AllowPrivateWebhooks: true})
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivered := make(chan models.Job, 1)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var job models.Job
+		if err := json.Unmarshal(body, &job); err != nil {
+			t.Errorf("invalid webhook body %s: %v", body, err)
+		}
+		delivered <- job
+	}))
+	defer hook.Close()
+
+	rec := submitJob(t, api, key, "?webhook_url="+hook.URL+"/done", testWavePNG(t).Bytes())
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("got status %d, want 202: %s", rec.Code, rec.Body.String())
+	}
+	select {
+	case job := <-delivered:
+		if job.Status != models.JobSucceeded || job.Result == nil || job.WebhookURL != hook.URL+"/done" {
+			t.Errorf("unexpected webhook payload %+v", job)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
+
+func TestParseWebhookURL(t *testing.T) {
+	for raw, ok := range map[string]bool{
+		"":                         true,
+		"https://example.com/hook": true,
+		"http://127.0.0.1:9000":    true,
+		"ftp://example.com":        false,
+		"/relative":                false,
+		"https://":                 false,
+	} {
+		if _, err := parseWebhookURL(raw); (err == nil) != ok {
+			t.Errorf("parseWebhookURL(%q): got error %v", raw, err)
+		}
+	}
+}
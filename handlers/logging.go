@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+	"wave-generator/services"
+)
+
+// NewLogHandler wraps h so that records logged with a request context
+// carry the request_id assigned by WithRequestID.
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return requestIDHandler{h}
+}
+
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
+
+type requestLogKey struct{}
+
+// requestLog collects the attributes handlers add to the log record of a
+// request.
+type requestLog struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// logAttrs adds attrs to the record WithLogging logs for the request of
+// ctx. Outside WithLogging it does nothing.
+func logAttrs(ctx context.Context, attrs ...slog.Attr) {
+	rl, ok := ctx.Value(requestLogKey{}).(*requestLog)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.attrs = append(rl.attrs, attrs...)
+}
+
+// WithLogging logs one record per request once it is served: method, path,
+// status, response size and latency, the processing stages recorded in
+// services.Timings and whatever the handler added with logAttrs. Server
+// errors are logged at the error level. Use it inside WithRequestID so the
+// record carries the request ID.
+func WithLogging(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rl := &requestLog{}
+		ctx := context.WithValue(r.Context(), requestLogKey{}, rl)
+		timings := services.TimingsFrom(ctx)
+		if timings == nil {
+			timings = &services.Timings{}
+			ctx = services.WithTimings(ctx, timings)
+		}
+		sw := &statusWriter{ResponseWriter: w}
+
+		next(sw, r.WithContext(ctx))
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", sw.bytes),
+			slog.Float64("duration_ms", milliseconds(time.Since(start))),
+		}
+		if timings.Len() > 0 {
+			attrs = append(attrs, slog.Any("stages", timings))
+		}
+		rl.mu.Lock()
+		attrs = append(attrs, rl.attrs...)
+		rl.mu.Unlock()
+
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "request", attrs...)
+	}
+}
+
+// milliseconds returns d in milliseconds with microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
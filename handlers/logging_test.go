@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"wave-generator/models"
+)
+
+// captureLogs makes the default logger write JSON records to the returned
+// buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(NewLogHandler(slog.NewJSONHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestWithLogging(t *testing.T) {
+	logs := captureLogs(t)
+	api := newTestAPI(t)
+	handler := WithRequestID(WithLogging(api.WavePatternHandler))
+
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave", testWavePNG(t))
+	req.Header.Set(RequestIDHeader, "req-1")
+	asUI(req)
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var record struct {
+		Level      string             `json:"level"`
+		Msg        string             `json:"msg"`
+		RequestID  string             `json:"request_id"`
+		Method     string             `json:"method"`
+		Path       string             `json:"path"`
+		Status     int                `json:"status"`
+		Bytes      int                `json:"bytes"`
+		DurationMS *float64           `json:"duration_ms"`
+		Width      int                `json:"width"`
+		Height     int                `json:"height"`
+		Stages     map[string]float64 `json:"stages"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+		t.Fatalf("expected one JSON record, got %q: %v", logs.String(), err)
+	}
+	if record.Msg != "request" || record.Level != "INFO" || record.RequestID != "req-1" || record.Method != http.MethodPost ||
+		record.Path != "/generate-wave" || record.Status != http.StatusOK || record.Bytes != rec.Body.Len() || record.DurationMS == nil {
+		t.Errorf("unexpected record %s", logs.String())
+	}
+	if record.Width != 33 || record.Height != 10 {
+		t.Errorf("expected the image size, got %s", logs.String())
+	}
+	for _, stage := range []string{"decode_ms", "grayscale_ms", "extract_ms", "fit_ms", "render_ms"} {
+		if _, ok := record.Stages[stage]; !ok {
+			t.Errorf("missing stage %s in %v", stage, record.Stages)
+		}
+	}
+}
+
+func TestWithLogging_Error(t *testing.T) {
+	logs := captureLogs(t)
+	handler := WithRequestID(WithLogging(func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "inside")
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "boom")
+	}))
+	handler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	dec := json.NewDecoder(logs)
+	var inside, request struct {
+		Level     string `json:"level"`
+		RequestID string `json:"request_id"`
+		Status    int    `json:"status"`
+		Stages    any    `json:"stages"`
+	}
+	if err := dec.Decode(&inside); err != nil {
+		t.Fatal(err)
+	}
+	if err := dec.Decode(&request); err != nil {
+		t.Fatal(err)
+	}
+	if inside.RequestID == "" || inside.RequestID != request.RequestID {
+		t.Errorf("expected both records to carry the request ID, got %q and %q", inside.RequestID, request.RequestID)
+	}
+	if request.Level != "ERROR" || request.Status != http.StatusInternalServerError || request.Stages != nil {
+		t.Errorf("unexpected record %+v", request)
+	}
+}
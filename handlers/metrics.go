@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"wave-generator/metrics"
+	"wave-generator/services"
+)
+
+// Metrics exposed at /metrics.
+var (
+	httpRequests = metrics.Default.Counter("wave_http_requests_total",
+		"HTTP requests by method, route and status code.", "method", "route", "status")
+	httpDuration = metrics.Default.Histogram("wave_http_request_duration_seconds",
+		"Latency of HTTP requests by method and route.", metrics.DefBuckets, "method", "route")
+	stageDuration = metrics.Default.Histogram("wave_stage_duration_seconds",
+		"Duration of the processing stages; a batch request observes the total of its images.", metrics.DefBuckets, "stage")
+	imageSizes = metrics.Default.Histogram("wave_image_pixels",
+		"Size of the processed images in pixels.", metrics.ExponentialBuckets(1e4, 4, 8))
+	fitSegments = metrics.Default.Histogram("wave_fit_segments",
+		"Polynomial segments fitted per image.", []float64{1, 2, 4, 8, 16, 32})
+	rateLimitRejections = metrics.Default.Counter("wave_rate_limit_rejections_total",
+		"Requests and batch images rejected by a rate limit (ip, key, issue) or the monthly quota (quota).", "limit")
+)
+
+// WithMetrics counts requests by route and status and observes their
+// latency and processing stages. Routes are the patterns of the
+// http.ServeMux, so it must run inside the mux.
+func WithMetrics(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		timings := services.TimingsFrom(r.Context())
+		if timings == nil {
+			timings = &services.Timings{}
+			r = r.WithContext(services.WithTimings(r.Context(), timings))
+		}
+		sw := &statusWriter{ResponseWriter: w}
+
+		next(sw, r)
+
+		status := sw.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		method, route := metricMethod(r.Method), metricRoute(r.Pattern)
+		httpRequests.Inc(method, route, strconv.Itoa(status))
+		httpDuration.Observe(time.Since(start).Seconds(), method, route)
+		observeStages(timings)
+	}
+}
+
+// observeStages records the stage durations of one request or job.
+func observeStages(t *services.Timings) {
+	t.Each(func(stage string, d time.Duration) {
+		stageDuration.Observe(d.Seconds(), stage)
+	})
+}
+
+// observeImage records the size of a processed image and the number of
+// segments fitted to it.
+func observeImage(pixels int64, res *services.Result) {
+	imageSizes.Observe(float64(pixels))
+	fitSegments.Observe(float64(len(res.Segments)))
+}
+
+// metricMethod keeps the method label to the standard methods.
+func metricMethod(m string) string {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions:
+		return m
+	}
+	return "OTHER"
+}
+
+// metricRoute strips the method from a ServeMux pattern, so routes are a
+// bounded set of paths such as /v1/jobs/{id}.
+func metricRoute(pattern string) string {
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	if pattern == "" {
+		return "unmatched"
+	}
+	return pattern
+}
+
+// rejectedBy is the limit label of a rate-limit bucket such as "key:<id>".
+func rejectedBy(bucket string) string {
+	limit, _, _ := strings.Cut(bucket, ":")
+	return limit
+}
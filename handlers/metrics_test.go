@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wave-generator/storage"
+)
+
+func TestWithMetrics(t *testing.T) {
+	api := newTestAPI(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/generate-wave", WithMetrics(api.WavePatternHandler))
+
+	requests := httpRequests.Value("POST", "/v1/generate-wave", "200")
+	latencies := httpDuration.Count("POST", "/v1/generate-wave")
+	fits := stageDuration.Count("fit")
+	images, segments := imageSizes.Count(), fitSegments.Count()
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/generate-wave", testWavePNG(t))
+	asUI(req)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if httpRequests.Value("POST", "/v1/generate-wave", "200") != requests+1 || httpDuration.Count("POST", "/v1/generate-wave") != latencies+1 {
+		t.Error("expected the request to be counted by route")
+	}
+	if stageDuration.Count("fit") != fits+1 {
+		t.Error("expected the processing stages to be observed")
+	}
+	if imageSizes.Count() != images+1 || fitSegments.Count() != segments+1 {
+		t.Error("expected the image size and segment count to be observed")
+	}
+}
+
+func TestRateLimitRejections(t *testing.T) {
+	api := newTestAPI(t)
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	limit := storage.Limit{Requests: 1, Period: time.Hour}
+	rejected := rateLimitRejections.Value("ip")
+
+	api.allow(httptest.NewRecorder(), req, "ip:192.0.2.1", limit)
+	if rateLimitRejections.Value("ip") != rejected {
+		t.Error("expected allowed requests not to be counted")
+	}
+	api.allow(httptest.NewRecorder(), req, "ip:192.0.2.1", limit)
+	if rateLimitRejections.Value("ip") != rejected+1 {
+		t.Error("expected the rejection to be counted")
+	}
+}
+
+func TestMetricLabels(t *testing.T) {
+	for in, want := range map[string]string{
+		"GET /v1/jobs/{id}": "/v1/jobs/{id}",
+		"/v1/generate-wave": "/v1/generate-wave",
+		"":                  "unmatched",
+	} {
+		if got := metricRoute(in); got != want {
+			t.Errorf("metricRoute(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if metricMethod("PATCH") != "PATCH" || metricMethod("BREW") != "OTHER" {
+		t.Error("expected unknown methods to be grouped")
+	}
+}
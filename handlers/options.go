@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"wave-generator/services"
+)
+
+// Response formats of /generate-wave.
+const (
+	formatJSON = "json"
+	formatPNG  = "png"
+)
+
+// outputOptions selects what /generate-wave returns.
+type outputOptions struct {
+	format  string // formatJSON or formatPNG
+	overlay bool   // draw the PNG wave over the uploaded image
+	debug   bool   // include the diagnostic overlay
+	exports []string
+}
+
+// parseOutput reads the format, overlay, debug and export query parameters.
+// Overlay is only available for PNG output; with debug the PNG output is the
+// diagnostic image and JSON output gains a debug object. Export is a comma
+// separated list of services.ExportLanguages added to JSON output.
+func parseOutput(q url.Values) (outputOptions, error) {
+	out := outputOptions{format: q.Get("format")}
+	switch out.format {
+	case "":
+		out.format = formatJSON
+	case formatJSON, formatPNG:
+	default:
+		return out, fmt.Errorf("invalid format %q: must be json or png", out.format)
+	}
+	var err error
+	if out.overlay, err = parseBoolParam(q, "overlay"); err != nil {
+		return out, err
+	}
+	if out.debug, err = parseBoolParam(q, "debug"); err != nil {
+		return out, err
+	}
+	if out.overlay && out.format != formatPNG {
+		return out, fmt.Errorf("overlay requires format=png")
+	}
+	if v := q.Get("export"); v != "" {
+		for _, lang := range strings.Split(v, ",") {
+			lang = strings.TrimSpace(lang)
+			if !slices.Contains(services.ExportLanguages, lang) {
+				return out, fmt.Errorf("invalid export %q: must be one of %s", lang, strings.Join(services.ExportLanguages, ", "))
+			}
+			out.exports = append(out.exports, lang)
+		}
+	}
+	return out, nil
+}
+
+// parseProcessOptions reads the styling and output query parameters of a
+// /generate-wave request. Errors are meant to be reported as 400.
+func parseProcessOptions(q url.Values) (services.Options, error) {
+	style, err := parseSVGStyle(q)
+	if err != nil {
+		return services.Options{}, fmt.Errorf("invalid style: %w", err)
+	}
+	segStyle, err := parseSegmentStyle(q)
+	if err != nil {
+		return services.Options{}, fmt.Errorf("invalid style: %w", err)
+	}
+	out, err := parseOutput(q)
+	if err != nil {
+		return services.Options{}, err
+	}
+	if out.format == formatPNG && !out.debug {
+		if err := style.ValidateRaster(); err != nil {
+			return services.Options{}, fmt.Errorf("invalid style: %w", err)
+		}
+	}
+	return services.Options{
+		Style:        style,
+		SegmentStyle: segStyle,
+		PNG:          out.format == formatPNG,
+		Overlay:      out.overlay,
+		Debug:        out.debug,
+		Exports:      out.exports,
+	}, nil
+}
+
+// processOptions is parseProcessOptions with the segment settings of the
+// API.
+func (a *API) processOptions(q url.Values) (services.Options, error) {
+	opts, err := parseProcessOptions(q)
+	opts.MaxSegments, opts.SegmentHeight = a.MaxSegments, a.SegmentHeight
+	return opts, err
+}
+
+func parseBoolParam(q url.Values, name string) (bool, error) {
+	v := q.Get(name)
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return b, nil
+}
+
+// parseSVGStyle builds the rendering style for the full wave from the query
+// parameters of a /generate-wave request. Unset parameters keep the defaults
+// of services.DefaultSVGStyle.
+func parseSVGStyle(q url.Values) (services.SVGStyle, error) {
+	style := services.DefaultSVGStyle()
+	if v := q.Get("svg_mode"); v != "" {
+		style.Mode = v
+	}
+	if err := applyStrokeParams(q, &style); err != nil {
+		return style, err
+	}
+	style.Fill = q.Get("fill")
+	if style.Fill == "none" {
+		style.Fill = services.FillNone
+	}
+	style.FillColor = q.Get("fill_color")
+	if v := q.Get("gradient"); v != "" {
+		style.Gradient = services.SplitColors(v)
+	}
+	if v := q.Get("gradient_dir"); v != "" {
+		style.GradientDir = v
+	}
+	style.Background = q.Get("background")
+	var err error
+	if style.Responsive, err = parseBoolParam(q, "responsive"); err != nil {
+		return style, err
+	}
+	if v := q.Get("aspect"); v != "" {
+		style.AspectRatio = v
+	}
+	if v := q.Get("layers"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return style, fmt.Errorf("invalid layers: %q", v)
+		}
+		style.Layers = n
+	}
+	if v := q.Get("layer_offset"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return style, fmt.Errorf("invalid layer_offset: %q", v)
+		}
+		style.LayerOffset = f
+	}
+	return style, style.Validate()
+}
+
+// parseSegmentStyle builds the style of the per-segment mini SVGs. Only the
+// stroke and background parameters apply to them.
+func parseSegmentStyle(q url.Values) (services.SVGStyle, error) {
+	style := services.DefaultSegmentStyle()
+	if err := applyStrokeParams(q, &style); err != nil {
+		return style, err
+	}
+	style.Background = q.Get("background")
+	return style, style.Validate()
+}
+
+func applyStrokeParams(q url.Values, style *services.SVGStyle) error {
+	if v := q.Get("stroke"); v != "" {
+		style.Stroke = v
+	}
+	if v := q.Get("stroke_width"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return fmt.Errorf("invalid stroke_width: %q", v)
+		}
+		style.StrokeWidth = f
+	}
+	if v := q.Get("linecap"); v != "" {
+		style.LineCap = v
+	}
+	return nil
+}
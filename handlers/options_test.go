@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"wave-generator/services"
+)
+
+func TestParseSVGStyle(t *testing.T) {
+	q := url.Values{
+		"svg_mode":     {"path"},
+		"stroke":       {"#112233"},
+		"stroke_width": {"3"},
+		"linecap":      {"round"},
+		"fill":         {"below"},
+		"gradient":     {"rgb(0,0,0), #fff"},
+		"gradient_dir": {"vertical"},
+		"responsive":   {"true"},
+		"layers":       {"2"},
+		"layer_offset": {"-6"},
+	}
+
+	style, err := parseSVGStyle(q)
+	if err != nil {
+		t.Fatalf("parseSVGStyle() error = %v", err)
+	}
+	if style.Mode != services.SVGModePath || style.Stroke != "#112233" || style.StrokeWidth != 3 || style.LineCap != "round" {
+		t.Errorf("stroke options not applied: %+v", style)
+	}
+	if style.Fill != services.FillBelow || !style.Responsive || style.Layers != 2 || style.LayerOffset != -6 {
+		t.Errorf("fill/layout options not applied: %+v", style)
+	}
+	if want := []string{"rgb(0,0,0)", "#fff"}; !reflect.DeepEqual(style.Gradient, want) {
+		t.Errorf("gradient = %v, want %v", style.Gradient, want)
+	}
+
+	for _, bad := range []url.Values{
+		{"stroke_width": {"wide"}},
+		{"stroke_width": {"NaN"}},
+		{"stroke_width": {"Inf"}},
+		{"layers": {"many"}},
+		{"layer_offset": {"NaN"}},
+		{"layer_offset": {"1e308"}},
+		{"layers": {"2"}, "layer_offset": {"Inf"}},
+		{"responsive": {"maybe"}},
+		{"stroke": {"<script>"}},
+		{"fill": {"left"}},
+	} {
+		if _, err := parseSVGStyle(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
+
+func TestParseSegmentStyle(t *testing.T) {
+	style, err := parseSegmentStyle(url.Values{"stroke": {"red"}, "fill": {"below"}})
+	if err != nil {
+		t.Fatalf("parseSegmentStyle() error = %v", err)
+	}
+	if style.Stroke != "red" || style.Fill != services.FillNone {
+		t.Errorf("unexpected segment style: %+v", style)
+	}
+}
+
+func TestParseOutput(t *testing.T) {
+	out, err := parseOutput(url.Values{"format": {"png"}, "overlay": {"1"}, "debug": {"true"}})
+	if err != nil {
+		t.Fatalf("parseOutput() error = %v", err)
+	}
+	if out.format != formatPNG || !out.overlay || !out.debug {
+		t.Errorf("unexpected output options: %+v", out)
+	}
+
+	out, err = parseOutput(url.Values{})
+	if err != nil || out.format != formatJSON {
+		t.Errorf("expected JSON default, got %+v, %v", out, err)
+	}
+
+	out, err = parseOutput(url.Values{"export": {"go, latex"}})
+	if err != nil || !reflect.DeepEqual(out.exports, []string{"go", "latex"}) {
+		t.Errorf("expected exports [go latex], got %+v, %v", out, err)
+	}
+
+	for _, bad := range []url.Values{
+		{"export": {"go,cobol"}},
+		{"format": {"gif"}},
+		{"overlay": {"true"}},
+		{"debug": {"verbose"}},
+	} {
+		if _, err := parseOutput(bad); err == nil {
+			t.Errorf("expected error for %v", bad)
+		}
+	}
+}
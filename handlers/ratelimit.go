@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"wave-generator/config"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+// Rate-limit tiers of the default configuration, which can be assigned
+// to API keys.
+const (
+	TierFree     = config.TierFree
+	TierStandard = config.TierStandard
+	TierPro      = config.TierPro
+)
+
+// tierLimits converts configured tiers to store limits.
+func tierLimits(tiers map[string]config.Limit) map[string]storage.Limit {
+	limits := make(map[string]storage.Limit, len(tiers))
+	for name, l := range tiers {
+		limits[name] = storage.Limit(l)
+	}
+	return limits
+}
+
+// keyLimit returns the limit of the key's tier, falling back to the
+// default tier for keys without a known tier.
+func (a *API) keyLimit(k models.APIKey) storage.Limit {
+	if l, ok := a.Tiers[k.Tier]; ok {
+		return l
+	}
+	return a.Tiers[a.DefaultTier]
+}
+
+// allow takes a token from the named bucket and sets the RateLimit-*
+// headers. When the bucket is empty it responds 429 with Retry-After and
+// returns false; the handler must then stop.
+func (a *API) allow(w http.ResponseWriter, r *http.Request, bucket string, l storage.Limit) bool {
+	d, err := a.Store.Allow(r.Context(), "ratelimit:"+bucket, l)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Rate limit error")
+		return false
+	}
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.FormatInt(d.Limit, 10))
+	h.Set("RateLimit-Remaining", strconv.FormatInt(d.Remaining, 10))
+	h.Set("RateLimit-Reset", seconds(d.Reset))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%s", l.Requests, seconds(l.Period)))
+	if !d.Allowed {
+		rateLimitRejections.Inc(rejectedBy(bucket))
+		h.Set("Retry-After", seconds(d.RetryAfter))
+		writeErrorDetails(w, r, http.StatusTooManyRequests, models.ErrCodeRateLimited,
+			"Rate limit exceeded. Try again in "+seconds(d.RetryAfter)+"s",
+			map[string]any{"retry_after": math.Ceil(d.RetryAfter.Seconds()), "limit": d.Limit})
+		return false
+	}
+	return true
+}
+
+// busyRetryAfter is the Retry-After sent when every processing slot is
+// taken; requests usually finish within a few seconds.
+const busyRetryAfter = 2 * time.Second
+
+// processingSlots returns the semaphore of MaxConcurrent, or nil without
+// a limit.
+func (a *API) processingSlots() chan struct{} {
+	a.slotsOnce.Do(func() {
+		if a.MaxConcurrent > 0 {
+			a.slots = make(chan struct{}, a.MaxConcurrent)
+		}
+	})
+	return a.slots
+}
+
+// acquire takes one of the MaxConcurrent processing slots. When all of them
+// are taken it responds 503 with Retry-After and returns false; otherwise
+// the caller must call release once it is done processing.
+func (a *API) acquire(w http.ResponseWriter, r *http.Request) (release func(), ok bool) {
+	slots := a.processingSlots()
+	if slots == nil {
+		return func() {}, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		w.Header().Set("Retry-After", seconds(busyRetryAfter))
+		writeError(w, r, http.StatusServiceUnavailable, models.ErrCodeUnavailable, "Server busy, retry later")
+		return nil, false
+	}
+}
+
+// waitSlot takes a processing slot like acquire, but waits for one to
+// free up instead of responding 503. It fails once ctx is done.
+func (a *API) waitSlot(ctx context.Context) (release func(), err error) {
+	slots := a.processingSlots()
+	if slots == nil {
+		return func() {}, nil
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// seconds formats d as a whole number of seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// clientIP returns the IP address used to rate-limit anonymous requests.
+// X-Forwarded-For is only honored with TrustProxy, since clients can set
+// it freely; the last entry is the one added by the proxy.
+func (a *API) clientIP(r *http.Request) string {
+	if a.TrustProxy {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			parts := strings.Split(fwd, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
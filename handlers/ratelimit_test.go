@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+func TestKeyLimit(t *testing.T) {
+	api := newTestAPI(t)
+	tests := []struct {
+		tier string
+		want int64
+	}{
+		{TierFree, 100},
+		{TierPro, 10000},
+		{"", 1000},
+		{"retired", 1000},
+	}
+	for _, tt := range tests {
+		if got := api.keyLimit(models.APIKey{Tier: tt.tier}); got.Requests != tt.want {
+			t.Errorf("tier %q: got %d requests, want %d", tt.tier, got.Requests, tt.want)
+		}
+	}
+}
+
+func TestAllow(t *testing.T) {
+	api := newTestAPI(t)
+	limit := storage.Limit{Requests: 2, Period: time.Minute}
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave", nil)
+
+	rec := httptest.NewRecorder()
+	if !api.allow(rec, req, "test", limit) {
+		t.Fatal("expected the first request to be allowed")
+	}
+	want := map[string]string{
+		"RateLimit-Limit":     "2",
+		"RateLimit-Remaining": "1",
+		"RateLimit-Reset":     "30",
+		"RateLimit-Policy":    "2;w=60",
+	}
+	for h, v := range want {
+		if got := rec.Header().Get(h); got != v {
+			t.Errorf("%s: got %q, want %q", h, got, v)
+		}
+	}
+
+	api.allow(httptest.NewRecorder(), req, "test", limit)
+	rec = httptest.NewRecorder()
+	if api.allow(rec, req, "test", limit) {
+		t.Fatal("expected the third request to be denied")
+	}
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("got status %d, want 429", rec.Code)
+	}
+	if got := rec.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("got Retry-After %q, want 30", got)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	api := newTestAPI(t)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "203.0.113.9:5555"
+	req.Header.Set("X-Forwarded-For", "10.0.0.1, 198.51.100.2")
+
+	if got := api.clientIP(req); got != "203.0.113.9" {
+		t.Errorf("without TrustProxy: got %q, want the remote address", got)
+	}
+	api.TrustProxy = true
+	if got := api.clientIP(req); got != "198.51.100.2" {
+		t.Errorf("with TrustProxy: got %q, want the proxy-added address", got)
+	}
+}
+
+func TestAcquire(t *testing.T) {
+	api := newTestAPI(t)
+	api.MaxConcurrent = 1
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave", nil)
+
+	release, ok := api.acquire(httptest.NewRecorder(), req)
+	if !ok {
+		t.Fatal("expected the first request to get a slot")
+	}
+	rec := httptest.NewRecorder()
+	if _, ok := api.acquire(rec, req); ok {
+		t.Fatal("expected the second request to be refused")
+	}
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("got status %d, headers %v", rec.Code, rec.Header())
+	}
+	release()
+	if _, ok := api.acquire(httptest.NewRecorder(), req); !ok {
+		t.Error("expected a released slot to be reusable")
+	}
+
+	unlimited := newTestAPI(t)
+	for i := 0; i < 3; i++ {
+		if _, ok := unlimited.acquire(httptest.NewRecorder(), req); !ok {
+			t.Fatal("expected no limit without MaxConcurrent")
+		}
+	}
+}
+
+func TestWaitSlot(t *testing.T) {
+	api := newTestAPI(t)
+	api.MaxConcurrent = 1
+
+	release, err := api.waitSlot(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := api.waitSlot(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected to wait until the context is done, got %v", err)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		release()
+	}()
+	if _, err := api.waitSlot(context.Background()); err != nil {
+		t.Errorf("expected the released slot, got %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		reuse    bool
+	}{
+		{"generated", "", false},
+		{"client supplied", "checkout-42.retry_1", true},
+		{"rejected when unsafe", "bad id\nInjected: header", false},
+		{"rejected when too long", strings.Repeat("a", 65), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			var seen string
+			rec := httptest.NewRecorder()
+			WithRequestID(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			})(rec, req)
+
+			if seen == "" || rec.Header().Get(RequestIDHeader) != seen {
+				t.Fatalf("context ID %q does not match response header %q", seen, rec.Header().Get(RequestIDHeader))
+			}
+			if (seen == tt.incoming) != tt.reuse {
+				t.Errorf("got ID %q for incoming %q", seen, tt.incoming)
+			}
+		})
+	}
+}
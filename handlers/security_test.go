@@ -0,0 +1,24 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWithSecurityHeaders(t *testing.T) {
+	for _, csp := range []string{"default-src 'self'", ""} {
+		rec := httptest.NewRecorder()
+		WithSecurityHeaders(csp, func(http.ResponseWriter, *http.Request) {})(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		h := rec.Header()
+		if h.Get("Content-Security-Policy") != csp {
+			t.Errorf("got CSP %q, want %q", h.Get("Content-Security-Policy"), csp)
+		}
+		if _, ok := h["Content-Security-Policy"]; csp == "" && ok {
+			t.Error("expected no CSP header for an empty policy")
+		}
+		if h.Get("X-Content-Type-Options") != "nosniff" || h.Get("X-Frame-Options") != "DENY" || h.Get("Referrer-Policy") != "strict-origin-when-cross-origin" {
+			t.Errorf("got %v", h)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"wave-generator/models"
+	"wave-generator/storage"
+)
+
+const dateLayout = "2006-01-02"
+
+// statusWriter records the status code and the number of body bytes
+// written by a handler.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g.
+// to flush streamed responses.
+func (s *statusWriter) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusWriter) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += int64(n)
+	return n, err
+}
+
+// recordUsage meters one request made with the key. It runs after the
+// response is written, so a metering failure is only logged.
+func (a *API) recordUsage(keyID string, start time.Time, status int, pixels int64) {
+	u := models.Usage{
+		Requests:     1,
+		Pixels:       pixels,
+		ProcessingMS: time.Since(start).Milliseconds(),
+	}
+	if status >= http.StatusBadRequest {
+		u.Errors = 1
+	}
+	if err := a.Store.RecordUsage(context.Background(), keyID, start, u); err != nil {
+		slog.Error("recording usage", "key_id", keyID, "err", err)
+	}
+}
+
+// checkQuota rejects the request with 429 when the key has used its
+// monthly quota. The check is not atomic with recording usage, so
+// concurrent requests may exceed the quota slightly.
+func (a *API) checkQuota(w http.ResponseWriter, r *http.Request, key models.APIKey) bool {
+	if key.MonthlyQuota <= 0 {
+		return true
+	}
+	now := time.Now()
+	month, err := a.Store.MonthUsage(r.Context(), key.ID, now)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Quota check error")
+		return false
+	}
+	if month.Requests >= key.MonthlyQuota {
+		rateLimitRejections.Inc("quota")
+		next := storage.MonthStart(now).AddDate(0, 1, 0)
+		w.Header().Set("Retry-After", seconds(next.Sub(now)))
+		writeErrorDetails(w, r, http.StatusTooManyRequests, models.ErrCodeQuotaExceeded,
+			"Monthly quota of "+strconv.FormatInt(key.MonthlyQuota, 10)+" requests exceeded",
+			map[string]any{"monthly_quota": key.MonthlyQuota, "resets_at": next.Format(time.RFC3339)})
+		return false
+	}
+	return true
+}
+
+// parseUsageRange reads the from and to query parameters (YYYY-MM-DD,
+// UTC). They default to the current month up to today.
+func parseUsageRange(q url.Values, now time.Time) (from, to time.Time, err error) {
+	from, to = storage.MonthStart(now), storage.Day(now)
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(dateLayout, v); err != nil {
+			return from, to, errors.New("invalid from: use YYYY-MM-DD")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(dateLayout, v); err != nil {
+			return from, to, errors.New("invalid to: use YYYY-MM-DD")
+		}
+	}
+	if to.Before(from) {
+		return from, to, errors.New("from must not be after to")
+	}
+	if to.Sub(from) >= storage.MaxUsageDays*24*time.Hour {
+		return from, to, fmt.Errorf("range must not exceed %d days", storage.MaxUsageDays)
+	}
+	return from, to, nil
+}
+
+// keyUsage is the usage report of one key.
+type keyUsage struct {
+	KeyID string         `json:"key_id"`
+	Owner string         `json:"owner,omitempty"`
+	Total models.Usage   `json:"total"`
+	Days  []models.Usage `json:"days"`
+}
+
+func (a *API) keyUsage(ctx context.Context, key models.APIKey, from, to time.Time) (keyUsage, error) {
+	days, err := a.Store.Usage(ctx, key.ID, from, to)
+	if err != nil {
+		return keyUsage{}, err
+	}
+	report := keyUsage{KeyID: key.ID, Owner: key.Owner, Days: days}
+	if report.Days == nil {
+		report.Days = []models.Usage{}
+	}
+	for _, d := range days {
+		report.Total.Add(d)
+	}
+	return report, nil
+}
+
+// UsageHandler reports the usage of the calling API key (GET /v1/usage).
+// The optional from and to parameters select the days (YYYY-MM-DD, UTC);
+// the current month is reported by default, together with the monthly
+// quota if the key has one.
+func (a *API) UsageHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := a.authenticateAPIKey(r.Context(), r.Header.Get("X-API-Key"), "")
+	if err != nil {
+		writeKeyError(w, r, err)
+		return
+	}
+	now := time.Now()
+	from, to, err := parseUsageRange(r.URL.Query(), now)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	report, err := a.keyUsage(r.Context(), key, from, to)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not load usage")
+		return
+	}
+	month, err := a.Store.MonthUsage(r.Context(), key.ID, now)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not load usage")
+		return
+	}
+	resp := struct {
+		keyUsage
+		From           string       `json:"from"`
+		To             string       `json:"to"`
+		Month          models.Usage `json:"month"`
+		MonthlyQuota   int64        `json:"monthly_quota,omitempty"`
+		QuotaRemaining *int64       `json:"quota_remaining,omitempty"`
+	}{
+		keyUsage:     report,
+		From:         from.Format(dateLayout),
+		To:           to.Format(dateLayout),
+		Month:        month,
+		MonthlyQuota: key.MonthlyQuota,
+	}
+	if key.MonthlyQuota > 0 {
+		remaining := max(key.MonthlyQuota-month.Requests, 0)
+		resp.QuotaRemaining = &remaining
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// AdminUsageHandler reports the usage of every key (GET /admin/usage) over
+// the from/to range. With format=csv it returns one row per key and day,
+// for billing spreadsheets.
+func (a *API) AdminUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if !a.authorizeAdmin(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	from, to, err := parseUsageRange(q, time.Now())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	format := q.Get("format")
+	if format != "" && format != formatJSON && format != "csv" {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Invalid format: must be json or csv")
+		return
+	}
+	keys, err := a.Store.ListKeys(r.Context())
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not list API keys")
+		return
+	}
+	reports := make([]keyUsage, 0, len(keys))
+	var total models.Usage
+	for _, k := range keys {
+		report, err := a.keyUsage(r.Context(), k, from, to)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "Could not load usage")
+			return
+		}
+		reports = append(reports, report)
+		total.Add(report.Total)
+	}
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="usage-`+from.Format(dateLayout)+`-`+to.Format(dateLayout)+`.csv"`)
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"key_id", "owner", "date", "requests", "errors", "pixels", "processing_ms"})
+		for _, report := range reports {
+			for _, d := range report.Days {
+				_ = cw.Write([]string{
+					report.KeyID, report.Owner, d.Date,
+					strconv.FormatInt(d.Requests, 10),
+					strconv.FormatInt(d.Errors, 10),
+					strconv.FormatInt(d.Pixels, 10),
+					strconv.FormatInt(d.ProcessingMS, 10),
+				})
+			}
+		}
+		cw.Flush()
+		return
+	}
+	writeJSON(w, http.StatusOK, struct {
+		From  string       `json:"from"`
+		To    string       `json:"to"`
+		Total models.Usage `json:"total"`
+		Keys  []keyUsage   `json:"keys"`
+	}{from.Format(dateLayout), to.Format(dateLayout), total, reports})
+}
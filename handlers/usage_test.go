@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/models"
+)
+
+func TestParseUsageRange(t *testing.T) {
+	now := time.Date(2025, 5, 17, 13, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		query    string
+		from, to string
+		wantErr  bool
+	}{
+		{"defaults to current month", "", "2025-05-01", "2025-05-17", false},
+		{"explicit range", "from=2025-04-01&to=2025-04-30", "2025-04-01", "2025-04-30", false},
+		{"invalid date", "from=01/04/2025", "", "", true},
+		{"inverted", "from=2025-05-10&to=2025-05-01", "", "", true},
+		{"too long", "from=2023-01-01&to=2025-01-01", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, _ := url.ParseQuery(tt.query)
+			from, to, err := parseUsageRange(q, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (from.Format(dateLayout) != tt.from || to.Format(dateLayout) != tt.to) {
+				t.Errorf("got %s..%s, want %s..%s", from.Format(dateLayout), to.Format(dateLayout), tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestWavePatternHandler_Metering(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	meta, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes, MonthlyQuota: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	send := func(body []byte) int {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+		return rec.Code
+	}
+
+	if code := send(testWavePNG(t).Bytes()); code != http.StatusOK {
+		t.Fatalf("got status %d, want 200", code)
+	}
+	if code := send([]byte("not an image")); code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want 400", code)
+	}
+	month, err := api.Store.MonthUsage(ctx, meta.ID, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if month.Requests != 2 || month.Errors != 1 || month.Pixels != 33*10 {
+		t.Errorf("unexpected usage %+v", month)
+	}
+
+	if code := send(testWavePNG(t).Bytes()); code != http.StatusTooManyRequests {
+		t.Errorf("over quota: got status %d, want 429", code)
+	}
+	if month, _ := api.Store.MonthUsage(ctx, meta.ID, time.Now()); month.Requests != 2 {
+		t.Errorf("rejected requests must not be metered, got %d requests", month.Requests)
+	}
+}
+
+func TestUsageHandler(t *testing.T) {
+	api := newTestAPI(t)
+	ctx := context.Background()
+	meta, key, err := api.issueAPIKey(ctx, models.APIKey{Scopes: defaultScopes, MonthlyQuota: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	api.Store.RecordUsage(ctx, meta.ID, now, models.Usage{Requests: 3, Errors: 1, Pixels: 300, ProcessingMS: 12})
+
+	req := httptest.NewRequest(http.MethodGet, "/v1/usage", nil)
+	req.Header.Set("X-API-Key", key)
+	rec := httptest.NewRecorder()
+	api.UsageHandler(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		KeyID          string         `json:"key_id"`
+		Total          models.Usage   `json:"total"`
+		Days           []models.Usage `json:"days"`
+		Month          models.Usage   `json:"month"`
+		QuotaRemaining int64          `json:"quota_remaining"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.KeyID != meta.ID || out.Total.Requests != 3 || len(out.Days) != 1 || out.Month.Pixels != 300 || out.QuotaRemaining != 7 {
+		t.Errorf("unexpected report %+v", out)
+	}
+
+	t.Run("without key", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.UsageHandler(rec, httptest.NewRequest(http.MethodGet, "/v1/usage", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+
+	t.Run("invalid range", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/v1/usage?from=yesterday", nil)
+		req.Header.Set("X-API-Key", key)
+		rec := httptest.NewRecorder()
+		api.UsageHandler(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want 400", rec.Code)
+		}
+	})
+}
+
+func TestAdminUsageHandler(t *testing.T) {
+	api := newTestAPI(t)
+	api.AdminToken = "s3cret"
+	ctx := context.Background()
+	a, _, _ := api.issueAPIKey(ctx, models.APIKey{Owner: "team-a"})
+	b, _, _ := api.issueAPIKey(ctx, models.APIKey{Owner: "team-b"})
+	day := time.Date(2025, 5, 2, 10, 0, 0, 0, time.UTC)
+	api.Store.RecordUsage(ctx, a.ID, day, models.Usage{Requests: 2, Pixels: 20})
+	api.Store.RecordUsage(ctx, b.ID, day, models.Usage{Requests: 5, Errors: 1})
+
+	rec := httptest.NewRecorder()
+	api.AdminUsageHandler(rec, adminRequest(http.MethodGet, "/admin/usage?from=2025-05-01&to=2025-05-31", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var out struct {
+		Total models.Usage `json:"total"`
+		Keys  []keyUsage   `json:"keys"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.Total.Requests != 7 || out.Total.Errors != 1 || len(out.Keys) != 2 {
+		t.Errorf("unexpected aggregate %+v", out)
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.AdminUsageHandler(rec, adminRequest(http.MethodGet, "/admin/usage?from=2025-05-01&to=2025-05-31&format=csv", ""))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+			t.Fatalf("got Content-Type %q", ct)
+		}
+		rows, err := csv.NewReader(rec.Body).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 3 || rows[0][0] != "key_id" {
+			t.Fatalf("unexpected CSV %v", rows)
+		}
+		requests := map[string]string{}
+		for _, row := range rows[1:] {
+			if row[2] != "2025-05-02" {
+				t.Errorf("unexpected date in %v", row)
+			}
+			requests[row[1]] = row[3]
+		}
+		if requests["team-a"] != "2" || requests["team-b"] != "5" {
+			t.Errorf("unexpected CSV %v", rows)
+		}
+	})
+
+	t.Run("requires admin", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		api.AdminUsageHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/usage", nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401", rec.Code)
+		}
+	})
+}
@@ -1,39 +1,24 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/jpeg"
 	_ "image/png"
+	"io"
+	"log/slog"
 	"net/http"
-	"os"
 	"time"
 	"wave-generator/models"
 	"wave-generator/services"
-
-	"github.com/redis/go-redis/v9"
-	"golang.org/x/net/context"
-)
-
-var (
-	redisAddr   = getenv("REDIS_ADDR", "localhost:6379")
-	redisClient = redis.NewClient(&redis.Options{Addr: redisAddr})
-	rateLimit   = 1000 // requests per hour per API key
 )
 
-// GenerateAPIKeyHandler generates a new API key (simple UUID, not secure for prod).
-func GenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "POST only", http.StatusMethodNotAllowed)
-		return
-	}
-	key := "api_" + fmt.Sprintf("%d", time.Now().UnixNano())
-	redisClient.Set(context.Background(), "apikey:"+key, "1", 0)
-	if err := json.NewEncoder(w).Encode(map[string]string{"api_key": key}); err != nil {
-		http.Error(w, "encoding error", http.StatusInternalServerError)
-	}
-}
+// defaultMaxUploadBytes bounds uploads when MaxUploadBytes is not set.
+const defaultMaxUploadBytes = 32 << 20
 
 // WavePatternHandler processes HTTP requests to extract wave patterns from an image.
 // It accepts only POST requests with an image in the request body.
@@ -44,161 +29,196 @@ func GenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 // 4. Fits polynomial segments to represent the pattern
 // 5. Generates an SVG representation of the pattern
 //
+// The svg_mode query parameter selects the SVG output: "polyline" (default)
+// emits one vertex per pixel column, "path" emits one cubic Bézier per segment.
+// Further query parameters control the styling (see parseSVGStyle).
+// With format=png the wave is rasterized and returned as image/png instead
+// of JSON; overlay=true draws it on top of the uploaded image. debug=true
+// adds a diagnostic overlay (source image, raw coords, fitted curve, segment
+// boundaries and residuals) with residual statistics to the JSON response,
+// or returns the diagnostic image itself with format=png. export lists code
+// generation targets whose output is returned in the exports object.
+//
 // Returns a JSON response containing:
 // - The calculated pattern segments
 // - An SVG representation of the pattern
 //
+// Results are cached by the SHA-256 of the image and a hash of the options
+// (see resultKey) and carry an ETag; a request whose If-None-Match lists
+// it gets 304 Not Modified. X-Cache reports HIT or MISS.
+//
+// Requests from the bundled UI (see isSameOrigin) need no key and are rate
+// limited per client IP; all others must send a valid X-API-Key and are
+// rate limited per key according to its tier. RateLimit-* headers report
+// the state of the bucket. Requests made with a key count towards its
+// monthly quota and are metered (see recordUsage).
+//
 // Responds with appropriate HTTP errors if:
 // - The request method is not POST (405 Method Not Allowed)
+// - The API key is missing or invalid (401 Unauthorized)
+// - The rate limit or monthly quota is exceeded (429 Too Many Requests)
+// - The body is larger than MaxUploadBytes (413 Content Too Large)
 // - The image cannot be decoded (400 Bad Request)
-func WavePatternHandler(w http.ResponseWriter, r *http.Request) {
+func (a *API) WavePatternHandler(w http.ResponseWriter, r *http.Request) {
+	// pixels is the size of the decoded image, metered per API key
+	var pixels int64
 
-	isSameOrigin := true
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, r, http.MethodPost, "Use POST with image in body")
+		return
+	}
 
-	var apiKey string
-	if !isSameOrigin {
-		apiKey = r.Header.Get("X-API-Key")
-		if apiKey == "" {
-			http.Error(w, "Missing X-API-Key header", http.StatusUnauthorized)
+	if a.isSameOrigin(r) {
+		// UI requests carry no key and are limited per client IP
+		if !a.allow(w, r, "ip:"+a.clientIP(r), a.AnonymousLimit) {
 			return
 		}
-		ctx := context.Background()
-		// Check if API key exists
-		exists, err := redisClient.Exists(ctx, "apikey:"+apiKey).Result()
-		if err != nil || exists == 0 {
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
-			return
-		}
-		// Rate limit per API key
-		rlKey := "ratelimit:" + apiKey
-		count, err := redisClient.Incr(ctx, rlKey).Result()
-		if err != nil {
-			http.Error(w, "Rate limit error", http.StatusInternalServerError)
-			return
-		}
-		if count == 1 {
-			redisClient.Expire(ctx, rlKey, time.Hour)
-		}
-		if count > int64(rateLimit) {
-			ttl, _ := redisClient.TTL(ctx, rlKey).Result()
-			http.Error(w, "Rate limit exceeded. Try again in "+ttl.String(), http.StatusTooManyRequests)
+	} else {
+		key, ok := a.admitKey(w, r, models.ScopeGenerate)
+		if !ok {
 			return
 		}
+		sw := &statusWriter{ResponseWriter: w}
+		w = sw
+		start := time.Now()
+		defer func() { a.recordUsage(key.ID, start, sw.status, pixels) }()
 	}
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Use POST with image in body", http.StatusMethodNotAllowed)
+	opts, err := a.processOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
 		return
 	}
 
-	img, _, err := image.Decode(r.Body)
+	data, ok := a.readUpload(w, r)
+	if !ok {
+		return
+	}
+	key, err := resultKey(data, opts)
 	if err != nil {
-		fmt.Printf("Error decoding image: %v\n", err)
-		http.Error(w, "Error decoding image: "+err.Error(), http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, err.Error())
+		return
+	}
+	etag := resultETag(key)
+	if etagMatch(r.Header.Get("If-None-Match"), etag) {
+		pixels = configPixels(data)
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+	contentType := "application/json"
+	if opts.PNG {
+		contentType = "image/png"
+	}
+	if body, ok := a.cachedResult(r.Context(), key); ok {
+		pixels = configPixels(data)
+		writeResult(w, contentType, etag, "HIT", body)
+		return
+	}
+
+	release, ok := a.acquire(w, r)
+	if !ok {
+		return
+	}
+	defer release()
 
-	var segments []models.PolySegment
-	var svg string
-	var segmentSVGs []string
-	var coords [][]float64
-
-	func() {
-		defer func() {
-			if r := recover(); r != nil {
-				err = fmt.Errorf("processing error: %v", r)
-			}
-		}()
-
-		b := img.Bounds()
-		wImg, hImg := b.Dx(), b.Dy()
-
-		// Print dimensions of the input image
-		fmt.Printf("Input Image Dimensions: width=%d, height=%d\n", wImg, hImg)
-
-		// Convert the image to grayscale and detect edges
-		edges := services.ToGray(img)
-		pattern := services.ExtractPattern(edges, wImg, hImg)
-		defer func() {
-			if rec := recover(); rec != nil {
-				err = fmt.Errorf("processing error: %v", rec)
-				segments = nil
-				svg = ""
-			}
-		}()
-		segments = services.FitSegments(pattern, wImg)
-		if len(segments) == 0 {
-			err = fmt.Errorf("could not fit any polynomial segments (possibly singular matrix)")
+	start := time.Now()
+	img, _, err := image.Decode(bytes.NewReader(data))
+	services.TimingsFrom(r.Context()).Since(services.StageDecode, start)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidImage, "Error decoding image: "+err.Error())
+		return
+	}
+	pixels = imagePixels(img)
+	logAttrs(r.Context(), slog.Int("width", img.Bounds().Dx()), slog.Int("height", img.Bounds().Dy()))
+
+	ctx, cancel := a.processingContext(r.Context())
+	defer cancel()
+	res, err := services.Process(ctx, img, opts)
+	if err != nil {
+		status, apiErr := a.processingError(err)
+		writeError(w, r, status, apiErr.Code, apiErr.Message)
+		return
+	}
+	observeImage(pixels, res)
+
+	body := res.PNG
+	if !opts.PNG {
+		if body, err = json.Marshal(res.WaveResponse); err != nil {
+			writeError(w, r, http.StatusInternalServerError, models.ErrCodeInternal, "encoding error")
 			return
 		}
+		body = append(body, '\n')
+	}
+	a.cacheResult(r.Context(), key, body)
+	writeResult(w, contentType, etag, "MISS", body)
+}
 
-		// Generate SVG with the same dimensions as the original image
-		svg = services.BuildSVG(wImg, hImg, segments)
-
-		// Print dimensions of the generated SVG
-		fmt.Printf("Generated SVG Dimensions: width=%d, height=%d\n", wImg, hImg)
-
-		// Generate SVG for each segment (mini SVG, width = segment length, height = 40, Y scaled to segment range)
-		const miniHeight = 40
-		for i := range segments {
-			seg := segments[i]
-			width := seg.X1 - seg.X0 + 1
-			if width < 2 {
-				segments[i].SVG = ""
-				segmentSVGs = append(segmentSVGs, "")
-				continue
-			}
-
-			// Calcular el rango Y real del segmento en el SVG global
-			minY, maxY := seg.CoefA3*float64(seg.X0)*float64(seg.X0)*float64(seg.X0)+seg.CoefA2*float64(seg.X0)*float64(seg.X0)+seg.CoefA1*float64(seg.X0)+seg.CoefA0,
-				seg.CoefA3*float64(seg.X1)*float64(seg.X1)*float64(seg.X1)+seg.CoefA2*float64(seg.X1)*float64(seg.X1)+seg.CoefA1*float64(seg.X1)+seg.CoefA0
-			for x := seg.X0; x <= seg.X1; x++ {
-				y := seg.CoefA3*float64(x)*float64(x)*float64(x) + seg.CoefA2*float64(x)*float64(x) + seg.CoefA1*float64(x) + seg.CoefA0
-				if y < minY {
-					minY = y
-				}
-				if y > maxY {
-					maxY = y
-				}
-			}
-			// Generar SVG solo para el segmento, centrando y escalando Y igual que en el SVG global
-			segSVG := services.BuildSVGSegment(seg, width, miniHeight, minY, maxY)
-			segmentSVGs = append(segmentSVGs, segSVG)
-			segments[i].SVG = segSVG
-		}
+// readUpload reads the image uploaded in the body of r, up to
+// MaxUploadBytes, so the whole body can be hashed without letting one
+// request take any amount of memory. It writes the error response when the
+// body cannot be read: 413 when it is too large, 400 otherwise.
+func (a *API) readUpload(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	limit := a.MaxUploadBytes
+	if limit <= 0 {
+		limit = defaultMaxUploadBytes
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.As(err, &maxErr):
+		writeError(w, r, http.StatusRequestEntityTooLarge, models.ErrCodeInvalidRequest, fmt.Sprintf("Image larger than %d bytes", limit))
+		return nil, false
+	case err != nil:
+		writeError(w, r, http.StatusBadRequest, models.ErrCodeInvalidRequest, "Error reading body: "+err.Error())
+		return nil, false
+	}
+	return data, true
+}
 
-		// Add coords (pattern as [][x, y])
-		coords = make([][]float64, len(pattern))
-		for i, y := range pattern {
-			coords[i] = []float64{float64(i), y}
-		}
-	}()
+// writeResult writes a successful /generate-wave response. cache is the
+// X-Cache value: HIT when the body comes from the cache, MISS otherwise.
+func writeResult(w http.ResponseWriter, contentType, etag, cache string, body []byte) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", etag)
+	w.Header().Set("X-Cache", cache)
+	_, _ = w.Write(body)
+}
 
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
-		return
+// processingContext bounds the processing of one image by
+// ProcessingTimeout, when set.
+func (a *API) processingContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if a.ProcessingTimeout <= 0 {
+		return context.WithCancel(ctx)
 	}
+	return context.WithTimeout(ctx, a.ProcessingTimeout)
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(struct {
-		models.ResponsePayload
-		SegmentSVGs []string    `json:"segment_svgs"`
-		Coords      [][]float64 `json:"coords"`
-	}{
-		ResponsePayload: models.ResponsePayload{
-			Segments: segments,
-			SVG:      svg,
-		},
-		SegmentSVGs: segmentSVGs,
-		Coords:      coords,
-	}); err != nil {
-		http.Error(w, "encoding error", http.StatusInternalServerError)
+// processingError maps an error of services.Process to a response: 504
+// when the processing deadline passed, 503 when the request was canceled
+// because the client went away or the server is shutting down, and 422
+// for images the pipeline cannot handle.
+func (a *API) processingError(err error) (int, *models.APIError) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, &models.APIError{Code: models.ErrCodeProcessingTimeout, Message: "Processing took longer than " + a.ProcessingTimeout.String()}
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable, &models.APIError{Code: models.ErrCodeUnavailable, Message: "Request canceled before processing finished"}
 	}
+	return http.StatusUnprocessableEntity, &models.APIError{Code: models.ErrCodeProcessingFailed, Message: err.Error()}
 }
 
-func getenv(key, fallback string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+// configPixels is the size of an encoded image, read from its header. It
+// meters requests answered without decoding the image.
+func configPixels(data []byte) int64 {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0
 	}
-	return fallback
+	return int64(cfg.Width) * int64(cfg.Height)
+}
+
+// imagePixels is the size of img, metered per API key.
+func imagePixels(img image.Image) int64 {
+	return int64(img.Bounds().Dx()) * int64(img.Bounds().Dy())
 }
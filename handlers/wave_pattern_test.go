@@ -2,17 +2,22 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"image"
 	"image/color"
 	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 	"wave-generator/models"
 )
 
 func TestWavePatternHandler(t *testing.T) {
+	api := newTestAPI(t)
+
 	// Create test image with more variation
 	img := image.NewGray(image.Rect(0, 0, 33, 10))
 	for x := 0; x < 33; x++ {
@@ -65,12 +70,13 @@ func TestWavePatternHandler(t *testing.T) {
 			}
 
 			req := httptest.NewRequest(tt.method, "/generate-wave", bytes.NewReader(tt.body))
+			asUI(req)
 			if tt.contentType != "" {
 				req.Header.Set("Content-Type", tt.contentType)
 			}
 			rec := httptest.NewRecorder()
 
-			WavePatternHandler(rec, req)
+			api.WavePatternHandler(rec, req)
 
 			if rec.Code != tt.wantStatus {
 				t.Errorf("got status %d, want %d", rec.Code, tt.wantStatus)
@@ -103,13 +109,265 @@ func TestWavePatternHandler(t *testing.T) {
 		}
 
 		req := httptest.NewRequest(http.MethodPost, "/generate-wave", &buf)
+		asUI(req)
 		req.Header.Set("Content-Type", "image/png")
 		rec := httptest.NewRecorder()
 
-		WavePatternHandler(rec, req)
+		api.WavePatternHandler(rec, req)
 
 		if rec.Code != http.StatusUnprocessableEntity {
 			t.Errorf("expected status 422, got %d", rec.Code)
 		}
 	})
 }
+
+// testWavePNG returns a PNG encoded 33x10 image with a wave-like pattern.
+func testWavePNG(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 33, 10))
+	for x := 0; x < 33; x++ {
+		for y := 0; y < 10; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(((x+y)%10)*25 + 5)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestWavePatternHandler_SVGMode(t *testing.T) {
+	api := newTestAPI(t)
+	buf := testWavePNG(t)
+
+	t.Run("path mode", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave?svg_mode=path", bytes.NewReader(buf.Bytes()))
+		asUI(req)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		var response models.ResponsePayload
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if !strings.Contains(response.SVG, "<path") || strings.Contains(response.SVG, "<polyline") {
+			t.Errorf("expected path SVG, got %s", response.SVG)
+		}
+	})
+
+	t.Run("invalid mode", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave?svg_mode=bogus", bytes.NewReader(buf.Bytes()))
+		asUI(req)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("got status %d, want 400", rec.Code)
+		}
+	})
+}
+
+func TestWavePatternHandler_PNG(t *testing.T) {
+	api := newTestAPI(t)
+	buf := testWavePNG(t)
+
+	for _, target := range []string{
+		"/generate-wave?format=png&stroke=red&stroke_width=2",
+		"/generate-wave?format=png&overlay=true&fill=below&gradient=navy,teal",
+	} {
+		t.Run(target, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(buf.Bytes()))
+			asUI(req)
+			rec := httptest.NewRecorder()
+			api.WavePatternHandler(rec, req)
+
+			if rec.Code != http.StatusOK {
+				t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "image/png" {
+				t.Errorf("got Content-Type %q, want image/png", ct)
+			}
+			out, err := png.Decode(rec.Body)
+			if err != nil {
+				t.Fatalf("response is not a PNG: %v", err)
+			}
+			if out.Bounds().Dx() != 33 || out.Bounds().Dy() != 10 {
+				t.Errorf("got bounds %v, want 33x10", out.Bounds())
+			}
+		})
+	}
+
+	for _, target := range []string{
+		"/generate-wave?overlay=true",
+		"/generate-wave?format=gif",
+		"/generate-wave?format=png&stroke=rebeccapurple",
+	} {
+		t.Run(target, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, target, bytes.NewReader(buf.Bytes()))
+			asUI(req)
+			rec := httptest.NewRecorder()
+			api.WavePatternHandler(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want 400", rec.Code)
+			}
+		})
+	}
+}
+
+func TestWavePatternHandler_Debug(t *testing.T) {
+	api := newTestAPI(t)
+	buf := testWavePNG(t)
+
+	t.Run("json", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave?debug=true", bytes.NewReader(buf.Bytes()))
+		asUI(req)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Debug *models.DebugInfo `json:"debug"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if response.Debug == nil || !strings.Contains(response.Debug.SVG, "<image") {
+			t.Fatalf("expected debug overlay in response, got %+v", response.Debug)
+		}
+		if len(response.Debug.SegmentRMSE) == 0 {
+			t.Error("expected per-segment residuals")
+		}
+	})
+
+	t.Run("png", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave?debug=true&format=png", bytes.NewReader(buf.Bytes()))
+		asUI(req)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+		}
+		if _, err := png.Decode(rec.Body); err != nil {
+			t.Fatalf("response is not a PNG: %v", err)
+		}
+	})
+
+	t.Run("without debug", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/generate-wave", bytes.NewReader(buf.Bytes()))
+		asUI(req)
+		rec := httptest.NewRecorder()
+		api.WavePatternHandler(rec, req)
+
+		if strings.Contains(rec.Body.String(), `"debug"`) {
+			t.Error("debug object should be omitted unless requested")
+		}
+	})
+}
+
+func TestWavePatternHandler_Export(t *testing.T) {
+	api := newTestAPI(t)
+	buf := testWavePNG(t)
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave?export=go,glsl,css", bytes.NewReader(buf.Bytes()))
+	asUI(req)
+	rec := httptest.NewRecorder()
+	api.WavePatternHandler(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	var response struct {
+		Exports map[string]string `json:"exports"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if len(response.Exports) != 3 || !strings.Contains(response.Exports["glsl"], "float wave(float x)") {
+		t.Errorf("unexpected exports: %v", response.Exports)
+	}
+}
+
+func TestWavePatternHandler_Deadline(t *testing.T) {
+	api := newTestAPI(t)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name     string
+		timeout  time.Duration
+		ctx      context.Context
+		want     int
+		wantCode string
+	}{
+		{"deadline passed", time.Nanosecond, context.Background(), http.StatusGatewayTimeout, models.ErrCodeProcessingTimeout},
+		{"client gone", 0, canceled, http.StatusServiceUnavailable, models.ErrCodeUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api.ProcessingTimeout = tt.timeout
+			req := httptest.NewRequestWithContext(tt.ctx, http.MethodPost, "/generate-wave", testWavePNG(t))
+			asUI(req)
+			rec := httptest.NewRecorder()
+			api.WavePatternHandler(rec, req)
+			var body models.ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.want || body.Error.Code != tt.wantCode {
+				t.Errorf("got status %d (%s), want %d (%s)", rec.Code, body.Error.Code, tt.want, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestWavePatternHandler_TooLarge(t *testing.T) {
+	api := newTestAPI(t)
+	img := testWavePNG(t)
+	api.MaxUploadBytes = int64(img.Len()) - 1
+
+	req := httptest.NewRequest(http.MethodPost, "/generate-wave", img)
+	asUI(req)
+	rec := httptest.NewRecorder()
+	api.WavePatternHandler(rec, req)
+	var body models.ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusRequestEntityTooLarge || body.Error.Code != models.ErrCodeInvalidRequest {
+		t.Errorf("got status %d (%s), want 413", rec.Code, body.Error.Code)
+	}
+}
+
+func TestWavePatternHandler_NonFiniteOptions(t *testing.T) {
+	api := newTestAPI(t)
+	_, key, err := api.issueAPIKey(context.Background(), models.APIKey{Scopes: defaultScopes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(api.WavePatternHandler))
+	defer srv.Close()
+
+	for _, query := range []string{"stroke_width=NaN", "layer_offset=NaN", "layer_offset=Inf&layers=2", "stroke_width=-Inf"} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/generate-wave?"+query, testWavePNG(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-API-Key", key)
+		res, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var body models.ErrorResponse
+		err = json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+		if err != nil || res.StatusCode != http.StatusBadRequest || body.Error.Code != models.ErrCodeInvalidRequest {
+			t.Errorf("%s: got status %d (%s), want 400 invalid_request", query, res.StatusCode, body.Error.Code)
+		}
+	}
+}
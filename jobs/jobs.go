@@ -0,0 +1,403 @@
+// Package jobs runs image processing asynchronously on a bounded pool of
+// workers and keeps finished jobs for a limited time.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"sync"
+	"time"
+	"wave-generator/models"
+)
+
+var (
+	// ErrNotFound is returned for unknown and expired jobs.
+	ErrNotFound = errors.New("job not found")
+	// ErrQueueFull is returned by Submit when every queue slot is taken.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrFinished is returned when canceling a job in a final state.
+	ErrFinished = errors.New("job already finished")
+	// ErrClosed is returned by Submit after Close.
+	ErrClosed = errors.New("job manager closed")
+)
+
+// Func processes a job. Its context is canceled when the job is canceled,
+// runs for longer than Config.Timeout or the manager is closed.
+type Func func(ctx context.Context) (*models.WaveResponse, error)
+
+// Config sizes a Manager. Zero fields take the defaults below.
+type Config struct {
+	// Workers is the number of jobs processed concurrently.
+	Workers int
+	// QueueSize is the number of jobs that may wait for a worker.
+	QueueSize int
+	// TTL is how long finished jobs and their results are kept.
+	TTL time.Duration
+	// Timeout bounds the processing of each job.
+	Timeout time.Duration
+	// WebhookTimeout bounds each webhook delivery.
+	WebhookTimeout time.Duration
+	// AllowPrivateWebhooks lets webhooks reach loopback, private and
+	// link-local addresses; see ErrWebhookBlocked.
+	AllowPrivateWebhooks bool
+}
+
+// Defaults for zero Config fields; Workers defaults to the number of CPUs.
+const (
+	DefaultQueueSize      = 100
+	DefaultTTL            = time.Hour
+	DefaultTimeout        = 10 * time.Minute
+	DefaultWebhookTimeout = 10 * time.Second
+)
+
+// Manager queues jobs, runs them on its workers and keeps them in memory,
+// so jobs are only visible on the instance that accepted them.
+type Manager struct {
+	cfg     Config
+	client  *http.Client
+	now     func() time.Time
+	queue   chan string
+	ctx     context.Context
+	stop    context.CancelFunc
+	workers sync.WaitGroup
+	hooks   sync.WaitGroup // webhook deliveries
+
+	mu      sync.Mutex
+	jobs    map[string]*entry
+	closed  bool // no more submissions; the queue is closed
+	stopped bool // workers done; no more webhooks
+}
+
+type entry struct {
+	job    models.Job
+	run    Func
+	cancel context.CancelFunc // set while running
+}
+
+// NewManager starts the workers of a new Manager. Call Close to stop them.
+func NewManager(cfg Config) *Manager {
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultTTL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.WebhookTimeout <= 0 {
+		cfg.WebhookTimeout = DefaultWebhookTimeout
+	}
+	ctx, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		cfg:    cfg,
+		client: newWebhookClient(cfg),
+		now:    time.Now,
+		queue:  make(chan string, cfg.QueueSize),
+		ctx:    ctx,
+		stop:   stop,
+		jobs:   make(map[string]*entry),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		m.workers.Add(1)
+		go m.work()
+	}
+	return m
+}
+
+// Submit queues run as a new job of the API key keyID. When webhookURL is
+// set, the job is POSTed to it as JSON once it reaches a final state; it
+// must not address a blocked host (ErrWebhookBlocked).
+func (m *Manager) Submit(keyID, webhookURL string, run Func) (models.Job, error) {
+	if webhookURL != "" && !m.cfg.AllowPrivateWebhooks {
+		if err := checkWebhookURL(webhookURL); err != nil {
+			return models.Job{}, err
+		}
+	}
+	id, err := newJobID()
+	if err != nil {
+		return models.Job{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return models.Job{}, ErrClosed
+	}
+	m.sweep()
+	e := &entry{
+		job: models.Job{
+			ID:         id,
+			Status:     models.JobQueued,
+			KeyID:      keyID,
+			WebhookURL: webhookURL,
+			CreatedAt:  m.now().UTC(),
+		},
+		run: run,
+	}
+	select {
+	case m.queue <- id:
+	default:
+		return models.Job{}, ErrQueueFull
+	}
+	m.jobs[id] = e
+	return e.job, nil
+}
+
+// Get returns the current state of a job.
+func (m *Manager) Get(id string) (models.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.lookup(id)
+	if !ok {
+		return models.Job{}, ErrNotFound
+	}
+	return e.job, nil
+}
+
+// Cancel stops a queued or running job. A running job's context is
+// canceled; whatever it returns afterwards is discarded.
+func (m *Manager) Cancel(id string) (models.Job, error) {
+	m.mu.Lock()
+	e, ok := m.lookup(id)
+	if !ok {
+		m.mu.Unlock()
+		return models.Job{}, ErrNotFound
+	}
+	if e.job.Done() {
+		m.mu.Unlock()
+		return e.job, ErrFinished
+	}
+	if e.cancel != nil {
+		e.cancel()
+	}
+	m.finish(e, models.JobCanceled)
+	job := e.job
+	m.mu.Unlock()
+	m.notify(job)
+	return job, nil
+}
+
+// Stats is a snapshot of the load of a Manager.
+type Stats struct {
+	Workers   int
+	Running   int
+	Queued    int
+	QueueSize int
+	// Closed is set once the manager stops accepting jobs.
+	Closed bool
+}
+
+// Stats returns the current load of the manager.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Stats{
+		Workers:   m.cfg.Workers,
+		Queued:    len(m.queue),
+		QueueSize: m.cfg.QueueSize,
+		Closed:    m.closed,
+	}
+	for _, e := range m.jobs {
+		if e.job.Status == models.JobRunning {
+			s.Running++
+		}
+	}
+	return s
+}
+
+// Close cancels running jobs, stops the workers and waits for them and for
+// pending webhook deliveries. Queued jobs are dropped.
+func (m *Manager) Close() {
+	m.stop()
+	m.drain()
+}
+
+// Shutdown stops accepting jobs and waits for the queued and running ones
+// to finish and for their webhook deliveries. If ctx is done first, the
+// remaining jobs are canceled as by Close and ctx.Err() is returned.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.drain()
+		close(done)
+	}()
+	select {
+	case <-done:
+		m.stop()
+		return nil
+	case <-ctx.Done():
+		m.stop()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// drain closes the queue, then waits for the workers and, once they are
+// done, for the webhook deliveries.
+func (m *Manager) drain() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		close(m.queue)
+	}
+	m.mu.Unlock()
+	m.workers.Wait()
+
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+	m.hooks.Wait()
+}
+
+func (m *Manager) work() {
+	defer m.workers.Done()
+	for {
+		select {
+		case <-m.ctx.Done():
+			return
+		case id, ok := <-m.queue:
+			if !ok || m.ctx.Err() != nil {
+				return
+			}
+			m.process(id)
+		}
+	}
+}
+
+func (m *Manager) process(id string) {
+	m.mu.Lock()
+	e, ok := m.jobs[id]
+	if !ok || e.job.Status != models.JobQueued {
+		// canceled while queued
+		m.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithTimeout(m.ctx, m.cfg.Timeout)
+	defer cancel()
+	started := m.now().UTC()
+	e.job.Status = models.JobRunning
+	e.job.StartedAt = &started
+	e.cancel = cancel
+	m.mu.Unlock()
+
+	res, err := e.run(ctx)
+
+	m.mu.Lock()
+	if e.job.Status != models.JobRunning {
+		m.mu.Unlock()
+		return
+	}
+	e.cancel = nil
+	if err != nil {
+		var apiErr *models.APIError
+		switch {
+		case errors.As(err, &apiErr):
+			// reported as is
+		case errors.Is(err, context.DeadlineExceeded):
+			apiErr = &models.APIError{Code: models.ErrCodeProcessingTimeout, Message: "Processing took longer than " + m.cfg.Timeout.String()}
+		default:
+			apiErr = &models.APIError{Code: models.ErrCodeProcessingFailed, Message: err.Error()}
+		}
+		e.job.Error = apiErr
+		m.finish(e, models.JobFailed)
+	} else {
+		e.job.Result = res
+		m.finish(e, models.JobSucceeded)
+	}
+	job := e.job
+	m.mu.Unlock()
+	m.notify(job)
+}
+
+// finish moves e to a final status. Callers hold m.mu.
+func (m *Manager) finish(e *entry, status string) {
+	now := m.now().UTC()
+	expires := now.Add(m.cfg.TTL)
+	e.job.Status = status
+	e.job.FinishedAt = &now
+	e.job.ExpiresAt = &expires
+}
+
+// lookup returns a job that has not expired. Callers hold m.mu.
+func (m *Manager) lookup(id string) (*entry, bool) {
+	e, ok := m.jobs[id]
+	if !ok || e.expired(m.now()) {
+		return nil, false
+	}
+	return e, true
+}
+
+// sweep drops expired jobs. Callers hold m.mu.
+func (m *Manager) sweep() {
+	now := m.now()
+	for id, e := range m.jobs {
+		if e.expired(now) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return e.job.ExpiresAt != nil && !now.Before(*e.job.ExpiresAt)
+}
+
+// notify delivers a finished job to its webhook in the background. A
+// failed delivery is logged and not retried.
+func (m *Manager) notify(job models.Job) {
+	if job.WebhookURL == "" {
+		return
+	}
+	m.mu.Lock()
+	if m.stopped || m.ctx.Err() != nil {
+		m.mu.Unlock()
+		return
+	}
+	m.hooks.Add(1)
+	m.mu.Unlock()
+	go func() {
+		defer m.hooks.Done()
+		if err := m.deliver(job); err != nil {
+			slog.Warn("delivering webhook", "job_id", job.ID, "err", err)
+		}
+	}()
+}
+
+func (m *Manager) deliver(job models.Job) error {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(m.ctx, http.MethodPost, job.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wave-generator")
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New("unexpected status " + resp.Status)
+	}
+	return nil
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
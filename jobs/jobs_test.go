@@ -0,0 +1,324 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"wave-generator/models"
+)
+
+// wait polls a job until it is done.
+func wait(t *testing.T, m *Manager, id string) models.Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Get(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Done() {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", id, job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManager(t *testing.T) {
+	m := NewManager(Config{Workers: 2})
+	defer m.Close()
+
+	result := &models.WaveResponse{ResponsePayload: models.ResponsePayload{SVG: "<svg/>"}}
+	job, err := m.Submit("key1", "", func(context.Context) (*models.WaveResponse, error) {
+		return result, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Status != models.JobQueued || job.KeyID != "key1" || job.ID == "" {
+		t.Errorf("unexpected job %+v", job)
+	}
+	if job = wait(t, m, job.ID); job.Status != models.JobSucceeded || job.Result != result || job.StartedAt == nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+
+	failed, err := m.Submit("key1", "", func(context.Context) (*models.WaveResponse, error) {
+		return nil, errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed = wait(t, m, failed.ID)
+	if failed.Status != models.JobFailed || failed.Error == nil || failed.Error.Code != models.ErrCodeProcessingFailed || failed.Error.Message != "boom" {
+		t.Errorf("unexpected job %+v", failed)
+	}
+
+	if _, err := m.Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+	if _, err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("got %v, want ErrFinished", err)
+	}
+}
+
+func TestManager_Cancel(t *testing.T) {
+	m := NewManager(Config{Workers: 1})
+	defer m.Close()
+
+	started := make(chan struct{})
+	running, err := m.Submit("k", "", func(ctx context.Context) (*models.WaveResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return &models.WaveResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued, err := m.Submit("k", "", func(context.Context) (*models.WaveResponse, error) {
+		t.Error("canceled job must not run")
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{queued.ID, running.ID} {
+		job, err := m.Cancel(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != models.JobCanceled || job.FinishedAt == nil {
+			t.Errorf("unexpected job %+v", job)
+		}
+	}
+	// The running job returns a result after being canceled; it is dropped.
+	time.Sleep(20 * time.Millisecond)
+	if job, _ := m.Get(running.ID); job.Status != models.JobCanceled || job.Result != nil {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestManager_Timeout(t *testing.T) {
+	m := NewManager(Config{Workers: 1, Timeout: 10 * time.Millisecond})
+	defer m.Close()
+
+	job, err := m.Submit("k", "", func(ctx context.Context) (*models.WaveResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job = wait(t, m, job.ID); job.Status != models.JobFailed || job.Error == nil || job.Error.Code != models.ErrCodeProcessingTimeout {
+		t.Errorf("unexpected job %+v", job)
+	}
+}
+
+func TestManager_QueueFull(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 1})
+	release := make(chan struct{})
+	defer func() {
+		close(release)
+		m.Close()
+	}()
+	block := func(context.Context) (*models.WaveResponse, error) {
+		<-release
+		return nil, nil
+	}
+
+	started := make(chan struct{})
+	if _, err := m.Submit("k", "", func(ctx context.Context) (*models.WaveResponse, error) {
+		close(started)
+		return block(ctx)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := m.Submit("k", "", block); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Submit("k", "", block); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("got %v, want ErrQueueFull", err)
+	}
+}
+
+func TestManager_TTL(t *testing.T) {
+	m := NewManager(Config{Workers: 1, TTL: time.Minute})
+	defer m.Close()
+	now := time.Now()
+	m.mu.Lock()
+	m.now = func() time.Time { return now }
+	m.mu.Unlock()
+
+	job, err := m.Submit("k", "", func(context.Context) (*models.WaveResponse, error) {
+		return &models.WaveResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = wait(t, m, job.ID)
+	if !job.ExpiresAt.Equal(now.Add(time.Minute)) {
+		t.Errorf("got expiry %v, want %v", job.ExpiresAt, now.Add(time.Minute))
+	}
+
+	m.mu.Lock()
+	now = now.Add(time.Minute)
+	m.sweep()
+	_, kept := m.jobs[job.ID]
+	m.mu.Unlock()
+	if kept {
+		t.Error("expected the expired job to be swept")
+	}
+	if _, err := m.Get(job.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+}
+
+func TestManager_Webhook(t *testing.T) {
+	delivered := make(chan models.Job, 2)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("unexpected webhook request %s %v", r.Method, r.Header)
+		}
+		var job models.Job
+		if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+			t.Error(err)
+		}
+		delivered <- job
+	}))
+	defer hook.Close()
+
+	// The stub listens on loopback
+	m := NewManager(Config{Workers: 1, AllowPrivateWebhooks: true})
+	defer m.Close()
+	job, err := m.Submit("k", hook.URL, func(context.Context) (*models.WaveResponse, error) {
+		return nil, errors.New("boom")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case got := <-delivered:
+		if got.ID != job.ID || got.Status != models.JobFailed || got.Error == nil {
+			t.Errorf("unexpected webhook payload %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook not delivered")
+	}
+}
+
+func TestManager_Close(t *testing.T) {
+	m := NewManager(Config{Workers: 1})
+	started := make(chan struct{})
+	job, err := m.Submit("k", "", func(ctx context.Context) (*models.WaveResponse, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	m.Close()
+	if job, _ = m.Get(job.ID); job.Status != models.JobFailed {
+		t.Errorf("got status %s, want failed", job.Status)
+	}
+	if _, err := m.Submit("k", "", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed", err)
+	}
+}
+
+func TestManager_Shutdown(t *testing.T) {
+	m := NewManager(Config{Workers: 1})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	running, err := m.Submit("k", "", func(context.Context) (*models.WaveResponse, error) {
+		close(started)
+		<-release
+		return &models.WaveResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued, err := m.Submit("k", "", func(context.Context) (*models.WaveResponse, error) {
+		return &models.WaveResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- m.Shutdown(context.Background()) }()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := m.Submit("k", "", nil); !errors.Is(err, ErrClosed) {
+		t.Errorf("got %v, want ErrClosed while shutting down", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{running.ID, queued.ID} {
+		if job, _ := m.Get(id); job.Status != models.JobSucceeded {
+			t.Errorf("job %s: got status %s, want drained jobs to succeed", id, job.Status)
+		}
+	}
+}
+
+func TestManager_ShutdownTimeout(t *testing.T) {
+	m := NewManager(Config{Workers: 1})
+	job, err := m.Submit("k", "", func(ctx context.Context) (*models.WaveResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want context.DeadlineExceeded", err)
+	}
+	if job, _ = m.Get(job.ID); job.Status != models.JobFailed {
+		t.Errorf("got status %s, want the unfinished job canceled", job.Status)
+	}
+}
+
+func TestManager_Stats(t *testing.T) {
+	m := NewManager(Config{Workers: 1, QueueSize: 2})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer m.Close()
+	if _, err := m.Submit("k", "", func(context.Context) (*models.WaveResponse, error) {
+		close(started)
+		<-release
+		return &models.WaveResponse{}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if _, err := m.Submit("k", "", func(context.Context) (*models.WaveResponse, error) {
+		return &models.WaveResponse{}, nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := Stats{Workers: 1, Running: 1, Queued: 1, QueueSize: 2}
+	if got := m.Stats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	close(release)
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.Stats(); !got.Closed || got.Running != 0 || got.Queued != 0 {
+		t.Errorf("got %+v after shutdown", got)
+	}
+}
@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// ErrWebhookBlocked is returned for webhooks addressed to loopback,
+// private, link-local or other non-public hosts, unless
+// Config.AllowPrivateWebhooks is set.
+var ErrWebhookBlocked = errors.New("webhook address not allowed")
+
+// blockedPrefixes are the non-public ranges netip.Addr has no method for.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT, some cloud metadata
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 of IPv4 addresses
+}
+
+// PublicAddr reports whether ip may receive webhooks: it is not loopback,
+// private, link-local (which holds the 169.254.169.254 metadata address),
+// multicast, unspecified or otherwise reserved.
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, p := range blockedPrefixes {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkWebhookURL rejects webhook URLs whose host is a blocked IP address
+// or localhost. Other host names are checked when they are dialed.
+func checkWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrWebhookBlocked
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !PublicAddr(ip) {
+		return ErrWebhookBlocked
+	}
+	return nil
+}
+
+// checkWebhookAddr is the dialer Control of webhook deliveries: it runs
+// after name resolution for every connection, redirects included, so a
+// host name cannot point deliveries at a blocked address.
+func checkWebhookAddr(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !PublicAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", ErrWebhookBlocked, ap.Addr())
+	}
+	return nil
+}
+
+// newWebhookClient returns the client delivering webhooks. Unless private
+// webhooks are allowed, it only connects to public addresses and ignores
+// the proxy settings, as the proxy would be checked instead of the host.
+func newWebhookClient(cfg Config) *http.Client {
+	if cfg.AllowPrivateWebhooks {
+		return &http.Client{Timeout: cfg.WebhookTimeout}
+	}
+	dialer := &net.Dialer{Timeout: cfg.WebhookTimeout, Control: checkWebhookAddr}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: cfg.WebhookTimeout, Transport: transport}
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"wave-generator/models"
+)
+
+func TestPublicAddr(t *testing.T) {
+	for addr, want := range map[string]bool{
+		"93.184.216.34":        true,
+		"2606:4700::1111":      true,
+		"127.0.0.1":            false,
+		"::1":                  false,
+		"10.1.2.3":             false,
+		"172.16.0.1":           false,
+		"192.168.1.1":          false,
+		"169.254.169.254":      false,
+		"100.100.100.200":      false,
+		"0.0.0.0":              false,
+		"::":                   false,
+		"fd00:ec2::254":        false,
+		"fe80::1":              false,
+		"::ffff:127.0.0.1":     false,
+		"64:ff9b::a9fe:a9fe":   false,
+		"255.255.255.255":      false,
+		"224.0.0.1":            false,
+		"::ffff:93.184.216.34": true,
+	} {
+		if got := PublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("PublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestManager_Submit_BlockedWebhook(t *testing.T) {
+	m := NewManager(Config{Workers: 1})
+	defer m.Close()
+	for _, raw := range []string{
+		"http://127.0.0.1:9000/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://localhost/hook",
+		"http://api.localhost./hook",
+	} {
+		if _, err := m.Submit("k", raw, nil); !errors.Is(err, ErrWebhookBlocked) {
+			t.Errorf("Submit(%s): got %v, want ErrWebhookBlocked", raw, err)
+		}
+	}
+	if _, err := m.Submit("k", "https://example.com/hook", func(ctx context.Context) (*models.WaveResponse, error) {
+		// Never finishes before Close, so nothing is delivered
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}); err != nil {
+		t.Errorf("public webhook: %v", err)
+	}
+}
+
+func TestManager_Deliver_BlockedAddress(t *testing.T) {
+	called := false
+	hook := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { called = true }))
+	defer hook.Close()
+
+	m := NewManager(Config{Workers: 1})
+	defer m.Close()
+	// Host names are only resolved when dialing; 127.0.0.1 stands for one
+	// resolving to a blocked address.
+	err := m.deliver(models.Job{ID: "j", WebhookURL: hook.URL})
+	if !errors.Is(err, ErrWebhookBlocked) || called {
+		t.Errorf("got %v (delivered %v), want ErrWebhookBlocked", err, called)
+	}
+}
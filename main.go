@@ -1,71 +1,307 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"wave-generator/config"
 	"wave-generator/handlers"
+	"wave-generator/metrics"
+	"wave-generator/storage"
 )
 
-func setupHandlers(mux *http.ServeMux) error {
+func setupHandlers(mux *http.ServeMux, api *handlers.API) error {
 	if mux == nil {
 		return fmt.Errorf("nil ServeMux provided")
 	}
+	if api == nil {
+		return fmt.Errorf("nil API provided")
+	}
 
-	// Serve static files from the static directory
-	fs := http.FileServer(http.Dir("static"))
-	mux.Handle("/static/", http.StripPrefix("/static/", fs))
+	// Pages and their assets carry the configured Content-Security-Policy
+	page := func(h http.HandlerFunc) http.HandlerFunc {
+		return handlers.WithSecurityHeaders(api.ContentSecurityPolicy, h)
+	}
+	// Serve the files of the static directory
+	mux.HandleFunc("/static/", page(api.StaticHandler))
 
 	// Serve docs as static markdown rendered HTML
-	mux.HandleFunc("/docs/api-docs", logHandler(handlers.APIDocsHandler))
+	mux.HandleFunc("/docs/api-docs", logHandler(page(api.APIDocsHandler)))
 
 	// Blog post handler
-	mux.HandleFunc("/blog/wave-generator-math-tutorial", logHandler(handlers.BlogPostHandler))
+	mux.HandleFunc("/blog/wave-generator-math-tutorial", logHandler(page(api.BlogPostHandler)))
 
-	// API endpoints
-	mux.HandleFunc("/generate-wave", logHandler(handlers.WavePatternHandler))
-	mux.HandleFunc("/generate-apikey", logHandler(handlers.GenerateAPIKeyHandler))
+	// Prometheus metrics and health probes, left out of the request logs
+	// and metrics
+	mux.Handle("GET /metrics", metrics.Default)
+	mux.HandleFunc("GET /healthz", handlers.HealthzHandler)
+	mux.HandleFunc("GET /readyz", api.ReadyzHandler)
+
+	// API endpoints, versioned under /v1 with the original paths kept as
+	// aliases for existing clients
+	routes := apiRoutes(api)
+	methods := make(map[string][]string)
+	for _, rt := range routes {
+		methods[rt.path] = append(methods[rt.path], rt.allowedMethod())
+	}
+	register := func(rt route, h http.HandlerFunc) {
+		h = handlers.WithSecurityHeaders(handlers.APIContentSecurityPolicy, h)
+		mux.HandleFunc(rt.pattern(apiVersion), logHandler(h))
+		if rt.legacy {
+			mux.HandleFunc(rt.pattern(""), logHandler(deprecated(h)))
+		}
+	}
+	preflight := make(map[string]bool)
+	for _, rt := range routes {
+		h := rt.handler
+		if policy := corsPolicy(api, rt.cors, methods[rt.path]); policy != nil {
+			h = policy.Handler(h)
+			// Routes registered with a method need an OPTIONS route of
+			// their own to answer preflight requests
+			if rt.method != "" && !preflight[rt.path] {
+				preflight[rt.path] = true
+				options := rt
+				options.method = http.MethodOptions
+				register(options, policy.Handler(allowHandler(methods[rt.path])))
+			}
+		}
+		register(rt, h)
+	}
 
 	// Root handler must be last
-	mux.HandleFunc("/", logHandler(handlers.IndexHandler))
+	mux.HandleFunc("/", logHandler(page(api.IndexHandler)))
 
 	return nil
 }
 
-func logHandler(next http.HandlerFunc) http.HandlerFunc {
+// apiVersion prefixes the current API routes.
+const apiVersion = "/v1"
+
+// route is an API endpoint. Handlers that check the method themselves are
+// registered without one so they can answer 405 in the API error format.
+type route struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+	// legacy routes are also served without the version prefix.
+	legacy bool
+	cors   corsScope
+}
+
+// allowedMethod is the method of the route; those registered without one
+// accept POST.
+func (rt route) allowedMethod() string {
+	if rt.method == "" {
+		return http.MethodPost
+	}
+	return rt.method
+}
+
+// corsScope selects the origins that may call a route from a browser.
+type corsScope int
+
+const (
+	// corsNone leaves the route to same-origin callers, e.g. the admin
+	// endpoints.
+	corsNone corsScope = iota
+	// corsPublic allows API key clients from CORS_ORIGINS and the UI from
+	// TRUSTED_ORIGINS.
+	corsPublic
+	// corsSession only allows the UI from TRUSTED_ORIGINS.
+	corsSession
+)
+
+// corsPolicy returns the policy of scope for a path served with methods,
+// or nil for corsNone.
+func corsPolicy(api *handlers.API, scope corsScope, methods []string) *handlers.CORSPolicy {
+	switch scope {
+	case corsPublic:
+		return api.PublicCORS(methods...)
+	case corsSession:
+		return api.SessionCORS(methods...)
+	}
+	return nil
+}
+
+// allowHandler answers OPTIONS requests that are not preflight requests
+// with the methods of the path.
+func allowHandler(methods []string) http.HandlerFunc {
+	allow := strings.Join(append(slices.Clone(methods), http.MethodOptions), ", ")
 	return func(w http.ResponseWriter, r *http.Request) {
-		// CORS headers for all responses
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		log.Printf("Request: %s %s", r.Method, r.URL.Path)
+		w.Header().Set("Allow", allow)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (rt route) pattern(prefix string) string {
+	if rt.method == "" {
+		return prefix + rt.path
+	}
+	return rt.method + " " + prefix + rt.path
+}
+
+// apiRoutes lists the API endpoints. docs/openapi.yaml documents each of
+// them under /v1 (see TestOpenAPIConformance).
+func apiRoutes(api *handlers.API) []route {
+	return []route{
+		{"", "/generate-wave", api.WavePatternHandler, true, corsPublic},
+		{"", "/generate-apikey", api.GenerateAPIKeyHandler, true, corsSession},
+		{"", "/export-code", handlers.ExportCodeHandler, true, corsPublic},
+		{http.MethodGet, "/usage", api.UsageHandler, false, corsPublic},
+
+		// Asynchronous processing
+		{http.MethodPost, "/jobs", api.CreateJobHandler, false, corsPublic},
+		{http.MethodGet, "/jobs/{id}", api.GetJobHandler, false, corsPublic},
+		{http.MethodDelete, "/jobs/{id}", api.CancelJobHandler, false, corsPublic},
+		{http.MethodPost, "/batch", api.BatchHandler, false, corsPublic},
+
+		// API key management and usage reports, protected by ADMIN_TOKEN
+		{http.MethodGet, "/admin/keys", api.ListAPIKeysHandler, true, corsNone},
+		{http.MethodPost, "/admin/keys", api.CreateAPIKeyHandler, true, corsNone},
+		{http.MethodPatch, "/admin/keys/{id}", api.UpdateAPIKeyHandler, true, corsNone},
+		{http.MethodPost, "/admin/keys/{id}/rotate", api.RotateAPIKeyHandler, true, corsNone},
+		{http.MethodDelete, "/admin/keys/{id}", api.RevokeAPIKeyHandler, true, corsNone},
+		{http.MethodGet, "/admin/usage", api.AdminUsageHandler, true, corsNone},
+	}
+}
+
+// deprecated marks responses of an unversioned alias and points clients
+// at the versioned route.
+func deprecated(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", "<"+apiVersion+r.URL.Path+`>; rel="successor-version"`)
 		next(w, r)
 	}
 }
 
-func startServer(mux *http.ServeMux) error {
+// logHandler assigns the request ID and logs and measures the request
+// once served.
+func logHandler(next http.HandlerFunc) http.HandlerFunc {
+	return handlers.WithRequestID(handlers.WithLogging(handlers.WithMetrics(next)))
+}
+
+// newServer returns the HTTP server for mux, configured by cfg.
+func newServer(mux *http.ServeMux, cfg config.Server) *http.Server {
+	return &http.Server{
+		Addr:              ":" + strconv.Itoa(cfg.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// startServer serves mux until ctx is canceled, then shuts down
+// gracefully: it stops accepting connections and waits for in-flight
+// requests, then for the queued and running jobs of api. Whatever is still
+// running after cfg.ShutdownTimeout is canceled.
+func startServer(ctx context.Context, mux *http.ServeMux, api *handlers.API, cfg config.Server) error {
 	if mux == nil {
 		return fmt.Errorf("nil ServeMux provided")
 	}
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8899"
+	if api == nil {
+		return fmt.Errorf("nil API provided")
+	}
+	srv := newServer(mux, cfg)
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("starting server", "addr", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
 	}
-	log.Printf("Starting server on port %s", port)
-	return http.ListenAndServe(fmt.Sprintf(":%s", port), mux)
+
+	slog.Info("shutting down, waiting for requests and jobs", "timeout", cfg.ShutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	err := srv.Shutdown(shutdownCtx)
+	<-serveErr // http.ErrServerClosed
+	return errors.Join(err, api.Shutdown(shutdownCtx))
+}
+
+// newStore opens the key and rate-limit store selected by cfg.
+func newStore(cfg config.Storage) (storage.Store, error) {
+	return storage.New(cfg.Backend, cfg.RedisAddr)
+}
+
+// pingStore warns when the store is unreachable at startup. The server
+// starts anyway and /readyz fails until the store is back.
+func pingStore(store storage.Store) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := store.Ping(ctx); err != nil {
+		slog.Warn("storage unreachable", "err", err)
+	}
+}
+
+// newLogger returns the JSON logger of the server, writing to stderr.
+func newLogger(level slog.Level) *slog.Logger {
+	return slog.New(handlers.NewLogHandler(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+}
+
+// fatal logs err and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "err", err)
+	os.Exit(1)
 }
 
 func main() {
+	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	printConfig := flags.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	cfg, err := config.Load(flags, os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "invalid configuration:", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		if err := cfg.Write(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	slog.SetDefault(newLogger(cfg.Level()))
+
+	store, err := newStore(cfg.Storage)
+	if err != nil {
+		fatal("opening storage", err)
+	}
+	defer store.Close()
+	pingStore(store)
+
+	api := handlers.NewAPI(store, cfg)
+	api.Assets = assets
+	defer api.Close()
+
 	mux := http.NewServeMux()
-	if err := setupHandlers(mux); err != nil {
-		log.Fatal("Failed to setup handlers:", err)
+	if err := setupHandlers(mux, api); err != nil {
+		fatal("setting up handlers", err)
 	}
-	if err := startServer(mux); err != nil {
-		log.Fatal("Failed to start server:", err)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if err := startServer(ctx, mux, api, cfg.Server); err != nil {
+		fatal("serving", err)
 	}
+	slog.Info("server stopped")
 }
@@ -5,16 +5,26 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
 	"time"
+	"wave-generator/config"
+	"wave-generator/handlers"
+	"wave-generator/storage"
 )
 
+func newTestAPI() *handlers.API {
+	api := handlers.NewAPI(storage.NewMemory(), config.Default())
+	api.Assets = assets
+	return api
+}
+
 func TestMain(t *testing.T) {
 
 	// Test server setup
 	t.Run("server setup", func(t *testing.T) {
 		mux := http.NewServeMux()
-		if err := setupHandlers(mux); err != nil {
+		if err := setupHandlers(mux, newTestAPI()); err != nil {
 			t.Errorf("setupHandlers failed: %v", err)
 		}
 
@@ -37,6 +47,32 @@ func TestMain(t *testing.T) {
 			t.Errorf("expected status OK for root, got %v", w.Code)
 		}
 
+		// Test metrics endpoint
+		req = httptest.NewRequest("GET", "/metrics", nil)
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `wave_http_requests_total{method="GET",route="/"`) {
+			t.Errorf("expected metrics counting the earlier requests, got %v: %s", w.Code, w.Body.String())
+		}
+
+		// Test health probes
+		req = httptest.NewRequest("GET", "/healthz", nil)
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK for /healthz, got %v", w.Code)
+		}
+
+		req = httptest.NewRequest("GET", "/readyz", nil)
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("expected status OK for /readyz, got %v: %s", w.Code, w.Body.String())
+		}
+
 		// Test API endpoint
 		req = httptest.NewRequest("POST", "/generate-wave", nil)
 		w = httptest.NewRecorder()
@@ -47,63 +83,40 @@ func TestMain(t *testing.T) {
 		}
 	})
 
-	// Test server startup with different PORT configurations
+	// Test server startup with different port configurations
 	t.Run("server port configuration", func(t *testing.T) {
 		tests := []struct {
 			name    string
-			port    string
+			port    int
 			wantErr bool
 		}{
-			{"default port", "", false},
-			{"custom port", "8080", false},
-			{"invalid port", "invalid", true},
+			{"default port", config.Default().Server.Port, false},
+			{"custom port", 8080, false},
+			{"invalid port", 70000, true},
 		}
 
 		for _, tt := range tests {
 			t.Run(tt.name, func(t *testing.T) {
-				if tt.port != "" {
-					if err := os.Setenv("PORT", tt.port); err != nil {
-						t.Fatalf("Setenv failed: %v", err)
-					}
-				} else {
-					if err := os.Unsetenv("PORT"); err != nil {
-						t.Fatalf("Unsetenv failed: %v", err)
-					}
-				}
-				origPort := os.Getenv("PORT")
-				defer func() { _ = os.Setenv("PORT", origPort) }()
+				cfg := config.Default().Server
+				cfg.Port = tt.port
 
+				api := newTestAPI()
 				mux := http.NewServeMux()
-				err := setupHandlers(mux)
-				if err != nil {
+				if err := setupHandlers(mux, api); err != nil {
 					t.Fatal(err)
 				}
 
+				ctx, cancel := context.WithCancel(context.Background())
 				serverErr := make(chan error, 1)
-				server := &http.Server{
-					Addr:    ":" + tt.port,
-					Handler: mux,
-				}
-
 				go func() {
-					serverErr <- server.ListenAndServe()
+					serverErr <- startServer(ctx, mux, api, cfg)
 				}()
 
-				// Give server time to start
+				// Give server time to start, then shut it down
 				time.Sleep(100 * time.Millisecond)
+				cancel()
 
-				// Shutdown server
-				ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-				defer cancel()
-				if err := server.Shutdown(ctx); err != nil {
-					t.Logf("server shutdown: %v", err)
-				}
-
-				err = <-serverErr
-				// Accept http.ErrServerClosed as a normal shutdown (not a test failure)
-				if err != nil && err.Error() == "http: Server closed" {
-					err = nil
-				}
+				err := <-serverErr
 				if (err != nil && !tt.wantErr) || (err == nil && tt.wantErr) {
 					t.Errorf("startServer() error = %v, wantErr %v", err, tt.wantErr)
 				}
@@ -116,18 +129,144 @@ func TestSetupHandlers(t *testing.T) {
 	tests := []struct {
 		name    string
 		mux     *http.ServeMux
+		api     *handlers.API
 		wantErr bool
 	}{
-		{"valid mux", http.NewServeMux(), false},
-		{"nil mux", nil, true},
+		{"valid mux", http.NewServeMux(), newTestAPI(), false},
+		{"nil mux", nil, newTestAPI(), true},
+		{"nil api", http.NewServeMux(), nil, true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := setupHandlers(tt.mux)
+			err := setupHandlers(tt.mux, tt.api)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("setupHandlers() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
+
+func TestNewServer(t *testing.T) {
+	cfg := config.Default().Server
+	cfg.Port = 9000
+	srv := newServer(http.NewServeMux(), cfg)
+	if srv.Addr != ":9000" {
+		t.Errorf("got address %q, want :9000", srv.Addr)
+	}
+	if srv.ReadHeaderTimeout == 0 || srv.ReadTimeout == 0 || srv.WriteTimeout == 0 || srv.IdleTimeout == 0 {
+		t.Errorf("expected every timeout to be set, got %+v", srv)
+	}
+}
+
+func TestCORSRoutes(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.CORSOrigins = []string{"https://app.example.org"}
+	cfg.Server.TrustedOrigins = []string{"https://ui.example.org"}
+	api := handlers.NewAPI(storage.NewMemory(), cfg)
+	defer api.Close()
+	mux := http.NewServeMux()
+	if err := setupHandlers(mux, api); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		path, method, origin string
+		want                 int
+		allow                string
+	}{
+		{"/v1/jobs/abc", http.MethodDelete, "https://app.example.org", http.StatusNoContent, "GET, DELETE"},
+		{"/v1/generate-wave", http.MethodPost, "https://app.example.org", http.StatusNoContent, "POST"},
+		{"/generate-wave", http.MethodPost, "https://app.example.org", http.StatusNoContent, "POST"},
+		{"/v1/generate-apikey", http.MethodPost, "https://ui.example.org", http.StatusNoContent, "POST"},
+		{"/v1/generate-apikey", http.MethodPost, "https://app.example.org", http.StatusForbidden, ""},
+		{"/v1/admin/keys", http.MethodGet, "https://ui.example.org", http.StatusNotFound, ""},
+	} {
+		req := httptest.NewRequest(http.MethodOptions, tc.path, nil)
+		req.Header.Set("Origin", tc.origin)
+		req.Header.Set("Access-Control-Request-Method", tc.method)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != tc.want || w.Header().Get("Access-Control-Allow-Methods") != tc.allow {
+			t.Errorf("preflight %s %s from %s: got %d, methods %q", tc.method, tc.path, tc.origin, w.Code, w.Header().Get("Access-Control-Allow-Methods"))
+		}
+	}
+
+	// pages are same-origin only
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://app.example.org")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("got Access-Control-Allow-Origin %q on the index page", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.ContentSecurityPolicy = "default-src 'self'"
+	api := handlers.NewAPI(storage.NewMemory(), cfg)
+	defer api.Close()
+	mux := http.NewServeMux()
+	if err := setupHandlers(mux, api); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, csp := range map[string]string{
+		"/":                                  "default-src 'self'",
+		"/docs/api-docs":                     "default-src 'self'",
+		"/blog/wave-generator-math-tutorial": "default-src 'self'",
+		"/static/index.html":                 "default-src 'self'",
+		"/v1/usage":                          handlers.APIContentSecurityPolicy,
+		"/generate-apikey":                   handlers.APIContentSecurityPolicy,
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if got := w.Header().Get("Content-Security-Policy"); got != csp {
+			t.Errorf("%s: got CSP %q, want %q", path, got, csp)
+		}
+		if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("X-Frame-Options") != "DENY" {
+			t.Errorf("%s: got %v", path, w.Header())
+		}
+	}
+}
+
+func TestEmbeddedAssets(t *testing.T) {
+	api := newTestAPI()
+	defer api.Close()
+	mux := http.NewServeMux()
+	if err := setupHandlers(mux, api); err != nil {
+		t.Fatal(err)
+	}
+	// The pages do not depend on the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.Chdir(wd) })
+
+	for _, path := range []string{"/", "/static/index.html", "/docs/api-docs", "/blog/wave-generator-math-tutorial"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status OK, got %v", path, w.Code)
+			continue
+		}
+		etag := w.Header().Get("ETag")
+		if etag == "" {
+			t.Errorf("%s: missing ETag", path)
+			continue
+		}
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("If-None-Match", etag)
+		w = httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		if w.Code != http.StatusNotModified {
+			t.Errorf("%s: expected 304 for a matching ETag, got %v", path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.Counter("test_requests_total", "Requests served.", "route", "status")
+	errors := r.Counter("test_errors_total", "Errors,\nper line.")
+	latency := r.Histogram("test_latency_seconds", "Latency.", []float64{0.1, 1}, "route")
+
+	requests.Inc("/b", "200")
+	requests.Add(2, "/a", "500")
+	requests.Inc("/b", "200")
+	requests.Inc(`say "hi"`, "200")
+	latency.Observe(0.05, "/a")
+	latency.Observe(0.1, "/a")
+	latency.Observe(3, "/a")
+
+	var sb strings.Builder
+	if err := r.WriteText(&sb); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{route="/a",status="500"} 2
+test_requests_total{route="/b",status="200"} 2
+test_requests_total{route="say \"hi\"",status="200"} 1
+# HELP test_errors_total Errors,\nper line.
+# TYPE test_errors_total counter
+test_errors_total 0
+# HELP test_latency_seconds Latency.
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{route="/a",le="0.1"} 2
+test_latency_seconds_bucket{route="/a",le="1"} 2
+test_latency_seconds_bucket{route="/a",le="+Inf"} 3
+test_latency_seconds_sum{route="/a"} 3.15
+test_latency_seconds_count{route="/a"} 3
+`
+	if sb.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", sb.String(), want)
+	}
+	if requests.Value("/b", "200") != 2 || errors.Value() != 0 || latency.Count("/a") != 3 || latency.Count("/b") != 0 {
+		t.Error("unexpected values")
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("test_total", "Test.", "label")
+	for name, fn := range map[string]func(){
+		"duplicate":        func() { r.Counter("test_total", "Again.") },
+		"label count":      func() { c.Inc() },
+		"negative delta":   func() { c.Add(-1, "x") },
+		"unsorted buckets": func() { r.Histogram("test_seconds", "Test.", []float64{1, 0.5}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected a panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	r := NewRegistry()
+	r.Histogram("test_size", "Size.", ExponentialBuckets(1, 10, 3)).Observe(50)
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("got Content-Type %q", ct)
+	}
+	for _, line := range []string{`test_size_bucket{le="10"} 0`, `test_size_bucket{le="100"} 1`, "test_size_count 1"} {
+		if !strings.Contains(rec.Body.String(), line+"\n") {
+			t.Errorf("missing %q in\n%s", line, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package models
+
+// Error codes returned in APIError.Code. Clients should branch on the
+// code; the message is meant for people and may change.
+const (
+	ErrCodeInvalidRequest    = "invalid_request"
+	ErrCodeInvalidImage      = "invalid_image"
+	ErrCodeMethodNotAllowed  = "method_not_allowed"
+	ErrCodeMissingAPIKey     = "missing_api_key"
+	ErrCodeInvalidAPIKey     = "invalid_api_key"
+	ErrCodeInactiveAPIKey    = "inactive_api_key"
+	ErrCodeInsufficientScope = "insufficient_scope"
+	ErrCodeUnauthorized      = "unauthorized"
+	ErrCodeAdminDisabled     = "admin_disabled"
+	ErrCodeNotFound          = "not_found"
+	ErrCodeConflict          = "conflict"
+	ErrCodeRateLimited       = "rate_limited"
+	ErrCodeQuotaExceeded     = "quota_exceeded"
+	ErrCodeQueueFull         = "queue_full"
+	ErrCodeProcessingFailed  = "processing_failed"
+	ErrCodeProcessingTimeout = "processing_timeout"
+	ErrCodeUnavailable       = "unavailable"
+	ErrCodeCORSRejected      = "cors_rejected"
+	ErrCodeCSRFRejected      = "csrf_rejected"
+	ErrCodeInternal          = "internal_error"
+)
+
+// APIError describes a failed API request.
+type APIError struct {
+	Code      string         `json:"code"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"request_id,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// ErrorResponse is the body of every API error response.
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
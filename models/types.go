@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type PolySegment struct {
 	X0         int     `json:"domain_start"`
 	X1         int     `json:"domain_end"`
@@ -11,7 +13,160 @@ type PolySegment struct {
 	SVG        string  `json:"svg,omitempty"`
 }
 
+// Eval returns the value of the segment polynomial at x.
+func (s PolySegment) Eval(x float64) float64 {
+	return s.CoefA3*x*x*x + s.CoefA2*x*x + s.CoefA1*x + s.CoefA0
+}
+
+// Slope returns the first derivative of the segment polynomial at x.
+func (s PolySegment) Slope(x float64) float64 {
+	return 3*s.CoefA3*x*x + 2*s.CoefA2*x + s.CoefA1
+}
+
+// DebugInfo describes how well the fitted segments follow the extracted
+// pattern. Residuals are pattern[x] - p(x) over the columns covered by a
+// segment; columns without a segment are counted as unfitted.
+type DebugInfo struct {
+	SVG           string    `json:"svg,omitempty"`
+	RMSE          float64   `json:"rmse"`
+	MaxResidual   float64   `json:"max_residual"`
+	SegmentRMSE   []float64 `json:"segment_rmse"`
+	UnfittedCount int       `json:"unfitted_columns"`
+}
+
 type ResponsePayload struct {
 	Segments []PolySegment `json:"segments"`
 	SVG      string        `json:"svg"`
 }
+
+// Scopes grant an API key access to groups of endpoints.
+const (
+	ScopeGenerate = "wave:generate"
+)
+
+// APIKey is the stored metadata of an API key. Only a hash of the secret
+// part of the key is kept; the full key is shown once, when it is issued.
+type APIKey struct {
+	ID     string   `json:"id"`
+	Hash   string   `json:"-"`
+	Owner  string   `json:"owner,omitempty"`
+	Scopes []string `json:"scopes"`
+	Tier   string   `json:"tier,omitempty"`
+	// MonthlyQuota caps the requests per calendar month (UTC); zero
+	// means unlimited.
+	MonthlyQuota int64      `json:"monthly_quota,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastUsed     *time.Time `json:"last_used,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+}
+
+// IssuedAPIKey is the response for a newly issued or rotated key, the only
+// one carrying the full key.
+type IssuedAPIKey struct {
+	Key string `json:"api_key"`
+	APIKey
+}
+
+// HasScope reports whether the key grants the given scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key is neither revoked nor expired at t.
+func (k APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// Usage is the metered activity of an API key over a day (Date is
+// YYYY-MM-DD), a month (YYYY-MM) or a longer range (Date empty).
+type Usage struct {
+	Date         string `json:"date,omitempty"`
+	Requests     int64  `json:"requests"`
+	Errors       int64  `json:"errors"`
+	Pixels       int64  `json:"pixels"`
+	ProcessingMS int64  `json:"processing_ms"`
+}
+
+// Add accumulates the counters of o into u.
+func (u *Usage) Add(o Usage) {
+	u.Requests += o.Requests
+	u.Errors += o.Errors
+	u.Pixels += o.Pixels
+	u.ProcessingMS += o.ProcessingMS
+}
+
+// WaveResponse is the JSON result of processing an image.
+type WaveResponse struct {
+	ResponsePayload
+	SegmentSVGs []string          `json:"segment_svgs"`
+	Coords      [][]float64       `json:"coords"`
+	Debug       *DebugInfo        `json:"debug,omitempty"`
+	Exports     map[string]string `json:"exports,omitempty"`
+}
+
+// BatchResult is one NDJSON line of a /batch response: the fields of the
+// /generate-wave response, or an error. Index -1 reports a problem reading
+// the request body.
+type BatchResult struct {
+	Index    int    `json:"index"`
+	Filename string `json:"filename"`
+	*WaveResponse
+	Error *APIError `json:"error,omitempty"`
+}
+
+// Job states. Succeeded, failed and canceled are final.
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+// Job is an image processed asynchronously. Result is set once it has
+// succeeded and Error once it has failed; finished jobs are kept until
+// ExpiresAt.
+type Job struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	KeyID      string        `json:"-"`
+	WebhookURL string        `json:"webhook_url,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	ExpiresAt  *time.Time    `json:"expires_at,omitempty"`
+	Error      *APIError     `json:"error,omitempty"`
+	Result     *WaveResponse `json:"result,omitempty"`
+}
+
+// Done reports whether the job has reached a final state.
+func (j Job) Done() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCanceled
+}
+
+// Health check states.
+const (
+	HealthOK   = "ok"
+	HealthFail = "fail"
+)
+
+// HealthCheck is the result of one readiness check. Error says why it
+// failed; Details describe what was checked, e.g. the queue length.
+type HealthCheck struct {
+	Status  string         `json:"status"`
+	Error   string         `json:"error,omitempty"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// HealthResponse is the body of /healthz and /readyz. Status is fail when
+// any of the checks failed.
+type HealthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
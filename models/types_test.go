@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func TestPolySegmentJSONMarshalling(t *testing.T) {
@@ -64,3 +65,51 @@ func TestResponsePayloadJSONMarshalling(t *testing.T) {
 		t.Errorf("Expected %v, got %v", payload, unmarshalled)
 	}
 }
+
+func TestPolySegmentEval(t *testing.T) {
+	seg := PolySegment{CoefA3: 1, CoefA2: -2, CoefA1: 3, CoefA0: 4}
+
+	if got := seg.Eval(2); got != 8-8+6+4 {
+		t.Errorf("Eval(2) = %v, want 10", got)
+	}
+	if got := seg.Slope(2); got != 12-8+3 {
+		t.Errorf("Slope(2) = %v, want 7", got)
+	}
+}
+
+func TestAPIKeyActive(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	tests := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{"no expiry", APIKey{}, true},
+		{"not yet expired", APIKey{ExpiresAt: &future}, true},
+		{"expired", APIKey{ExpiresAt: &past}, false},
+		{"revoked", APIKey{RevokedAt: &past}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.key.Active(now); got != tt.want {
+				t.Errorf("Active() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	key := APIKey{Scopes: []string{ScopeGenerate}}
+	if !key.HasScope(ScopeGenerate) || key.HasScope("admin") {
+		t.Errorf("unexpected HasScope result for %v", key.Scopes)
+	}
+}
+
+func TestUsageAdd(t *testing.T) {
+	u := Usage{Date: "2025-05-01", Requests: 1, Pixels: 100}
+	u.Add(Usage{Date: "2025-05-02", Requests: 2, Errors: 1, Pixels: 50, ProcessingMS: 7})
+	want := Usage{Date: "2025-05-01", Requests: 3, Errors: 1, Pixels: 150, ProcessingMS: 7}
+	if u != want {
+		t.Errorf("got %+v, want %+v", u, want)
+	}
+}
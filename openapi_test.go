@@ -0,0 +1,419 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	"wave-generator/config"
+	"wave-generator/handlers"
+	"wave-generator/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// spec is docs/openapi.yaml decoded into generic maps.
+type spec map[string]any
+
+func loadSpec(t *testing.T) spec {
+	t.Helper()
+	data, err := os.ReadFile("docs/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Decode into a plain map: yaml.v3 gives nested mappings the type of
+	// the outer one.
+	var s map[string]any
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		t.Fatalf("invalid docs/openapi.yaml: %v", err)
+	}
+	return s
+}
+
+// resolve follows a local $ref such as "#/components/schemas/APIKey".
+func (s spec) resolve(node any) map[string]any {
+	m, _ := node.(map[string]any)
+	for m != nil {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		var cur any = map[string]any(s)
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			next, _ := cur.(map[string]any)
+			cur = next[part]
+		}
+		m, _ = cur.(map[string]any)
+	}
+	return m
+}
+
+func (s spec) paths() map[string]any {
+	p, _ := s["paths"].(map[string]any)
+	return p
+}
+
+// operation finds the documented operation matching a request path such
+// as /v1/admin/keys/abc, returning it with its path template.
+func (s spec) operation(method, path string) (map[string]any, string) {
+	for tmpl, item := range s.paths() {
+		re := "^" + regexp.MustCompile(`\\\{[^}]+\\\}`).ReplaceAllString(regexp.QuoteMeta(tmpl), `[^/]+`) + "$"
+		if regexp.MustCompile(re).MatchString(path) {
+			ops, _ := item.(map[string]any)
+			op, _ := ops[strings.ToLower(method)].(map[string]any)
+			return op, tmpl
+		}
+	}
+	return nil, ""
+}
+
+// validate checks v, decoded from JSON, against an OpenAPI schema and
+// returns the mismatches. Properties missing from the schema are reported
+// unless it allows additionalProperties, so undocumented fields are caught.
+func (s spec) validate(schema any, v any, at string) []string {
+	sch := s.resolve(schema)
+	if sch == nil {
+		return nil
+	}
+	var errs []string
+	fail := func(format string, args ...any) {
+		errs = append(errs, at+": "+fmt.Sprintf(format, args...))
+	}
+	if all, ok := sch["allOf"].([]any); ok {
+		merged := map[string]any{"type": "object", "properties": map[string]any{}}
+		for _, part := range all {
+			for name, prop := range s.resolve(part)["properties"].(map[string]any) {
+				merged["properties"].(map[string]any)[name] = prop
+			}
+		}
+		return s.validate(merged, v, at)
+	}
+	if enum, ok := sch["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			found = found || fmt.Sprint(e) == fmt.Sprint(v)
+		}
+		if !found {
+			fail("%v is not one of %v", v, enum)
+		}
+	}
+
+	switch sch["type"] {
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			fail("expected object, got %T", v)
+			break
+		}
+		props, _ := sch["properties"].(map[string]any)
+		if req, ok := sch["required"].([]any); ok {
+			for _, name := range req {
+				if _, ok := obj[name.(string)]; !ok {
+					fail("missing required property %q", name)
+				}
+			}
+		}
+		for name, val := range obj {
+			prop, ok := props[name]
+			if !ok {
+				if sch["additionalProperties"] == nil && props != nil {
+					fail("undocumented property %q", name)
+				}
+				continue
+			}
+			errs = append(errs, s.validate(prop, val, at+"."+name)...)
+		}
+	case "array":
+		arr, ok := v.([]any)
+		if !ok {
+			if v != nil {
+				fail("expected array, got %T", v)
+			}
+			break
+		}
+		for i, item := range arr {
+			errs = append(errs, s.validate(sch["items"], item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			fail("expected string, got %T", v)
+			break
+		}
+		layout := map[string]string{"date-time": time.RFC3339, "date": "2006-01-02"}[fmt.Sprint(sch["format"])]
+		if _, err := time.Parse(layout, str); layout != "" && err != nil {
+			fail("%q is not a %s", str, sch["format"])
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != math.Trunc(n) {
+			fail("expected integer, got %v", v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			fail("expected number, got %T", v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			fail("expected boolean, got %T", v)
+		}
+	}
+	return errs
+}
+
+// conforms checks that the response to a request is documented: the
+// operation exists, the status is listed and the body matches the schema
+// of its content type.
+func (s spec) conforms(t *testing.T, req *http.Request, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	op, tmpl := s.operation(req.Method, req.URL.Path)
+	if op == nil && tmpl != "" && rec.Code == http.StatusMethodNotAllowed {
+		// Undocumented methods are answered with the error envelope.
+		op = map[string]any{"responses": map[string]any{"405": map[string]any{"$ref": "#/components/responses/MethodNotAllowed"}}}
+	}
+	if op == nil {
+		t.Errorf("%s %s is not documented", req.Method, req.URL.Path)
+		return
+	}
+	responses, _ := op["responses"].(map[string]any)
+	resp := s.resolve(responses[fmt.Sprint(rec.Code)])
+	if resp == nil {
+		t.Errorf("%s %s: status %d is not documented (body %s)", req.Method, tmpl, rec.Code, rec.Body.String())
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	content, _ := resp["content"].(map[string]any)
+	if len(content) == 0 {
+		return
+	}
+	media, ok := content[mediaType].(map[string]any)
+	if !ok {
+		t.Errorf("%s %s %d: content type %q is not documented", req.Method, tmpl, rec.Code, mediaType)
+		return
+	}
+	// JSON bodies are validated as a whole, NDJSON bodies line by line.
+	var docs [][]byte
+	switch mediaType {
+	case "application/json":
+		docs = [][]byte{rec.Body.Bytes()}
+	case "application/x-ndjson":
+		docs = bytes.Split(bytes.TrimSpace(rec.Body.Bytes()), []byte("\n"))
+	}
+	for i, doc := range docs {
+		var body any
+		if err := json.Unmarshal(doc, &body); err != nil {
+			t.Errorf("%s %s %d: invalid JSON: %v", req.Method, tmpl, rec.Code, err)
+			return
+		}
+		at := "body"
+		if mediaType != "application/json" {
+			at = fmt.Sprintf("line %d", i+1)
+		}
+		for _, e := range s.validate(media["schema"], body, at) {
+			t.Errorf("%s %s %d: %s", req.Method, tmpl, rec.Code, e)
+		}
+	}
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	s := loadSpec(t)
+	routed := map[string]bool{}
+	for _, rt := range apiRoutes(handlers.NewAPI(storage.NewMemory(), config.Default())) {
+		path := apiVersion + rt.path
+		item, ok := s.paths()[path].(map[string]any)
+		if !ok {
+			t.Errorf("route %s is not documented", path)
+			continue
+		}
+		routed[path] = true
+		if rt.method != "" {
+			routed[strings.ToLower(rt.method)+" "+path] = true
+			if _, ok := item[strings.ToLower(rt.method)]; !ok {
+				t.Errorf("route %s %s is not documented", rt.method, path)
+			}
+		}
+	}
+	var paths []string
+	for path := range s.paths() {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if !routed[path] {
+			t.Errorf("documented path %s is not routed", path)
+			continue
+		}
+		for method := range s.paths()[path].(map[string]any) {
+			if method != "parameters" && !routed[method+" "+path] && routedWithMethod(routed, path) {
+				t.Errorf("documented operation %s %s is not routed", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+// routedWithMethod reports whether path is routed with explicit methods,
+// as opposed to a handler accepting any method.
+func routedWithMethod(routed map[string]bool, path string) bool {
+	for k := range routed {
+		if strings.HasSuffix(k, " "+path) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestOpenAPIConformance(t *testing.T) {
+	s := loadSpec(t)
+	api := handlers.NewAPI(storage.NewMemory(), config.Default())
+	t.Cleanup(api.Close)
+	api.AdminToken = "s3cret"
+	api.Tiers[handlers.TierFree] = storage.Limit{Requests: 1, Period: time.Hour}
+	mux := http.NewServeMux()
+	if err := setupHandlers(mux, api); err != nil {
+		t.Fatal(err)
+	}
+
+	do := func(method, target string, body io.Reader, header ...string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(method, target, body)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		s.conforms(t, req, rec)
+		return rec
+	}
+	decode := func(rec *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s: %v", rec.Body.String(), err)
+		}
+	}
+	admin := []string{"Authorization", "Bearer s3cret"}
+
+	var issued struct {
+		Key string `json:"api_key"`
+		ID  string `json:"id"`
+	}
+	decode(do(http.MethodPost, "/v1/generate-apikey", strings.NewReader(`{"owner":"docs"}`)), &issued)
+	withKey := []string{"X-API-Key", issued.Key, "Content-Type", "image/png"}
+	do(http.MethodGet, "/v1/generate-apikey", nil)
+
+	wave := conformanceImage(t)
+	do(http.MethodPost, "/v1/generate-wave", bytes.NewReader(wave))
+	do(http.MethodPost, "/v1/generate-wave", bytes.NewReader(wave), "X-API-Key", "wg_0123456789abcdef_nope")
+	rec := do(http.MethodPost, "/v1/generate-wave?export=go,css&debug=true", bytes.NewReader(wave), withKey...)
+	do(http.MethodPost, "/v1/generate-wave?svg_mode=path&fill=below&layers=2", bytes.NewReader(wave), withKey...)
+	do(http.MethodPost, "/v1/generate-wave?format=png", bytes.NewReader(wave), withKey...)
+	etag := do(http.MethodPost, "/v1/generate-wave?format=png", bytes.NewReader(wave), withKey...).Header().Get("ETag")
+	do(http.MethodPost, "/v1/generate-wave?format=png", bytes.NewReader(wave), append(withKey, "If-None-Match", etag)...)
+	do(http.MethodPost, "/v1/generate-wave?stroke=nocolor", bytes.NewReader(wave), withKey...)
+	do(http.MethodPost, "/v1/generate-wave", strings.NewReader("not an image"), withKey...)
+	do(http.MethodGet, "/v1/generate-wave", nil, withKey...)
+	api.ProcessingTimeout = time.Nanosecond
+	if rec := do(http.MethodPost, "/v1/generate-wave?layers=3", bytes.NewReader(wave), withKey...); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected a processing timeout, got %d", rec.Code)
+	}
+	api.ProcessingTimeout = 0
+
+	do(http.MethodPost, "/v1/export-code?lang=ts", bytes.NewReader(rec.Body.Bytes()))
+	do(http.MethodPost, "/v1/export-code?lang=cobol", bytes.NewReader(rec.Body.Bytes()))
+
+	do(http.MethodGet, "/v1/usage", nil, withKey...)
+	do(http.MethodGet, "/v1/usage?from=yesterday", nil, withKey...)
+	do(http.MethodGet, "/v1/usage", nil)
+
+	var job struct {
+		ID     string `json:"id"`
+		Status string `json:"status"`
+	}
+	decode(do(http.MethodPost, "/v1/jobs?export=go", bytes.NewReader(wave), withKey...), &job)
+	for deadline := time.Now().Add(5 * time.Second); job.Status == "queued" || job.Status == "running"; {
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", job.ID, job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+		decode(do(http.MethodGet, "/v1/jobs/"+job.ID, nil, withKey...), &job)
+	}
+	do(http.MethodDelete, "/v1/jobs/"+job.ID, nil, withKey...)
+	do(http.MethodGet, "/v1/jobs/0123456789abcdef", nil, withKey...)
+	do(http.MethodPost, "/v1/jobs?format=png", bytes.NewReader(wave), withKey...)
+
+	zipped := &bytes.Buffer{}
+	zw := zip.NewWriter(zipped)
+	f, _ := zw.Create("wave.png")
+	f.Write(wave)
+	zw.Close()
+	do(http.MethodPost, "/v1/batch", bytes.NewReader(zipped.Bytes()), "X-API-Key", issued.Key, "Content-Type", "application/zip")
+	do(http.MethodPost, "/v1/batch?output=zip", bytes.NewReader(zipped.Bytes()), "X-API-Key", issued.Key, "Content-Type", "application/zip")
+	do(http.MethodPost, "/v1/batch", bytes.NewReader(wave), withKey...)
+
+	do(http.MethodGet, "/v1/admin/keys", nil, admin...)
+	do(http.MethodGet, "/v1/admin/keys", nil, "Authorization", "Bearer guess")
+	var created struct {
+		Key string `json:"api_key"`
+		ID  string `json:"id"`
+	}
+	decode(do(http.MethodPost, "/v1/admin/keys", strings.NewReader(`{"owner":"billing","tier":"free","monthly_quota":10,"expires_in":"24h"}`), admin...), &created)
+	do(http.MethodPost, "/v1/admin/keys", strings.NewReader(`{"expires_in":"soon"}`), admin...)
+	do(http.MethodPatch, "/v1/admin/keys/"+created.ID, strings.NewReader(`{"monthly_quota":20}`), admin...)
+	do(http.MethodPatch, "/v1/admin/keys/"+created.ID, strings.NewReader(`{"tier":"platinum"}`), admin...)
+
+	limited := []string{"X-API-Key", created.Key, "Content-Type", "image/png"}
+	do(http.MethodPost, "/v1/generate-wave", bytes.NewReader(wave), limited...)
+	if rec := do(http.MethodPost, "/v1/generate-wave", bytes.NewReader(wave), limited...); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("expected the free tier to be exhausted, got %d", rec.Code)
+	}
+
+	decode(do(http.MethodPost, "/v1/admin/keys/"+created.ID+"/rotate", nil, admin...), &created)
+	do(http.MethodDelete, "/v1/admin/keys/"+created.ID, nil, admin...)
+	do(http.MethodPost, "/v1/admin/keys/"+created.ID+"/rotate", nil, admin...)
+	do(http.MethodDelete, "/v1/admin/keys/0123456789abcdef", nil, admin...)
+	do(http.MethodPost, "/v1/generate-wave", bytes.NewReader(wave), "X-API-Key", created.Key)
+
+	do(http.MethodGet, "/v1/admin/usage", nil, admin...)
+	do(http.MethodGet, "/v1/admin/usage?format=csv", nil, admin...)
+	do(http.MethodGet, "/v1/admin/usage?format=xml", nil, admin...)
+
+	t.Run("legacy alias", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/generate-apikey", nil)
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("got status %d, want 200", rec.Code)
+		}
+		if rec.Header().Get("Deprecation") != "true" || rec.Header().Get("Link") != `</v1/generate-apikey>; rel="successor-version"` {
+			t.Errorf("expected deprecation headers, got %v", rec.Header())
+		}
+	})
+}
+
+// conformanceImage returns a PNG with enough variation to be fitted.
+func conformanceImage(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, 33, 10))
+	for x := 0; x < 33; x++ {
+		for y := 0; y < 10; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(((x+y)%10)*25 + 5)})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"wave-generator/models"
+)
+
+// Export languages supported by ExportCode.
+const (
+	ExportGo         = "go"
+	ExportJavaScript = "js"
+	ExportTypeScript = "ts"
+	ExportPython     = "python"
+	ExportNumPy      = "numpy"
+	ExportGLSL       = "glsl"
+	ExportWGSL       = "wgsl"
+	ExportCSS        = "css"
+	ExportLaTeX      = "latex"
+)
+
+// ExportLanguages lists every language accepted by ExportCode.
+var ExportLanguages = []string{
+	ExportGo, ExportJavaScript, ExportTypeScript, ExportPython, ExportNumPy,
+	ExportGLSL, ExportWGSL, ExportCSS, ExportLaTeX,
+}
+
+// cssEasingSamples is the number of points sampled for CSS linear() easing.
+const cssEasingSamples = 64
+
+// ExportCode generates a ready-to-paste piecewise function `wave(x)` that
+// evaluates the fitted segments in the given language.
+//
+// Each segment applies from its own start up to the start of the next one,
+// so x values between integer columns (and over skipped flat regions) are
+// handled by the preceding segment; x is clamped to the fitted domain. The
+// shader exports evaluate each cubic around its segment start (t = x - x0)
+// to keep float32 precision, all other exports use the same coefficients as
+// the API response in Horner form. The CSS export is a linear() easing
+// function sampled from the curve, and LaTeX a cases environment.
+func ExportCode(segs []models.PolySegment, lang string) (string, error) {
+	if len(segs) == 0 {
+		return "", fmt.Errorf("no segments to export")
+	}
+	segs = append([]models.PolySegment(nil), segs...)
+	sort.Slice(segs, func(i, j int) bool { return segs[i].X0 < segs[j].X0 })
+
+	switch lang {
+	case ExportGo:
+		return exportGo(segs), nil
+	case ExportJavaScript:
+		return exportJS(segs, false), nil
+	case ExportTypeScript:
+		return exportJS(segs, true), nil
+	case ExportPython:
+		return exportPython(segs), nil
+	case ExportNumPy:
+		return exportNumPy(segs), nil
+	case ExportGLSL:
+		return exportGLSL(segs), nil
+	case ExportWGSL:
+		return exportWGSL(segs), nil
+	case ExportCSS:
+		return exportCSS(segs), nil
+	case ExportLaTeX:
+		return exportLaTeX(segs), nil
+	}
+	return "", fmt.Errorf("unsupported export language %q: must be one of %s", lang, strings.Join(ExportLanguages, ", "))
+}
+
+func domain(segs []models.PolySegment) (float64, float64) {
+	return float64(segs[0].X0), float64(segs[len(segs)-1].X1)
+}
+
+// num formats a float64 with the shortest exact representation.
+func num(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// shaderNum formats a float32 literal, always with a decimal point or exponent.
+func shaderNum(v float64) string {
+	s := strconv.FormatFloat(v, 'g', -1, 32)
+	if !strings.ContainsAny(s, ".eE") {
+		s += ".0"
+	}
+	return s
+}
+
+// horner returns ((a3*x + a2)*x + a1)*x + a0 for the given variable,
+// formatting the coefficients with f.
+func horner(a3, a2, a1, a0 float64, x string, f func(float64) string) string {
+	term := func(v float64) string {
+		if v < 0 {
+			return "- " + f(-v)
+		}
+		return "+ " + f(v)
+	}
+	return fmt.Sprintf("((%s * %s %s) * %s %s) * %s %s", f(a3), x, term(a2), x, term(a1), x, term(a0))
+}
+
+func segmentHorner(seg models.PolySegment, x string) string {
+	return horner(seg.CoefA3, seg.CoefA2, seg.CoefA1, seg.CoefA0, x, num)
+}
+
+// localHorner expands the segment around its start so that t = x - x0.
+func localHorner(seg models.PolySegment, t string) string {
+	x0 := float64(seg.X0)
+	b3 := seg.CoefA3
+	b2 := 3*seg.CoefA3*x0 + seg.CoefA2
+	b1 := seg.Slope(x0)
+	b0 := seg.Eval(x0)
+	return horner(b3, b2, b1, b0, t, shaderNum)
+}
+
+func exportGo(segs []models.PolySegment) string {
+	lo, hi := domain(segs)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// wave evaluates the fitted piecewise cubic at x, clamped to [%s, %s].\n", num(lo), num(hi))
+	sb.WriteString("func wave(x float64) float64 {\n")
+	fmt.Fprintf(&sb, "\tif x < %s {\n\t\tx = %s\n\t} else if x > %s {\n\t\tx = %s\n\t}\n", num(lo), num(lo), num(hi), num(hi))
+	sb.WriteString("\tswitch {\n")
+	for i, seg := range segs[:len(segs)-1] {
+		fmt.Fprintf(&sb, "\tcase x < %d:\n\t\treturn %s\n", segs[i+1].X0, segmentHorner(seg, "x"))
+	}
+	fmt.Fprintf(&sb, "\tdefault:\n\t\treturn %s\n\t}\n}\n", segmentHorner(segs[len(segs)-1], "x"))
+	return sb.String()
+}
+
+func exportJS(segs []models.PolySegment, typed bool) string {
+	lo, hi := domain(segs)
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "// Evaluates the fitted piecewise cubic at x, clamped to [%s, %s].\n", num(lo), num(hi))
+	if typed {
+		sb.WriteString("export function wave(x: number): number {\n")
+	} else {
+		sb.WriteString("export function wave(x) {\n")
+	}
+	fmt.Fprintf(&sb, "  x = Math.min(Math.max(x, %s), %s);\n", num(lo), num(hi))
+	for i, seg := range segs[:len(segs)-1] {
+		fmt.Fprintf(&sb, "  if (x < %d) return %s;\n", segs[i+1].X0, segmentHorner(seg, "x"))
+	}
+	fmt.Fprintf(&sb, "  return %s;\n}\n", segmentHorner(segs[len(segs)-1], "x"))
+	return sb.String()
+}
+
+func exportPython(segs []models.PolySegment) string {
+	lo, hi := domain(segs)
+	var sb strings.Builder
+	sb.WriteString("def wave(x: float) -> float:\n")
+	fmt.Fprintf(&sb, "    \"\"\"Evaluate the fitted piecewise cubic at x, clamped to [%s, %s].\"\"\"\n", num(lo), num(hi))
+	fmt.Fprintf(&sb, "    x = min(max(x, %s), %s)\n", num(lo), num(hi))
+	for i, seg := range segs[:len(segs)-1] {
+		fmt.Fprintf(&sb, "    if x < %d:\n        return %s\n", segs[i+1].X0, segmentHorner(seg, "x"))
+	}
+	fmt.Fprintf(&sb, "    return %s\n", segmentHorner(segs[len(segs)-1], "x"))
+	return sb.String()
+}
+
+func exportNumPy(segs []models.PolySegment) string {
+	lo, hi := domain(segs)
+	var conds, funcs []string
+	for i, seg := range segs {
+		switch {
+		case len(segs) == 1:
+			conds = append(conds, "x >= -np.inf")
+		case i == 0:
+			conds = append(conds, fmt.Sprintf("x < %d", segs[1].X0))
+		case i == len(segs)-1:
+			conds = append(conds, fmt.Sprintf("x >= %d", seg.X0))
+		default:
+			conds = append(conds, fmt.Sprintf("(x >= %d) & (x < %d)", seg.X0, segs[i+1].X0))
+		}
+		funcs = append(funcs, "lambda x: "+segmentHorner(seg, "x"))
+	}
+	var sb strings.Builder
+	sb.WriteString("import numpy as np\n\n\n")
+	sb.WriteString("def wave(x):\n")
+	fmt.Fprintf(&sb, "    \"\"\"Evaluate the fitted piecewise cubic element-wise, clamping x to [%s, %s].\"\"\"\n", num(lo), num(hi))
+	fmt.Fprintf(&sb, "    x = np.clip(np.asarray(x, dtype=float), %s, %s)\n", num(lo), num(hi))
+	sb.WriteString("    return np.piecewise(\n        x,\n        [\n")
+	for _, c := range conds {
+		fmt.Fprintf(&sb, "            %s,\n", c)
+	}
+	sb.WriteString("        ],\n        [\n")
+	for _, f := range funcs {
+		fmt.Fprintf(&sb, "            %s,\n", f)
+	}
+	sb.WriteString("        ],\n    )\n")
+	return sb.String()
+}
+
+func exportGLSL(segs []models.PolySegment) string {
+	lo, hi := domain(segs)
+	var sb strings.Builder
+	sb.WriteString("// Fitted piecewise cubic; each piece is evaluated around its start (t = x - x0).\n")
+	sb.WriteString("float wave(float x) {\n")
+	fmt.Fprintf(&sb, "    x = clamp(x, %s, %s);\n", shaderNum(lo), shaderNum(hi))
+	for i, seg := range segs[:len(segs)-1] {
+		fmt.Fprintf(&sb, "    if (x < %s) { float t = x - %s; return %s; }\n",
+			shaderNum(float64(segs[i+1].X0)), shaderNum(float64(seg.X0)), localHorner(seg, "t"))
+	}
+	last := segs[len(segs)-1]
+	fmt.Fprintf(&sb, "    float t = x - %s;\n    return %s;\n}\n", shaderNum(float64(last.X0)), localHorner(last, "t"))
+	return sb.String()
+}
+
+func exportWGSL(segs []models.PolySegment) string {
+	lo, hi := domain(segs)
+	var sb strings.Builder
+	sb.WriteString("// Fitted piecewise cubic; each piece is evaluated around its start (t = x - x0).\n")
+	sb.WriteString("fn wave(x_in: f32) -> f32 {\n")
+	fmt.Fprintf(&sb, "    let x = clamp(x_in, %s, %s);\n", shaderNum(lo), shaderNum(hi))
+	for i, seg := range segs[:len(segs)-1] {
+		fmt.Fprintf(&sb, "    if (x < %s) { let t = x - %s; return %s; }\n",
+			shaderNum(float64(segs[i+1].X0)), shaderNum(float64(seg.X0)), localHorner(seg, "t"))
+	}
+	last := segs[len(segs)-1]
+	fmt.Fprintf(&sb, "    let t = x - %s;\n    return %s;\n}\n", shaderNum(float64(last.X0)), localHorner(last, "t"))
+	return sb.String()
+}
+
+// exportCSS samples the curve into a linear() easing function. Input
+// progress maps the fitted domain to 0–100%; output is normalized to [0, 1]
+// with higher points of the wave (smaller image y) giving larger values.
+func exportCSS(segs []models.PolySegment) string {
+	lo, hi := domain(segs)
+	eval := func(x float64) float64 {
+		seg := segs[0]
+		for _, s := range segs {
+			if float64(s.X0) <= x {
+				seg = s
+			}
+		}
+		return seg.Eval(x)
+	}
+	ys := make([]float64, cssEasingSamples+1)
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for i := range ys {
+		ys[i] = eval(lo + (hi-lo)*float64(i)/cssEasingSamples)
+		minY, maxY = math.Min(minY, ys[i]), math.Max(maxY, ys[i])
+	}
+	span := maxY - minY
+	if span == 0 {
+		span = 1
+	}
+	stops := make([]string, len(ys))
+	for i, y := range ys {
+		stops[i] = fmt.Sprintf("%s %s%%",
+			strconv.FormatFloat((maxY-y)/span, 'f', 4, 64),
+			strconv.FormatFloat(100*float64(i)/cssEasingSamples, 'f', 2, 64))
+	}
+	var sb strings.Builder
+	sb.WriteString("/* Easing that follows the fitted wave: higher points of the wave give larger progress values. */\n")
+	sb.WriteString(":root {\n")
+	fmt.Fprintf(&sb, "  --wave-easing: linear(%s);\n}\n", strings.Join(stops, ", "))
+	return sb.String()
+}
+
+func exportLaTeX(segs []models.PolySegment) string {
+	var sb strings.Builder
+	sb.WriteString("y(x) = \\begin{cases}\n")
+	for i, seg := range segs {
+		sep := " \\\\"
+		if i == len(segs)-1 {
+			sep = ""
+		}
+		fmt.Fprintf(&sb, "  %s x^{3} %s x^{2} %s x %s & %d \\le x \\le %d%s\n",
+			latexNum(seg.CoefA3, false), latexNum(seg.CoefA2, true), latexNum(seg.CoefA1, true), latexNum(seg.CoefA0, true),
+			seg.X0, seg.X1, sep)
+	}
+	sb.WriteString("\\end{cases}\n")
+	return sb.String()
+}
+
+// latexNum formats v with six significant digits, using \times 10^{n} for
+// exponents. With signed set the sign is written as a separate + or - term.
+func latexNum(v float64, signed bool) string {
+	sign := ""
+	if signed {
+		sign = "+ "
+		if v < 0 {
+			sign, v = "- ", -v
+		}
+	}
+	s := strconv.FormatFloat(v, 'g', 6, 64)
+	if mant, exp, ok := strings.Cut(s, "e"); ok {
+		n, _ := strconv.Atoi(exp)
+		s = fmt.Sprintf("%s \\times 10^{%d}", mant, n)
+	}
+	return sign + s
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"wave-generator/models"
+)
+
+var exportSegs = []models.PolySegment{
+	{X0: 0, X1: 15, CoefA3: 0.001, CoefA2: -0.02, CoefA1: 0.5, CoefA0: 10},
+	{X0: 16, X1: 31, CoefA3: -2e-05, CoefA2: 0.01, CoefA1: -0.3, CoefA0: 14},
+}
+
+func TestExportCode(t *testing.T) {
+	for _, lang := range ExportLanguages {
+		t.Run(lang, func(t *testing.T) {
+			code, err := ExportCode(exportSegs, lang)
+			if err != nil {
+				t.Fatalf("ExportCode(%q) error = %v", lang, err)
+			}
+			if strings.ContainsAny(code, "∈·³²") {
+				t.Errorf("export contains unicode math symbols:\n%s", code)
+			}
+			if lang != ExportCSS && lang != ExportLaTeX && !strings.Contains(code, "wave") {
+				t.Errorf("export does not define wave():\n%s", code)
+			}
+		})
+	}
+
+	if _, err := ExportCode(exportSegs, "cobol"); err == nil {
+		t.Error("expected error for unsupported language")
+	}
+	if _, err := ExportCode(nil, ExportGo); err == nil {
+		t.Error("expected error for empty segments")
+	}
+}
+
+func TestExportGoCompiles(t *testing.T) {
+	code, err := ExportCode(exportSegs, ExportGo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), "wave.go", "package p\n\n"+code, 0); err != nil {
+		t.Fatalf("generated Go does not parse: %v\n%s", err, code)
+	}
+	if !strings.Contains(code, "case x < 16:\n\t\treturn ((0.001 * x - 0.02) * x + 0.5) * x + 10") {
+		t.Errorf("expected segment boundary at the next segment start:\n%s", code)
+	}
+}
+
+func TestExportShaderLocalForm(t *testing.T) {
+	code, err := ExportCode(exportSegs, ExportGLSL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Every piece must evaluate to the same value as the global polynomial.
+	re := regexp.MustCompile(`float t = x - ([0-9.]+);\s*return ([^;]+);`)
+	matches := re.FindAllStringSubmatch(code, -1)
+	if len(matches) != len(exportSegs) {
+		t.Fatalf("expected %d pieces, got %d:\n%s", len(exportSegs), len(matches), code)
+	}
+	for i, m := range matches {
+		x0, _ := strconv.ParseFloat(m[1], 64)
+		for _, dx := range []float64{0, 3.5, 15} {
+			got := evalExpr(t, m[2], dx)
+			want := exportSegs[i].Eval(x0 + dx)
+			if math.Abs(got-want) > 1e-4 {
+				t.Errorf("piece %d at x=%v: got %v, want %v", i, x0+dx, got, want)
+			}
+		}
+	}
+}
+
+func TestExportCSS(t *testing.T) {
+	code, err := ExportCode(exportSegs, ExportCSS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(code, "--wave-easing: linear(") || !strings.Contains(code, " 100.00%)") {
+		t.Errorf("unexpected CSS export:\n%s", code)
+	}
+}
+
+func TestExportLaTeX(t *testing.T) {
+	code, err := ExportCode(exportSegs, ExportLaTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`0.001 x^{3} - 0.02 x^{2} + 0.5 x + 10 & 0 \le x \le 15 \\`,
+		`-2 \times 10^{-5} x^{3} + 0.01 x^{2} - 0.3 x + 14 & 16 \le x \le 31`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("LaTeX export missing %q:\n%s", want, code)
+		}
+	}
+}
+
+// evalExpr evaluates an arithmetic expression in the variable t.
+func evalExpr(t *testing.T, src string, tv float64) float64 {
+	t.Helper()
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %v", src, err)
+	}
+	var eval func(ast.Expr) float64
+	eval = func(e ast.Expr) float64 {
+		switch e := e.(type) {
+		case *ast.ParenExpr:
+			return eval(e.X)
+		case *ast.Ident:
+			return tv
+		case *ast.BasicLit:
+			v, _ := strconv.ParseFloat(e.Value, 64)
+			return v
+		case *ast.UnaryExpr:
+			return -eval(e.X)
+		case *ast.BinaryExpr:
+			a, b := eval(e.X), eval(e.Y)
+			switch e.Op {
+			case token.ADD:
+				return a + b
+			case token.SUB:
+				return a - b
+			case token.MUL:
+				return a * b
+			}
+		}
+		t.Fatalf("unsupported expression %T", e)
+		return 0
+	}
+	return eval(expr)
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// namedColors holds the CSS color keywords supported by the rasterizer.
+var namedColors = map[string]color.NRGBA{
+	"transparent": {0, 0, 0, 0},
+	"black":       {0, 0, 0, 255},
+	"white":       {255, 255, 255, 255},
+	"red":         {255, 0, 0, 255},
+	"lime":        {0, 255, 0, 255},
+	"green":       {0, 128, 0, 255},
+	"blue":        {0, 0, 255, 255},
+	"yellow":      {255, 255, 0, 255},
+	"cyan":        {0, 255, 255, 255},
+	"aqua":        {0, 255, 255, 255},
+	"magenta":     {255, 0, 255, 255},
+	"fuchsia":     {255, 0, 255, 255},
+	"gray":        {128, 128, 128, 255},
+	"grey":        {128, 128, 128, 255},
+	"silver":      {192, 192, 192, 255},
+	"maroon":      {128, 0, 0, 255},
+	"olive":       {128, 128, 0, 255},
+	"navy":        {0, 0, 128, 255},
+	"purple":      {128, 0, 128, 255},
+	"teal":        {0, 128, 128, 255},
+	"orange":      {255, 165, 0, 255},
+	"pink":        {255, 192, 203, 255},
+	"gold":        {255, 215, 0, 255},
+	"indigo":      {75, 0, 130, 255},
+	"violet":      {238, 130, 238, 255},
+	"brown":       {165, 42, 42, 255},
+	"coral":       {255, 127, 80, 255},
+	"crimson":     {220, 20, 60, 255},
+	"tomato":      {255, 99, 71, 255},
+	"turquoise":   {64, 224, 208, 255},
+	"salmon":      {250, 128, 114, 255},
+	"skyblue":     {135, 206, 235, 255},
+	"steelblue":   {70, 130, 180, 255},
+	"slategray":   {112, 128, 144, 255},
+	"whitesmoke":  {245, 245, 245, 255},
+}
+
+// ParseColor converts a CSS color string accepted by SVGStyle.Validate into
+// an NRGBA color: #rgb, #rgba, #rrggbb, #rrggbbaa, rgb(), rgba(), hsl(),
+// hsla() and the keywords listed in namedColors.
+func ParseColor(s string) (color.NRGBA, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "#") {
+		return parseHexColor(s[1:])
+	}
+	if c, ok := namedColors[strings.ToLower(s)]; ok {
+		return c, nil
+	}
+	open, close := strings.IndexByte(s, '('), strings.LastIndexByte(s, ')')
+	if open < 0 || close < open {
+		return color.NRGBA{}, fmt.Errorf("unsupported color %q", s)
+	}
+	fn := strings.ToLower(s[:open])
+	args := strings.Split(s[open+1:close], ",")
+	if len(args) != 3 && len(args) != 4 {
+		return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+	}
+	alpha := 1.0
+	if len(args) == 4 {
+		a, err := parseColorComponent(args[3], 1)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+		}
+		alpha = a
+	}
+	switch fn {
+	case "rgb", "rgba":
+		var rgb [3]float64
+		for i := range rgb {
+			v, err := parseColorComponent(args[i], 255)
+			if err != nil {
+				return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+			}
+			rgb[i] = v
+		}
+		return color.NRGBA{toByte(rgb[0] / 255), toByte(rgb[1] / 255), toByte(rgb[2] / 255), toByte(alpha)}, nil
+	case "hsl", "hsla":
+		hue, err1 := strconv.ParseFloat(strings.TrimSpace(args[0]), 64)
+		sat, err2 := parseColorComponent(args[1], 1)
+		lig, err3 := parseColorComponent(args[2], 1)
+		if err1 != nil || err2 != nil || err3 != nil {
+			return color.NRGBA{}, fmt.Errorf("invalid color %q", s)
+		}
+		r, g, b := hslToRGB(hue, sat, lig)
+		return color.NRGBA{toByte(r), toByte(g), toByte(b), toByte(alpha)}, nil
+	}
+	return color.NRGBA{}, fmt.Errorf("unsupported color %q", s)
+}
+
+func parseHexColor(hex string) (color.NRGBA, error) {
+	if len(hex) == 3 || len(hex) == 4 {
+		var long strings.Builder
+		for _, r := range hex {
+			long.WriteRune(r)
+			long.WriteRune(r)
+		}
+		hex = long.String()
+	}
+	if len(hex) == 6 {
+		hex += "ff"
+	}
+	if len(hex) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color #%s", hex)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid hex color #%s", hex)
+	}
+	return color.NRGBA{uint8(v >> 24), uint8(v >> 16), uint8(v >> 8), uint8(v)}, nil
+}
+
+// parseColorComponent parses a number or percentage; percentages are scaled
+// to [0, scale] and the result is clamped to that range.
+func parseColorComponent(s string, scale float64) (float64, error) {
+	s = strings.TrimSpace(s)
+	pct := strings.HasSuffix(s, "%")
+	v, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil {
+		return 0, err
+	}
+	if pct {
+		v = v / 100 * scale
+	}
+	return math.Max(0, math.Min(scale, v)), nil
+}
+
+func hslToRGB(h, s, l float64) (float64, float64, float64) {
+	h = math.Mod(math.Mod(h, 360)+360, 360) / 360
+	if s == 0 {
+		return l, l, l
+	}
+	q := l * (1 + s)
+	if l >= 0.5 {
+		q = l + s - l*s
+	}
+	p := 2*l - q
+	hue := func(t float64) float64 {
+		t = math.Mod(t+1, 1)
+		switch {
+		case t < 1.0/6:
+			return p + (q-p)*6*t
+		case t < 0.5:
+			return q
+		case t < 2.0/3:
+			return p + (q-p)*(2.0/3-t)*6
+		}
+		return p
+	}
+	return hue(h + 1.0/3), hue(h), hue(h - 1.0/3)
+}
+
+// toByte maps [0, 1] to [0, 255] with rounding.
+func toByte(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+// SplitColors splits a comma separated color list, keeping commas inside
+// functional notations such as rgb(1,2,3) intact.
+func SplitColors(s string) []string {
+	var colors []string
+	depth, start := 0, 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				colors = append(colors, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(colors, strings.TrimSpace(s[start:]))
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{in: "#fff", want: color.NRGBA{255, 255, 255, 255}},
+		{in: "#3498db", want: color.NRGBA{0x34, 0x98, 0xdb, 255}},
+		{in: "#00ff0080", want: color.NRGBA{0, 255, 0, 0x80}},
+		{in: "lime", want: color.NRGBA{0, 255, 0, 255}},
+		{in: "Navy", want: color.NRGBA{0, 0, 128, 255}},
+		{in: "rgb(10, 20, 30)", want: color.NRGBA{10, 20, 30, 255}},
+		{in: "rgba(100%,0%,0%,0.5)", want: color.NRGBA{255, 0, 0, 128}},
+		{in: "hsl(120, 100%, 50%)", want: color.NRGBA{0, 255, 0, 255}},
+		{in: "#12", wantErr: true},
+		{in: "#gggggg", wantErr: true},
+		{in: "rebeccapurple", wantErr: true},
+		{in: "rgb(1,2)", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseColor(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseColor(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitColors(t *testing.T) {
+	got := SplitColors("navy, rgb(0,128,128),hsla(10, 50%, 50%, 0.5)")
+	want := []string{"navy", "rgb(0,128,128)", "hsla(10, 50%, 50%, 0.5)"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+	"wave-generator/models"
+)
+
+// Colors of the diagnostic overlay layers.
+var (
+	debugRawColor      = color.NRGBA{255, 59, 48, 255}
+	debugFitColor      = color.NRGBA{0, 255, 0, 255}
+	debugResidualColor = color.NRGBA{255, 149, 0, 200}
+	debugBoundaryColor = color.NRGBA{0, 200, 255, 255}
+	debugUnfittedColor = color.NRGBA{128, 128, 128, 90}
+)
+
+// Diagnose computes residual statistics of the fit against the extracted
+// pattern: overall and per-segment RMSE, the largest absolute residual and
+// the number of columns no segment covers.
+func Diagnose(pattern []float64, segs []models.PolySegment) models.DebugInfo {
+	info := models.DebugInfo{SegmentRMSE: make([]float64, len(segs))}
+	var sum float64
+	var n int
+	for i, seg := range segs {
+		var segSum float64
+		var segN int
+		for x := max(seg.X0, 0); x <= seg.X1 && x < len(pattern); x++ {
+			r := pattern[x] - seg.Eval(float64(x))
+			segSum += r * r
+			segN++
+			info.MaxResidual = math.Max(info.MaxResidual, math.Abs(r))
+		}
+		if segN > 0 {
+			info.SegmentRMSE[i] = math.Sqrt(segSum / float64(segN))
+		}
+		sum += segSum
+		n += segN
+	}
+	if n > 0 {
+		info.RMSE = math.Sqrt(sum / float64(n))
+	}
+	for x := range pattern {
+		if _, ok := segmentAt(segs, x); !ok {
+			info.UnfittedCount++
+		}
+	}
+	return info
+}
+
+// BuildDebugSVG renders a diagnostic SVG that stacks, from back to front:
+// the original image, gray bands over columns no segment covers, residual
+// bars between the raw pattern and the fitted curve, dashed segment
+// boundaries, the fitted curve and the raw extracted coordinates as dots.
+//
+// Comparing the red dots with the image shows whether ExtractPattern picked
+// the right edge; comparing the green curve with the dots shows whether
+// FitSegments followed them.
+func BuildDebugSVG(img image.Image, pattern []float64, segs []models.PolySegment) (string, error) {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	var src bytes.Buffer
+	if err := png.Encode(&src, img); err != nil {
+		return "", fmt.Errorf("encoding source image: %w", err)
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, `<svg width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg">`, w, h, w, h)
+	fmt.Fprintf(&sb, `<image width="%d" height="%d" href="data:image/png;base64,%s"/>`, w, h, base64.StdEncoding.EncodeToString(src.Bytes()))
+
+	for _, r := range unfittedRanges(len(pattern), segs) {
+		fmt.Fprintf(&sb, `<rect x="%d" y="0" width="%d" height="%d" fill="%s"/>`, r[0], r[1]-r[0]+1, h, svgColor(debugUnfittedColor))
+	}
+
+	fmt.Fprintf(&sb, `<g stroke="%s" stroke-width="1">`, svgColor(debugResidualColor))
+	for x, y := range pattern {
+		seg, ok := segmentAt(segs, x)
+		if !ok {
+			continue
+		}
+		if fit := seg.Eval(float64(x)); math.Abs(y-fit) >= 0.5 {
+			fmt.Fprintf(&sb, `<line x1="%d" y1="%s" x2="%d" y2="%s"/>`, x, fmtCoord(fit), x, fmtCoord(y))
+		}
+	}
+	sb.WriteString(`</g>`)
+
+	fmt.Fprintf(&sb, `<g stroke="%s" stroke-width="1" stroke-dasharray="4 3">`, svgColor(debugBoundaryColor))
+	for _, x := range segmentBoundaries(segs) {
+		fmt.Fprintf(&sb, `<line x1="%s" y1="0" x2="%s" y2="%d"/>`, fmtCoord(x), fmtCoord(x), h)
+	}
+	sb.WriteString(`</g>`)
+
+	fmt.Fprintf(&sb, `<path fill="none" stroke="%s" stroke-width="2" d="%s"/>`, svgColor(debugFitColor), PathData(segs))
+
+	fmt.Fprintf(&sb, `<g fill="%s">`, svgColor(debugRawColor))
+	for x, y := range pattern {
+		fmt.Fprintf(&sb, `<circle cx="%d" cy="%s" r="1"/>`, x, fmtCoord(y))
+	}
+	sb.WriteString(`</g></svg>`)
+	return sb.String(), nil
+}
+
+// RasterizeDebug renders the same layers as BuildDebugSVG to an image.
+func RasterizeDebug(img image.Image, pattern []float64, segs []models.PolySegment) *image.RGBA {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	solid := func(c color.NRGBA) *paint { return &paint{stops: []color.NRGBA{c}} }
+
+	unfitted := newMask(w, h)
+	for _, r := range unfittedRanges(len(pattern), segs) {
+		for y := 0; y < h; y++ {
+			for x := r[0]; x <= r[1] && x < w; x++ {
+				unfitted.cov[y*w+x] = 1
+			}
+		}
+	}
+	composite(dst, unfitted, solid(debugUnfittedColor), 1)
+
+	residuals := newMask(w, h)
+	for x, y := range pattern {
+		if seg, ok := segmentAt(segs, x); ok {
+			residuals.line(point{float64(x), seg.Eval(float64(x))}, point{float64(x), y}, 1)
+		}
+	}
+	composite(dst, residuals, solid(debugResidualColor), 1)
+
+	boundaries := newMask(w, h)
+	for _, x := range segmentBoundaries(segs) {
+		for y := 0.0; y < float64(h); y += 7 {
+			boundaries.line(point{x, y}, point{x, math.Min(y+4, float64(h))}, 1)
+		}
+	}
+	composite(dst, boundaries, solid(debugBoundaryColor), 1)
+
+	composite(dst, strokeMask(w, h, wavePoints(w, segs, SVGModePath), 2), solid(debugFitColor), 1)
+
+	raw := newMask(w, h)
+	for x, y := range pattern {
+		raw.line(point{float64(x), y}, point{float64(x), y}, 2)
+	}
+	composite(dst, raw, solid(debugRawColor), 1)
+	return dst
+}
+
+// segmentBoundaries returns the x positions where segments start, plus the
+// end of the last segment.
+func segmentBoundaries(segs []models.PolySegment) []float64 {
+	if len(segs) == 0 {
+		return nil
+	}
+	xs := make([]float64, 0, len(segs)+1)
+	for _, seg := range segs {
+		xs = append(xs, float64(seg.X0))
+	}
+	return append(xs, float64(segs[len(segs)-1].X1))
+}
+
+// unfittedRanges returns the inclusive column ranges in [0, n) that no
+// segment covers.
+func unfittedRanges(n int, segs []models.PolySegment) [][2]int {
+	var ranges [][2]int
+	start := -1
+	for x := 0; x <= n; x++ {
+		_, ok := segmentAt(segs, x)
+		if x < n && !ok {
+			if start < 0 {
+				start = x
+			}
+			continue
+		}
+		if start >= 0 {
+			ranges = append(ranges, [2]int{start, x - 1})
+			start = -1
+		}
+	}
+	return ranges
+}
+
+func svgColor(c color.NRGBA) string {
+	if c.A == 255 {
+		return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+	}
+	return fmt.Sprintf("rgba(%d,%d,%d,%s)", c.R, c.G, c.B, fmtCoord(float64(c.A)/255))
+}
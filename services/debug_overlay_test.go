@@ -0,0 +1,75 @@
+package services
+
+import (
+	"image"
+	"math"
+	"strings"
+	"testing"
+	"wave-generator/models"
+)
+
+func TestDiagnose(t *testing.T) {
+	pattern := []float64{0, 1, 2, 3, 4, 5, 6, 9, 8, 8, 8, 8}
+	segs := []models.PolySegment{
+		{X0: 0, X1: 3, CoefA1: 1},
+		{X0: 4, X1: 7, CoefA1: 1},
+	}
+
+	info := Diagnose(pattern, segs)
+
+	if info.UnfittedCount != 4 {
+		t.Errorf("UnfittedCount = %d, want 4", info.UnfittedCount)
+	}
+	if info.SegmentRMSE[0] != 0 {
+		t.Errorf("SegmentRMSE[0] = %v, want 0", info.SegmentRMSE[0])
+	}
+	if want := math.Sqrt(4.0 / 4); math.Abs(info.SegmentRMSE[1]-want) > 1e-9 {
+		t.Errorf("SegmentRMSE[1] = %v, want %v", info.SegmentRMSE[1], want)
+	}
+	if info.MaxResidual != 2 {
+		t.Errorf("MaxResidual = %v, want 2", info.MaxResidual)
+	}
+	if want := math.Sqrt(4.0 / 8); math.Abs(info.RMSE-want) > 1e-9 {
+		t.Errorf("RMSE = %v, want %v", info.RMSE, want)
+	}
+}
+
+func TestBuildDebugSVG(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 12, 10))
+	pattern := []float64{0, 1, 2, 3, 4, 5, 6, 9, 8, 8, 8, 8}
+	segs := []models.PolySegment{{X0: 0, X1: 7, CoefA1: 1}}
+
+	svg, err := BuildDebugSVG(img, pattern, segs)
+	if err != nil {
+		t.Fatalf("BuildDebugSVG() error = %v", err)
+	}
+	for _, want := range []string{
+		`href="data:image/png;base64,`,
+		`<rect x="8" y="0" width="4" height="10"`,
+		`<line x1="7" y1="7" x2="7" y2="9"/>`,
+		`stroke-dasharray="4 3"><line x1="0" y1="0" x2="0" y2="10"/><line x1="7"`,
+		`<circle cx="11" cy="8" r="1"/>`,
+	} {
+		if !strings.Contains(svg, want) {
+			t.Errorf("debug SVG missing %q", want)
+		}
+	}
+}
+
+func TestRasterizeDebug(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 12, 10))
+	pattern := []float64{5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5}
+	segs := []models.PolySegment{{X0: 0, X1: 7, CoefA0: 5}}
+
+	out := RasterizeDebug(img, pattern, segs)
+
+	if out.Bounds() != img.Bounds() {
+		t.Fatalf("got bounds %v, want %v", out.Bounds(), img.Bounds())
+	}
+	if got := out.RGBAAt(10, 0); got.R == 0 {
+		t.Errorf("expected unfitted columns to be shaded, got %v", got)
+	}
+	if got := out.RGBAAt(3, 5); got.R == 0 && got.G == 0 {
+		t.Errorf("expected curve and raw points drawn at (3,5), got %v", got)
+	}
+}
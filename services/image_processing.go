@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"image"
 	"image/color"
 	"math"
@@ -11,14 +12,24 @@ import (
 // and copies each pixel, automatically converting the colors to grayscale values.
 // Returns a pointer to the new grayscale image.
 func ToGray(img image.Image) *image.Gray {
+	gray, _ := ToGrayContext(context.Background(), img)
+	return gray
+}
+
+// ToGrayContext is like ToGray but stops between rows once ctx is done,
+// returning ctx.Err().
+func ToGrayContext(ctx context.Context, img image.Image) (*image.Gray, error) {
 	b := img.Bounds()
 	gray := image.NewGray(b)
 	for y := b.Min.Y; y < b.Max.Y; y++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		for x := b.Min.X; x < b.Max.X; x++ {
 			gray.Set(x, y, img.At(x, y))
 		}
 	}
-	return gray
+	return gray, nil
 }
 
 // ToGraySmooth converts any image.Image to a grayscale image with noise reduction.
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"image"
 	"math"
 )
@@ -21,9 +22,19 @@ import (
 //   - A slice of float64 values with length w, where each value represents the y-coordinate
 //     of the pattern at the corresponding x-coordinate
 func ExtractPattern(gray *image.Gray, w, h int) []float64 {
+	pattern, _ := ExtractPatternContext(context.Background(), gray, w, h)
+	return pattern
+}
+
+// ExtractPatternContext is like ExtractPattern but stops between columns
+// once ctx is done, returning ctx.Err().
+func ExtractPatternContext(ctx context.Context, gray *image.Gray, w, h int) ([]float64, error) {
 	pattern := make([]float64, w)
 
 	for x := range w {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		maxGradient := 0.0
 		maxY := 0
 		sumGradient := 0.0
@@ -49,5 +60,5 @@ func ExtractPattern(gray *image.Gray, w, h int) []float64 {
 		}
 	}
 
-	return pattern
+	return pattern, nil
 }
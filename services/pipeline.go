@@ -0,0 +1,195 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"slices"
+	"time"
+	"wave-generator/models"
+)
+
+// Options selects what Process produces from an image.
+type Options struct {
+	Style        SVGStyle // style of the full wave
+	SegmentStyle SVGStyle // style of the per-segment mini SVGs
+	// PNG rasterizes the wave instead of building the JSON response.
+	PNG bool
+	// Overlay draws the PNG wave over the source image.
+	Overlay bool
+	// Debug adds the diagnostic overlay; with PNG it is the output image.
+	Debug   bool
+	Exports []string // ExportLanguages to generate code for
+	// MaxSegments caps the fitted segments; zero means DefaultMaxSegments.
+	MaxSegments int
+	// SegmentHeight is the height of the per-segment SVGs; zero means
+	// DefaultSegmentHeight.
+	SegmentHeight int
+}
+
+// Hash returns a SHA-256 of the options in canonical form: options that
+// produce the same output hash the same, whatever the order of Exports.
+// It fails for options that cannot be encoded, such as NaN or infinite
+// numbers, which SVGStyle.Validate rejects.
+func (o Options) Hash() (string, error) {
+	o.Exports = slices.Compact(slices.Sorted(slices.Values(o.Exports)))
+	b, err := json.Marshal(o)
+	if err != nil {
+		return "", fmt.Errorf("hashing options: %w", err)
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Result is the output of Process: the encoded image when Options.PNG is
+// set, the JSON response otherwise.
+type Result struct {
+	models.WaveResponse
+	PNG []byte
+}
+
+// DefaultSegmentHeight is the default height of the per-segment SVGs.
+const DefaultSegmentHeight = 40
+
+// Process runs the full pipeline on img: grayscale conversion, pattern
+// extraction, segment fitting and rendering. Panics in the numeric code are
+// returned as errors. Once ctx is done the pipeline stops at the next row,
+// column or segment and returns ctx.Err(). The duration of each stage is
+// recorded in the Timings of ctx, if any.
+func Process(ctx context.Context, img image.Image, opts Options) (res *Result, err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			res, err = nil, fmt.Errorf("processing error: %v", rec)
+		}
+	}()
+
+	b := img.Bounds()
+	wImg, hImg := b.Dx(), b.Dy()
+	timings := TimingsFrom(ctx)
+	start := time.Now()
+
+	// Convert the image to grayscale and detect edges
+	edges, err := ToGrayContext(ctx, img)
+	if err != nil {
+		return nil, err
+	}
+	start = timings.Since(StageGrayscale, start)
+	pattern, err := ExtractPatternContext(ctx, edges, wImg, hImg)
+	if err != nil {
+		return nil, err
+	}
+	start = timings.Since(StageExtract, start)
+	segments, err := FitSegmentsContext(ctx, pattern, wImg, opts.MaxSegments)
+	if err != nil {
+		return nil, err
+	}
+	start = timings.Since(StageFit, start)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("could not fit any polynomial segments (possibly singular matrix)")
+	}
+	defer timings.Since(StageRender, start)
+
+	res = &Result{}
+	res.Segments = segments
+	if opts.Debug {
+		info := Diagnose(pattern, segments)
+		if opts.PNG {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, RasterizeDebug(img, pattern, segments)); err != nil {
+				return nil, err
+			}
+			res.PNG = buf.Bytes()
+			return res, nil
+		}
+		if info.SVG, err = BuildDebugSVG(img, pattern, segments); err != nil {
+			return nil, err
+		}
+		res.Debug = &info
+	}
+
+	if opts.PNG {
+		if res.PNG, err = renderPNG(img, segments, opts.Style, opts.Overlay); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	if len(opts.Exports) > 0 {
+		res.Exports = make(map[string]string, len(opts.Exports))
+		for _, lang := range opts.Exports {
+			if res.Exports[lang], err = ExportCode(segments, lang); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Generate SVG with the same dimensions as the original image
+	if res.SVG, err = RenderSVGContext(ctx, wImg, hImg, segments, opts.Style); err != nil {
+		return nil, err
+	}
+
+	// Generate SVG for each segment (mini SVG, width = segment length, height = SegmentHeight, Y scaled to segment range)
+	miniHeight := opts.SegmentHeight
+	if miniHeight <= 0 {
+		miniHeight = DefaultSegmentHeight
+	}
+	for i := range segments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		seg := segments[i]
+		width := seg.X1 - seg.X0 + 1
+		if width < 2 {
+			segments[i].SVG = ""
+			res.SegmentSVGs = append(res.SegmentSVGs, "")
+			continue
+		}
+
+		// Calcular el rango Y real del segmento en el SVG global
+		minY, maxY := seg.Eval(float64(seg.X0)), seg.Eval(float64(seg.X1))
+		for x := seg.X0; x <= seg.X1; x++ {
+			y := seg.Eval(float64(x))
+			if y < minY {
+				minY = y
+			}
+			if y > maxY {
+				maxY = y
+			}
+		}
+		// Generar SVG solo para el segmento, centrando y escalando Y igual que en el SVG global
+		segSVG := RenderSVGSegment(seg, width, miniHeight, minY, maxY, opts.SegmentStyle)
+		res.SegmentSVGs = append(res.SegmentSVGs, segSVG)
+		segments[i].SVG = segSVG
+	}
+
+	// Add coords (pattern as [][x, y])
+	res.Coords = make([][]float64, len(pattern))
+	for i, y := range pattern {
+		res.Coords[i] = []float64{float64(i), y}
+	}
+	return res, nil
+}
+
+// renderPNG rasterizes the fitted wave with the request style. With overlay
+// set the wave is drawn over the original image instead of a blank canvas.
+func renderPNG(img image.Image, segments []models.PolySegment, style SVGStyle, overlay bool) ([]byte, error) {
+	b := img.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	if overlay {
+		draw.Draw(canvas, canvas.Bounds(), img, b.Min, draw.Src)
+	}
+	if err := DrawWave(canvas, segments, style); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, canvas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strings"
+	"testing"
+)
+
+// waveImage returns a 33x10 image with a wave-like pattern.
+func waveImage() image.Image {
+	img := image.NewGray(image.Rect(0, 0, 33, 10))
+	for x := 0; x < 33; x++ {
+		for y := 0; y < 10; y++ {
+			img.SetGray(x, y, color.Gray{Y: uint8(((x+y)%10)*25 + 5)})
+		}
+	}
+	return img
+}
+
+func TestProcess(t *testing.T) {
+	opts := Options{Style: DefaultSVGStyle(), SegmentStyle: DefaultSegmentStyle(), Exports: []string{"go"}}
+	res, err := Process(context.Background(), waveImage(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Segments) == 0 || len(res.SegmentSVGs) != len(res.Segments) {
+		t.Fatalf("got %d segments and %d segment SVGs", len(res.Segments), len(res.SegmentSVGs))
+	}
+	if !strings.HasPrefix(res.SVG, "<svg") || len(res.Coords) != 33 || res.Exports["go"] == "" {
+		t.Errorf("unexpected result %+v", res.WaveResponse)
+	}
+	if res.PNG != nil || res.Debug != nil {
+		t.Error("expected JSON output only")
+	}
+
+	opts.Debug = true
+	if res, err = Process(context.Background(), waveImage(), opts); err != nil {
+		t.Fatal(err)
+	}
+	if res.Debug == nil || res.Debug.SVG == "" {
+		t.Errorf("expected debug info, got %+v", res.Debug)
+	}
+}
+
+func TestProcess_Limits(t *testing.T) {
+	opts := Options{Style: DefaultSVGStyle(), SegmentStyle: DefaultSegmentStyle(), MaxSegments: 1, SegmentHeight: 20}
+	res, err := Process(context.Background(), waveImage(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Segments) != 1 {
+		t.Errorf("got %d segments, want MaxSegments", len(res.Segments))
+	}
+	if !strings.Contains(res.SegmentSVGs[0], `height="20"`) {
+		t.Errorf("got %s, want the segment SVG SegmentHeight high", res.SegmentSVGs[0])
+	}
+}
+
+func TestProcess_PNG(t *testing.T) {
+	for _, opts := range []Options{
+		{Style: DefaultSVGStyle(), PNG: true},
+		{Style: DefaultSVGStyle(), PNG: true, Overlay: true},
+		{Style: DefaultSVGStyle(), PNG: true, Debug: true},
+	} {
+		res, err := Process(context.Background(), waveImage(), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(bytes.NewReader(res.PNG))
+		if err != nil {
+			t.Fatalf("%+v: invalid PNG: %v", opts, err)
+		}
+		if b := img.Bounds(); b.Dx() != 33 || b.Dy() != 10 {
+			t.Errorf("%+v: got %dx%d image, want 33x10", opts, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestProcess_Unfittable(t *testing.T) {
+	if _, err := Process(context.Background(), image.NewGray(image.Rect(0, 0, 1, 1)), Options{Style: DefaultSVGStyle()}); err == nil {
+		t.Error("expected an error for an image without a pattern")
+	}
+}
+
+func TestProcess_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := Process(ctx, waveImage(), Options{Style: DefaultSVGStyle()}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Process: got %v, want context.Canceled", err)
+	}
+	if _, err := ToGrayContext(ctx, waveImage()); !errors.Is(err, context.Canceled) {
+		t.Errorf("ToGrayContext: got %v", err)
+	}
+	if _, err := ExtractPatternContext(ctx, ToGray(waveImage()), 33, 10); !errors.Is(err, context.Canceled) {
+		t.Errorf("ExtractPatternContext: got %v", err)
+	}
+	if _, err := FitSegmentsContext(ctx, make([]float64, 33), 33, 0); !errors.Is(err, context.Canceled) {
+		t.Errorf("FitSegmentsContext: got %v", err)
+	}
+	if _, err := RenderSVGContext(ctx, 33, 10, nil, DefaultSVGStyle()); !errors.Is(err, context.Canceled) {
+		t.Errorf("RenderSVGContext: got %v", err)
+	}
+}
+
+func TestOptionsHash(t *testing.T) {
+	hash := func(o Options) string {
+		t.Helper()
+		h, err := o.Hash()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	a := Options{Style: DefaultSVGStyle(), Exports: []string{"go", "css"}}
+	b := Options{Style: DefaultSVGStyle(), Exports: []string{"css", "go", "go"}}
+	if hash(a) != hash(b) {
+		t.Error("expected the order of exports not to matter")
+	}
+	if a.Exports[0] != "go" {
+		t.Error("Hash must not reorder the exports of its receiver")
+	}
+	b.Style.Stroke = "red"
+	if hash(a) == hash(b) {
+		t.Error("expected different styles to hash differently")
+	}
+	if len(hash(a)) != 64 {
+		t.Errorf("got %q, want a hex SHA-256", hash(a))
+	}
+
+	a.Style.LayerOffset = math.NaN()
+	if _, err := a.Hash(); err == nil {
+		t.Error("expected an error for a NaN option")
+	}
+}
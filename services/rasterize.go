@@ -0,0 +1,300 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"wave-generator/models"
+)
+
+// rasterSubsamples is the number of horizontal samples per pixel used to
+// antialias filled areas.
+const rasterSubsamples = 4
+
+// pathSampleStep is the x distance between vertices when flattening the
+// cubic segments of path mode.
+const pathSampleStep = 0.25
+
+// RasterizeWave renders the segments to a w×h image using the same style
+// options as RenderSVG, so PNG output matches the SVG output.
+func RasterizeWave(w, h int, segs []models.PolySegment, style SVGStyle) (*image.RGBA, error) {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	if err := DrawWave(img, segs, style); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// DrawWave draws the wave onto dst, which may already hold an image (for
+// example the original upload when producing an overlay). Strokes are
+// antialiased by their distance to the pixel center and fills by exact
+// vertical coverage over several horizontal subsamples per pixel. Line caps
+// are always rendered round.
+func DrawWave(dst *image.RGBA, segs []models.PolySegment, style SVGStyle) error {
+	stroke, fill, background, err := rasterPaints(style)
+	if err != nil {
+		return err
+	}
+	b := dst.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	if background != nil {
+		full := newMask(w, h)
+		for i := range full.cov {
+			full.cov[i] = 1
+		}
+		composite(dst, full, background, 1)
+	}
+
+	pts := wavePoints(w, segs, style.Mode)
+	layers := max(style.Layers, 1)
+	for i := layers - 1; i >= 0; i-- {
+		offset := style.LayerOffset * float64(i)
+		opacity := 1 - float64(i)/float64(layers)
+		shifted := make([]point, len(pts))
+		for j, p := range pts {
+			shifted[j] = point{p.x, p.y + offset}
+		}
+		if style.Fill != FillNone {
+			edge := float64(fillEdge(h, style.Fill)) + offset
+			composite(dst, fillMask(w, h, shifted, edge), fill, opacity)
+		}
+		if style.Stroke != "none" && style.StrokeWidth > 0 {
+			composite(dst, strokeMask(w, h, shifted, style.StrokeWidth), stroke, opacity)
+		}
+	}
+	return nil
+}
+
+// ValidateRaster reports whether every color in the style can be rasterized.
+// Validate must be called first; the rasterizer understands fewer color
+// keywords than SVG renderers do.
+func (s SVGStyle) ValidateRaster() error {
+	_, _, _, err := rasterPaints(s)
+	return err
+}
+
+type point struct{ x, y float64 }
+
+// wavePoints flattens the curve into a polyline. Polyline mode uses one
+// vertex per pixel column exactly like polylinePoints; path mode samples each
+// cubic finely and joins consecutive segments with straight lines.
+func wavePoints(w int, segs []models.PolySegment, mode string) []point {
+	var pts []point
+	if mode != SVGModePath {
+		for x := 0; x < w; x++ {
+			seg, _ := segmentAt(segs, x)
+			pts = append(pts, point{float64(x), seg.Eval(float64(x))})
+		}
+		return pts
+	}
+	for _, seg := range segs {
+		x0, x1 := float64(seg.X0), float64(seg.X1)
+		for x := x0; x < x1; x += pathSampleStep {
+			pts = append(pts, point{x, seg.Eval(x)})
+		}
+		pts = append(pts, point{x1, seg.Eval(x1)})
+	}
+	return pts
+}
+
+// paint yields the color of a pixel: a solid color or a linear gradient.
+type paint struct {
+	stops    []color.NRGBA
+	vertical bool
+	w, h     int
+}
+
+func (p *paint) at(x, y int) color.NRGBA {
+	if len(p.stops) == 1 {
+		return p.stops[0]
+	}
+	t := (float64(x) + 0.5) / float64(max(p.w, 1))
+	if p.vertical {
+		t = (float64(y) + 0.5) / float64(max(p.h, 1))
+	}
+	t = math.Max(0, math.Min(1, t)) * float64(len(p.stops)-1)
+	i := int(t)
+	if i >= len(p.stops)-1 {
+		return p.stops[len(p.stops)-1]
+	}
+	f := t - float64(i)
+	a, b := p.stops[i], p.stops[i+1]
+	lerp := func(u, v uint8) uint8 { return uint8(math.Round(float64(u) + (float64(v)-float64(u))*f)) }
+	return color.NRGBA{lerp(a.R, b.R), lerp(a.G, b.G), lerp(a.B, b.B), lerp(a.A, b.A)}
+}
+
+// rasterPaints resolves the stroke, fill and background paints of a style,
+// applying the gradient the same way RenderSVG does.
+func rasterPaints(style SVGStyle) (stroke, fill, background *paint, err error) {
+	solid := func(s string) (*paint, error) {
+		c, err := ParseColor(s)
+		if err != nil {
+			return nil, err
+		}
+		return &paint{stops: []color.NRGBA{c}}, nil
+	}
+	if style.Stroke != "none" {
+		if stroke, err = solid(style.Stroke); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	fillColor := style.FillColor
+	if fillColor == "" {
+		fillColor = style.Stroke
+	}
+	if style.Fill != FillNone {
+		if fill, err = solid(fillColor); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if style.Background != "" {
+		if background, err = solid(style.Background); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	if len(style.Gradient) > 1 {
+		g := &paint{vertical: style.GradientDir == GradientVertical}
+		for _, s := range style.Gradient {
+			c, err := ParseColor(s)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			g.stops = append(g.stops, c)
+		}
+		if style.Fill != FillNone {
+			fill = g
+		} else if stroke != nil {
+			stroke = g
+		}
+	}
+	return stroke, fill, background, nil
+}
+
+// mask holds per-pixel coverage in [0, 1].
+type mask struct {
+	w, h int
+	cov  []float32
+}
+
+func newMask(w, h int) *mask {
+	return &mask{w: w, h: h, cov: make([]float32, w*h)}
+}
+
+// strokeMask computes the coverage of a polyline stroked with the given
+// width.
+func strokeMask(w, h int, pts []point, width float64) *mask {
+	m := newMask(w, h)
+	if len(pts) == 1 {
+		m.line(pts[0], pts[0], width)
+	}
+	for i := 1; i < len(pts); i++ {
+		m.line(pts[i-1], pts[i], width)
+	}
+	return m
+}
+
+// line adds the coverage of the line segment a–b stroked with the given
+// width. Coverage is the maximum over all lines so joints are not painted
+// twice; a zero-length line draws a round dot.
+func (m *mask) line(a, b point, width float64) {
+	hw := width / 2
+	minX := int(math.Floor(math.Min(a.x, b.x) - hw - 1))
+	maxX := int(math.Ceil(math.Max(a.x, b.x) + hw + 1))
+	minY := int(math.Floor(math.Min(a.y, b.y) - hw - 1))
+	maxY := int(math.Ceil(math.Max(a.y, b.y) + hw + 1))
+	for py := max(minY, 0); py <= min(maxY, m.h-1); py++ {
+		for px := max(minX, 0); px <= min(maxX, m.w-1); px++ {
+			d := distToSegment(point{float64(px) + 0.5, float64(py) + 0.5}, a, b)
+			c := float32(math.Max(0, math.Min(1, hw+0.5-d)))
+			if i := py*m.w + px; c > m.cov[i] {
+				m.cov[i] = c
+			}
+		}
+	}
+}
+
+// fillMask computes the coverage of the area between the polyline and the
+// horizontal line y = edge, over the x range spanned by the polyline.
+func fillMask(w, h int, pts []point, edge float64) *mask {
+	m := newMask(w, h)
+	if len(pts) == 0 {
+		return m
+	}
+	first, last := pts[0].x, pts[len(pts)-1].x
+	for px := 0; px < w; px++ {
+		for s := 0; s < rasterSubsamples; s++ {
+			x := float64(px) + (float64(s)+0.5)/rasterSubsamples
+			if x < first || x > last {
+				continue
+			}
+			top, bottom := polylineY(pts, x), edge
+			if top > bottom {
+				top, bottom = bottom, top
+			}
+			for py := max(int(math.Floor(top)), 0); py < h && float64(py) < bottom; py++ {
+				overlap := math.Min(bottom, float64(py+1)) - math.Max(top, float64(py))
+				if overlap > 0 {
+					m.cov[py*w+px] += float32(overlap / rasterSubsamples)
+				}
+			}
+		}
+	}
+	return m
+}
+
+// polylineY interpolates the y value of an x-monotonic polyline at x.
+func polylineY(pts []point, x float64) float64 {
+	i := sort.Search(len(pts), func(i int) bool { return pts[i].x >= x })
+	if i == 0 {
+		return pts[0].y
+	}
+	if i == len(pts) {
+		return pts[len(pts)-1].y
+	}
+	a, b := pts[i-1], pts[i]
+	if b.x == a.x {
+		return b.y
+	}
+	return a.y + (b.y-a.y)*(x-a.x)/(b.x-a.x)
+}
+
+func distToSegment(p, a, b point) float64 {
+	dx, dy := b.x-a.x, b.y-a.y
+	l2 := dx*dx + dy*dy
+	t := 0.0
+	if l2 > 0 {
+		t = math.Max(0, math.Min(1, ((p.x-a.x)*dx+(p.y-a.y)*dy)/l2))
+	}
+	return math.Hypot(p.x-(a.x+t*dx), p.y-(a.y+t*dy))
+}
+
+// composite blends the paint over dst using the mask coverage scaled by
+// opacity (source-over on premultiplied RGBA).
+func composite(dst *image.RGBA, m *mask, p *paint, opacity float64) {
+	if p == nil {
+		return
+	}
+	p.w, p.h = m.w, m.h
+	b := dst.Bounds()
+	for y := 0; y < m.h; y++ {
+		for x := 0; x < m.w; x++ {
+			cov := float64(m.cov[y*m.w+x])
+			if cov <= 0 {
+				continue
+			}
+			c := p.at(x, y)
+			a := math.Min(cov, 1) * opacity * float64(c.A) / 255
+			if a <= 0 {
+				continue
+			}
+			i := dst.PixOffset(b.Min.X+x, b.Min.Y+y)
+			px := dst.Pix[i : i+4 : i+4]
+			px[0] = uint8(math.Round(float64(c.R)*a + float64(px[0])*(1-a)))
+			px[1] = uint8(math.Round(float64(c.G)*a + float64(px[1])*(1-a)))
+			px[2] = uint8(math.Round(float64(c.B)*a + float64(px[2])*(1-a)))
+			px[3] = uint8(math.Round(255*a + float64(px[3])*(1-a)))
+		}
+	}
+}
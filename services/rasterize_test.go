@@ -0,0 +1,90 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"testing"
+	"wave-generator/models"
+)
+
+func TestRasterizeWave(t *testing.T) {
+	// Horizontal line at y = 10.
+	segs := []models.PolySegment{{X0: 0, X1: 19, CoefA0: 10}}
+
+	t.Run("stroke", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.StrokeWidth = 2
+		img, err := RasterizeWave(20, 20, segs, style)
+		if err != nil {
+			t.Fatalf("RasterizeWave() error = %v", err)
+		}
+		if got := img.RGBAAt(5, 9); got.G < 200 || got.A < 200 {
+			t.Errorf("expected lime stroke at (5,9), got %v", got)
+		}
+		if got := img.RGBAAt(5, 2); got.A != 0 {
+			t.Errorf("expected transparent pixel away from the curve, got %v", got)
+		}
+	})
+
+	t.Run("fill below with background", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Mode = SVGModePath
+		style.Stroke = "none"
+		style.Fill = FillBelow
+		style.FillColor = "blue"
+		style.Background = "white"
+		img, err := RasterizeWave(20, 20, segs, style)
+		if err != nil {
+			t.Fatalf("RasterizeWave() error = %v", err)
+		}
+		if got := img.RGBAAt(5, 15); got != (color.RGBA{0, 0, 255, 255}) {
+			t.Errorf("expected blue fill below the curve, got %v", got)
+		}
+		if got := img.RGBAAt(5, 5); got != (color.RGBA{255, 255, 255, 255}) {
+			t.Errorf("expected white background above the curve, got %v", got)
+		}
+	})
+
+	t.Run("horizontal gradient", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Fill = FillAbove
+		style.Gradient = []string{"black", "white"}
+		img, err := RasterizeWave(20, 20, segs, style)
+		if err != nil {
+			t.Fatalf("RasterizeWave() error = %v", err)
+		}
+		left, right := img.RGBAAt(1, 3), img.RGBAAt(18, 3)
+		if left.R >= right.R {
+			t.Errorf("expected gradient to brighten left to right: %v vs %v", left, right)
+		}
+	})
+
+	t.Run("unsupported color", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Stroke = "rebeccapurple"
+		if _, err := RasterizeWave(20, 20, segs, style); err == nil {
+			t.Error("expected error for unsupported color keyword")
+		}
+		if err := style.ValidateRaster(); err == nil {
+			t.Error("expected ValidateRaster to reject unsupported color keyword")
+		}
+	})
+}
+
+func TestDrawWaveOverlay(t *testing.T) {
+	dst := image.NewRGBA(image.Rect(0, 0, 10, 10))
+	for i := range dst.Pix {
+		dst.Pix[i] = 255
+	}
+	style := DefaultSVGStyle()
+	style.Stroke = "red"
+	if err := DrawWave(dst, []models.PolySegment{{X0: 0, X1: 9, CoefA0: 5}}, style); err != nil {
+		t.Fatalf("DrawWave() error = %v", err)
+	}
+	if got := dst.RGBAAt(4, 4); got.G > 128 {
+		t.Errorf("expected red curve over white image, got %v", got)
+	}
+	if got := dst.RGBAAt(4, 0); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("expected untouched original pixel, got %v", got)
+	}
+}
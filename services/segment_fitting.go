@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 
 	"wave-generator/models"
@@ -27,6 +28,18 @@ import (
 // If the solver encounters an error or if a segment would have zero or negative width,
 // the function will panic with an appropriate error message.
 func FitSegments(pattern []float64, width int) []models.PolySegment {
+	segments, _ := FitSegmentsContext(context.Background(), pattern, width, DefaultMaxSegments)
+	return segments
+}
+
+// DefaultMaxSegments is the default cap on the number of segments.
+const DefaultMaxSegments = 32
+
+// FitSegmentsContext is like FitSegments but fits at most maxSegments
+// segments (DefaultMaxSegments when not positive) and stops between
+// segments once ctx is done, returning ctx.Err(). It panics on invalid
+// input like FitSegments.
+func FitSegmentsContext(ctx context.Context, pattern []float64, width, maxSegments int) ([]models.PolySegment, error) {
 	// Input validation
 	if pattern == nil || width <= 0 || len(pattern) < 4 {
 		panic("invalid input: pattern array must not be nil and width must be positive")
@@ -45,10 +58,13 @@ func FitSegments(pattern []float64, width int) []models.PolySegment {
 
 	// Calculate number of segments based on image width
 	// For small images (width < 128), use width/16 segments
-	// For larger images, use up to 32 segments
+	// For larger images, use up to maxSegments segments
+	if maxSegments <= 0 {
+		maxSegments = DefaultMaxSegments
+	}
 	nSeg := width / 16
-	if nSeg > 32 {
-		nSeg = 32
+	if nSeg > maxSegments {
+		nSeg = maxSegments
 	}
 	if nSeg < 1 {
 		nSeg = 1
@@ -67,6 +83,9 @@ func FitSegments(pattern []float64, width int) []models.PolySegment {
 	segments := make([]models.PolySegment, 0, nSeg)
 
 	for i := range nSeg {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		x0 := i * segW
 		x1 := (i + 1) * segW
 		if x0 >= width {
@@ -127,5 +146,5 @@ func FitSegments(pattern []float64, width int) []models.PolySegment {
 		})
 	}
 
-	return segments
+	return segments, nil
 }
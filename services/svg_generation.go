@@ -1,10 +1,18 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"strings"
 	"wave-generator/models"
 )
 
+// SVG output modes accepted by the wave endpoint.
+const (
+	SVGModePolyline = "polyline"
+	SVGModePath     = "path"
+)
+
 // BuildSVG generates an SVG representation of a polynomial curve defined by segments.
 //
 // It creates an SVG image with the specified width and height, containing a polyline
@@ -26,38 +34,249 @@ import (
 //
 // where the coefficients (a3, a2, a1, a0) are provided in each PolySegment struct.
 func BuildSVG(w, h int, segs []models.PolySegment) string {
-	s := fmt.Sprintf(`<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg"><polyline fill="none" stroke="lime" stroke-width="1" points="`, w, h)
+	return RenderSVG(w, h, segs, DefaultSVGStyle())
+}
+
+// BuildSVGPath generates the same curve as BuildSVG using one cubic Bézier
+// command per segment instead of one polyline vertex per pixel column.
+//
+// A cubic polynomial over [x0, x1] is converted exactly to a Bézier curve by
+// placing the control points at one third of the domain along the tangents:
+//
+//	P0 = (x0, p(x0))
+//	P1 = (x0 + d/3, p(x0) + d/3·p'(x0))
+//	P2 = (x1 - d/3, p(x1) - d/3·p'(x1))
+//	P3 = (x1, p(x1))
+//
+// where d = x1 - x0. Consecutive segments are joined with a straight line,
+// matching the polyline output between the last and first column of each.
+func BuildSVGPath(w, h int, segs []models.PolySegment) string {
+	style := DefaultSVGStyle()
+	style.Mode = SVGModePath
+	return RenderSVG(w, h, segs, style)
+}
+
+// RenderSVG generates the SVG markup for the segments using the given style.
+//
+// Besides the curve itself it can draw a background, fill the area below or
+// above the wave, paint the fill (or the stroke, when there is no fill) with
+// a linear gradient, and stack several vertically offset copies of the wave
+// with decreasing opacity for "layered waves" backgrounds. The style is
+// expected to have passed SVGStyle.Validate.
+func RenderSVG(w, h int, segs []models.PolySegment, style SVGStyle) string {
+	svg, _ := RenderSVGContext(context.Background(), w, h, segs, style)
+	return svg
+}
+
+// RenderSVGContext is like RenderSVG but stops between pixel columns once
+// ctx is done, returning ctx.Err().
+func RenderSVGContext(ctx context.Context, w, h int, segs []models.PolySegment, style SVGStyle) (string, error) {
+	c := curve{first: 0, last: w - 1}
+	if style.Mode == SVGModePath {
+		c.path = true
+		c.d = PathData(segs)
+		if len(segs) > 0 {
+			c.first, c.last = segs[0].X0, segs[len(segs)-1].X1
+		}
+	} else {
+		var err error
+		if c.points, err = polylinePoints(ctx, w, segs); err != nil {
+			return "", err
+		}
+	}
+	return renderCurve(w, h, c, style, false), nil
+}
+
+// curve is a wave already converted to SVG geometry: either polyline points
+// or path data, spanning the columns [first, last].
+type curve struct {
+	path        bool
+	points      string
+	d           string
+	first, last int
+}
+
+func renderCurve(w, h int, c curve, style SVGStyle, viewBox bool) string {
+	var sb strings.Builder
+	if style.Responsive {
+		fmt.Fprintf(&sb, `<svg viewBox="0 0 %d %d" preserveAspectRatio="%s" xmlns="http://www.w3.org/2000/svg"`, w, h, style.AspectRatio)
+	} else if viewBox {
+		fmt.Fprintf(&sb, `<svg width="%d" height="%d" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg"`, w, h, w, h)
+	} else {
+		fmt.Fprintf(&sb, `<svg width="%d" height="%d" xmlns="http://www.w3.org/2000/svg"`, w, h)
+	}
+	if style.CSS != "" {
+		fmt.Fprintf(&sb, ` style="%s"`, style.CSS)
+	}
+	sb.WriteString(`>`)
+
+	paint := ""
+	if len(style.Gradient) > 1 {
+		writeGradient(&sb, style)
+		paint = "url(#wave-gradient)"
+	}
+	if style.Background != "" {
+		fmt.Fprintf(&sb, `<rect width="100%%" height="100%%" fill="%s"/>`, style.Background)
+	}
+
+	fillColor, strokeColor := style.FillColor, style.Stroke
+	if fillColor == "" {
+		fillColor = style.Stroke
+	}
+	if paint != "" {
+		if style.Fill != FillNone {
+			fillColor = paint
+		} else {
+			strokeColor = paint
+		}
+	}
+
+	var line, area string
+	edge := fillEdge(h, style.Fill)
+	if c.path {
+		line = fmt.Sprintf(`<path fill="none"%s d="%s"/>`, strokeAttrs(strokeColor, style), c.d)
+		if style.Fill != FillNone && c.d != "" {
+			area = fmt.Sprintf(`<path fill="%s" stroke="none" d="%s L%d,%d L%d,%d Z"/>`,
+				fillColor, c.d, c.last, edge, c.first, edge)
+		}
+	} else {
+		line = fmt.Sprintf(`<polyline fill="none"%s points="%s"/>`, strokeAttrs(strokeColor, style), c.points)
+		if style.Fill != FillNone {
+			area = fmt.Sprintf(`<polygon fill="%s" stroke="none" points="%d,%d %s%d,%d"/>`,
+				fillColor, c.first, edge, c.points, c.last, edge)
+		}
+	}
+	if style.Stroke == "none" {
+		line = ""
+	}
+
+	layers := max(style.Layers, 1)
+	for i := layers - 1; i >= 0; i-- {
+		if layers > 1 {
+			opacity := 1 - float64(i)/float64(layers)
+			fmt.Fprintf(&sb, `<g transform="translate(0,%s)" opacity="%s">`,
+				fmtCoord(style.LayerOffset*float64(i)), fmtCoord(opacity))
+		}
+		sb.WriteString(area)
+		sb.WriteString(line)
+		if layers > 1 {
+			sb.WriteString(`</g>`)
+		}
+	}
+	sb.WriteString(`</svg>`)
+	return sb.String()
+}
+
+func writeGradient(sb *strings.Builder, style SVGStyle) {
+	x2, y2 := 1, 0
+	if style.GradientDir == GradientVertical {
+		x2, y2 = 0, 1
+	}
+	fmt.Fprintf(sb, `<defs><linearGradient id="wave-gradient" x1="0" y1="0" x2="%d" y2="%d">`, x2, y2)
+	for i, c := range style.Gradient {
+		offset := float64(i) / float64(len(style.Gradient)-1) * 100
+		fmt.Fprintf(sb, `<stop offset="%s%%" stop-color="%s"/>`, fmtCoord(offset), c)
+	}
+	sb.WriteString(`</linearGradient></defs>`)
+}
+
+func strokeAttrs(color string, style SVGStyle) string {
+	attrs := fmt.Sprintf(` stroke="%s" stroke-width="%s"`, color, fmtCoord(style.StrokeWidth))
+	if style.LineCap != "" {
+		attrs += fmt.Sprintf(` stroke-linecap="%s"`, style.LineCap)
+	}
+	return attrs
+}
+
+// fillEdge returns the y coordinate the filled area extends to.
+func fillEdge(h int, fill string) int {
+	if fill == FillAbove {
+		return 0
+	}
+	return h
+}
+
+// polylinePoints evaluates the curve at every pixel column in [0, w).
+// Columns not covered by any segment evaluate to zero.
+func polylinePoints(ctx context.Context, w int, segs []models.PolySegment) (string, error) {
+	var sb strings.Builder
 	for x := 0; x < w; x++ {
-		var seg models.PolySegment
-		for _, s := range segs {
-			if x >= s.X0 && x <= s.X1 {
-				seg = s
-				break
-			}
-		}
-		xf := float64(x)
-		// Expand math.Pow for linter
-		y := seg.CoefA3*xf*xf*xf + seg.CoefA2*xf*xf + seg.CoefA1*xf + seg.CoefA0
-		s += fmt.Sprintf("%d,%.2f ", x, y)
-	}
-	s += `"/></svg>`
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		seg, _ := segmentAt(segs, x)
+		fmt.Fprintf(&sb, "%d,%.2f ", x, seg.Eval(float64(x)))
+	}
+	return sb.String(), nil
+}
+
+// segmentAt returns the segment whose domain contains column x. When no
+// segment covers x it returns the zero segment and false.
+func segmentAt(segs []models.PolySegment, x int) (models.PolySegment, bool) {
+	for _, s := range segs {
+		if x >= s.X0 && x <= s.X1 {
+			return s, true
+		}
+	}
+	return models.PolySegment{}, false
+}
+
+// PathData returns the SVG path commands ("M… C… L… C…") for the segments.
+func PathData(segs []models.PolySegment) string {
+	var sb strings.Builder
+	for i, seg := range segs {
+		x0, x1 := float64(seg.X0), float64(seg.X1)
+		y0, y1 := seg.Eval(x0), seg.Eval(x1)
+		if i == 0 {
+			fmt.Fprintf(&sb, "M%s,%s", fmtCoord(x0), fmtCoord(y0))
+		} else {
+			fmt.Fprintf(&sb, " L%s,%s", fmtCoord(x0), fmtCoord(y0))
+		}
+		if seg.X1 <= seg.X0 {
+			continue
+		}
+		d := (x1 - x0) / 3
+		fmt.Fprintf(&sb, " C%s,%s %s,%s %s,%s",
+			fmtCoord(x0+d), fmtCoord(y0+d*seg.Slope(x0)),
+			fmtCoord(x1-d), fmtCoord(y1-d*seg.Slope(x1)),
+			fmtCoord(x1), fmtCoord(y1),
+		)
+	}
+	return sb.String()
+}
+
+// fmtCoord formats a coordinate with two decimals, dropping trailing zeros.
+func fmtCoord(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(s, "0")
+	s = strings.TrimSuffix(s, ".")
+	if s == "-0" {
+		s = "0"
+	}
 	return s
 }
 
 // BuildSVGSegment generates an SVG for a single segment, scaling Y to [minY, maxY] and X to [0,width]
 func BuildSVGSegment(seg models.PolySegment, width, height int, minY, maxY float64) string {
-	points := ""
+	return RenderSVGSegment(seg, width, height, minY, maxY, DefaultSegmentStyle())
+}
+
+// RenderSVGSegment is BuildSVGSegment with a custom style. The mini SVG is
+// always a polyline; stroke, fill, gradient and background options apply.
+func RenderSVGSegment(seg models.PolySegment, width, height int, minY, maxY float64, style SVGStyle) string {
+	var points strings.Builder
 	yRange := maxY - minY
 	if yRange == 0 {
 		yRange = 1
 	}
 	for i := 0; i < width; i++ {
-		x := seg.X0 + i
-		y := seg.CoefA3*float64(x)*float64(x)*float64(x) + seg.CoefA2*float64(x)*float64(x) + seg.CoefA1*float64(x) + seg.CoefA0
+		y := seg.Eval(float64(seg.X0 + i))
 		px := width - 1 - i
 		py := float64(height-2) - ((y-minY)/yRange)*float64(height-4)
 		py = float64(height-2) - py
-		points += fmt.Sprintf("%d,%.1f ", px, py)
+		fmt.Fprintf(&points, "%d,%.1f ", px, py)
 	}
-	return fmt.Sprintf(`<svg width="%d" height="%d" viewBox="0 0 %d %d" style="background:#f8fafd;border-radius:4px;border:1px solid #e1e4e8;"><polyline fill="none" stroke="#3498db" stroke-width="2" points="%s"/></svg>`, width, height, width, height, points)
+	style.Layers = 1
+	style.Responsive = false
+	return renderCurve(width, height, curve{points: points.String(), first: width - 1, last: 0}, style, true)
 }
@@ -26,3 +26,108 @@ func TestBuildSVG(t *testing.T) {
 func contains(s, substr string) bool {
 	return strings.Contains(s, substr)
 }
+
+func TestBuildSVGPath(t *testing.T) {
+	segments := []models.PolySegment{
+		{X0: 0, X1: 3, CoefA3: 1},
+		{X0: 4, X1: 9, CoefA1: 1, CoefA0: 5},
+	}
+
+	svg := BuildSVGPath(10, 40, segments)
+
+	if !contains(svg, "<svg") || !contains(svg, "<path") || !contains(svg, "</svg>") {
+		t.Fatalf("invalid SVG format: %s", svg)
+	}
+	// y = x³ over [0,3] has tangents 0 at x=0 and 27 at x=3.
+	if !contains(svg, `d="M0,0 C1,0 2,0 3,27 L4,9 C5.67,10.67 7.33,12.33 9,14"`) {
+		t.Errorf("unexpected path data: %s", svg)
+	}
+	if n := strings.Count(svg, " C"); n != len(segments) {
+		t.Errorf("expected %d cubic commands, got %d", len(segments), n)
+	}
+
+	wide := []models.PolySegment{{X0: 0, X1: 999, CoefA1: 0.01}}
+	if p, l := len(BuildSVGPath(1000, 40, wide)), len(BuildSVG(1000, 40, wide)); p >= l/10 {
+		t.Errorf("expected path output to be much smaller than polyline: %d vs %d bytes", p, l)
+	}
+}
+
+func TestRenderSVGStyles(t *testing.T) {
+	segments := []models.PolySegment{{X0: 0, X1: 9, CoefA1: 1, CoefA0: 5}}
+
+	t.Run("fill below with gradient", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Mode = SVGModePath
+		style.Fill = FillBelow
+		style.Gradient = []string{"#000", "#fff"}
+		svg := RenderSVG(10, 40, segments, style)
+
+		if !contains(svg, `<linearGradient id="wave-gradient"`) || !contains(svg, `stop-color="#fff"`) {
+			t.Errorf("missing gradient definition: %s", svg)
+		}
+		if !contains(svg, `fill="url(#wave-gradient)" stroke="none" d="M0,5 C3,8 6,11 9,14 L9,40 L0,40 Z"`) {
+			t.Errorf("missing filled area: %s", svg)
+		}
+	})
+
+	t.Run("fill above polyline", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Fill = FillAbove
+		style.FillColor = "navy"
+		svg := RenderSVG(10, 40, segments, style)
+
+		if !contains(svg, `<polygon fill="navy" stroke="none" points="0,0 0,5.00 `) || !contains(svg, `9,14.00 9,0"`) {
+			t.Errorf("missing filled polygon: %s", svg)
+		}
+	})
+
+	t.Run("responsive with background", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Responsive = true
+		style.Background = "white"
+		svg := RenderSVG(10, 40, segments, style)
+
+		if !contains(svg, `viewBox="0 0 10 40" preserveAspectRatio="none"`) || contains(svg, `width="10"`) {
+			t.Errorf("expected responsive root element: %s", svg)
+		}
+		if !contains(svg, `<rect width="100%" height="100%" fill="white"/>`) {
+			t.Errorf("missing background: %s", svg)
+		}
+	})
+
+	t.Run("layers", func(t *testing.T) {
+		style := DefaultSVGStyle()
+		style.Layers = 3
+		style.LayerOffset = -4
+		style.StrokeWidth = 2.5
+		style.LineCap = "round"
+		svg := RenderSVG(10, 40, segments, style)
+
+		if n := strings.Count(svg, "<polyline"); n != 3 {
+			t.Errorf("expected 3 layered copies, got %d", n)
+		}
+		if !contains(svg, `<g transform="translate(0,-8)" opacity="0.33">`) {
+			t.Errorf("missing back layer group: %s", svg)
+		}
+		if !contains(svg, `stroke-width="2.5" stroke-linecap="round"`) {
+			t.Errorf("missing stroke attributes: %s", svg)
+		}
+	})
+}
+
+func TestBuildSVGSegment(t *testing.T) {
+	seg := models.PolySegment{X0: 0, X1: 9, CoefA1: 1}
+	svg := BuildSVGSegment(seg, 10, 40, 0, 9)
+
+	if !contains(svg, `viewBox="0 0 10 40"`) || !contains(svg, `stroke="#3498db"`) || !contains(svg, `style="background:#f8fafd;`) {
+		t.Errorf("unexpected default segment SVG: %s", svg)
+	}
+
+	style := DefaultSegmentStyle()
+	style.Stroke = "red"
+	style.Background = "black"
+	svg = RenderSVGSegment(seg, 10, 40, 0, 9, style)
+	if !contains(svg, `stroke="red"`) || !contains(svg, `fill="black"`) {
+		t.Errorf("style not applied: %s", svg)
+	}
+}
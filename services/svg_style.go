@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+)
+
+// Fill modes for the area between the wave and the image edge.
+const (
+	FillNone  = ""
+	FillBelow = "below"
+	FillAbove = "above"
+)
+
+// Gradient directions.
+const (
+	GradientHorizontal = "horizontal"
+	GradientVertical   = "vertical"
+)
+
+// MaxLayers caps the number of layered copies rendered by RenderSVG.
+const MaxLayers = 10
+
+// MaxLayerOffset bounds the vertical offset in pixels between layers, in
+// either direction.
+const MaxLayerOffset = 1000
+
+var (
+	colorRe  = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]{1,30}|(rgb|rgba|hsl|hsla)\([0-9.,%\s]+\))$`)
+	aspectRe = regexp.MustCompile(`^(none|x(Min|Mid|Max)Y(Min|Mid|Max)( (meet|slice))?)$`)
+)
+
+// SVGStyle controls how a wave is rendered.
+//
+// The zero value is not useful on its own; start from DefaultSVGStyle or
+// DefaultSegmentStyle and override the fields you need.
+type SVGStyle struct {
+	Mode        string   // SVGModePolyline or SVGModePath
+	Stroke      string   // stroke color, "none" hides the line
+	StrokeWidth float64  // stroke width in pixels
+	LineCap     string   // butt, round or square; empty leaves the SVG default
+	Fill        string   // FillNone, FillBelow or FillAbove
+	FillColor   string   // fill color; defaults to the stroke color
+	Gradient    []string // color stops of a linear gradient applied to the fill (or stroke)
+	GradientDir string   // GradientHorizontal or GradientVertical
+	Background  string   // background color; empty is transparent
+	Responsive  bool     // emit viewBox/preserveAspectRatio instead of fixed width/height
+	AspectRatio string   // preserveAspectRatio value used when Responsive is set
+	Layers      int      // number of offset copies for layered backgrounds
+	LayerOffset float64  // vertical offset in pixels between layers
+	CSS         string   // inline style attribute for the root <svg> element
+}
+
+// DefaultSVGStyle returns the style used by BuildSVG.
+func DefaultSVGStyle() SVGStyle {
+	return SVGStyle{
+		Mode:        SVGModePolyline,
+		Stroke:      "lime",
+		StrokeWidth: 1,
+		GradientDir: GradientHorizontal,
+		AspectRatio: "none",
+		Layers:      1,
+	}
+}
+
+// DefaultSegmentStyle returns the style used by BuildSVGSegment.
+func DefaultSegmentStyle() SVGStyle {
+	return SVGStyle{
+		Mode:        SVGModePolyline,
+		Stroke:      "#3498db",
+		StrokeWidth: 2,
+		GradientDir: GradientHorizontal,
+		AspectRatio: "none",
+		Layers:      1,
+		CSS:         "background:#f8fafd;border-radius:4px;border:1px solid #e1e4e8;",
+	}
+}
+
+// Validate reports whether the style is safe to interpolate into SVG markup.
+func (s SVGStyle) Validate() error {
+	switch s.Mode {
+	case SVGModePolyline, SVGModePath:
+	default:
+		return fmt.Errorf("invalid mode %q: must be polyline or path", s.Mode)
+	}
+	switch s.Fill {
+	case FillNone, FillBelow, FillAbove:
+	default:
+		return fmt.Errorf("invalid fill %q: must be below or above", s.Fill)
+	}
+	switch s.LineCap {
+	case "", "butt", "round", "square":
+	default:
+		return fmt.Errorf("invalid linecap %q: must be butt, round or square", s.LineCap)
+	}
+	switch s.GradientDir {
+	case GradientHorizontal, GradientVertical:
+	default:
+		return fmt.Errorf("invalid gradient direction %q", s.GradientDir)
+	}
+	// NaN passes every range check written as "outside", so the numbers
+	// are checked to be finite first.
+	if !finite(s.StrokeWidth) || s.StrokeWidth < 0 || s.StrokeWidth > 100 {
+		return fmt.Errorf("stroke width must be between 0 and 100")
+	}
+	if s.Layers < 1 || s.Layers > MaxLayers {
+		return fmt.Errorf("layers must be between 1 and %d", MaxLayers)
+	}
+	if !finite(s.LayerOffset) || math.Abs(s.LayerOffset) > MaxLayerOffset {
+		return fmt.Errorf("layer offset must be between -%d and %d", MaxLayerOffset, MaxLayerOffset)
+	}
+	if s.Responsive && !aspectRe.MatchString(s.AspectRatio) {
+		return fmt.Errorf("invalid preserveAspectRatio %q", s.AspectRatio)
+	}
+	for _, c := range append([]string{s.Stroke, s.FillColor, s.Background}, s.Gradient...) {
+		if c != "" && !colorRe.MatchString(c) {
+			return fmt.Errorf("invalid color %q", c)
+		}
+	}
+	if len(s.Gradient) == 1 {
+		return fmt.Errorf("gradient needs at least two colors")
+	}
+	return nil
+}
+
+func finite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSVGStyleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*SVGStyle)
+		wantErr bool
+	}{
+		{"default", func(s *SVGStyle) {}, false},
+		{"hex colors and gradient", func(s *SVGStyle) {
+			s.Stroke = "#ff0000"
+			s.Fill = FillBelow
+			s.Gradient = []string{"#000", "rgb(10, 20, 30)", "teal"}
+		}, false},
+		{"responsive aspect", func(s *SVGStyle) { s.Responsive = true; s.AspectRatio = "xMidYMax slice" }, false},
+		{"bad mode", func(s *SVGStyle) { s.Mode = "bezier" }, true},
+		{"bad fill", func(s *SVGStyle) { s.Fill = "sideways" }, true},
+		{"bad linecap", func(s *SVGStyle) { s.LineCap = "pointy" }, true},
+		{"injected color", func(s *SVGStyle) { s.Stroke = `red" onload="alert(1)` }, true},
+		{"single gradient stop", func(s *SVGStyle) { s.Gradient = []string{"red"} }, true},
+		{"too many layers", func(s *SVGStyle) { s.Layers = MaxLayers + 1 }, true},
+		{"negative stroke width", func(s *SVGStyle) { s.StrokeWidth = -1 }, true},
+		{"NaN stroke width", func(s *SVGStyle) { s.StrokeWidth = math.NaN() }, true},
+		{"infinite stroke width", func(s *SVGStyle) { s.StrokeWidth = math.Inf(1) }, true},
+		{"negative layer offset", func(s *SVGStyle) { s.Layers = 3; s.LayerOffset = -12 }, false},
+		{"layer offset too large", func(s *SVGStyle) { s.LayerOffset = MaxLayerOffset + 1 }, true},
+		{"NaN layer offset", func(s *SVGStyle) { s.LayerOffset = math.NaN() }, true},
+		{"infinite layer offset", func(s *SVGStyle) { s.LayerOffset = math.Inf(-1) }, true},
+		{"bad aspect", func(s *SVGStyle) { s.Responsive = true; s.AspectRatio = "stretch" }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := DefaultSVGStyle()
+			tt.modify(&style)
+			if err := style.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Stages of Process recorded in Timings. Callers may record stages of
+// their own, such as StageDecode.
+const (
+	StageDecode    = "decode"
+	StageGrayscale = "grayscale"
+	StageExtract   = "extract"
+	StageFit       = "fit"
+	StageRender    = "render"
+)
+
+// Timings collects how long each stage of processing took. Attach one to
+// a context with WithTimings and Process records its stages in it. It is
+// safe for concurrent use; stages recorded more than once, e.g. by the
+// images of a batch, add up.
+type Timings struct {
+	mu     sync.Mutex
+	order  []string
+	stages map[string]time.Duration
+}
+
+type timingsKey struct{}
+
+// WithTimings returns a context carrying t.
+func WithTimings(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// TimingsFrom returns the Timings attached to ctx, or nil. Recording to a
+// nil Timings does nothing.
+func TimingsFrom(ctx context.Context) *Timings {
+	t, _ := ctx.Value(timingsKey{}).(*Timings)
+	return t
+}
+
+// Record adds d to the duration of stage.
+func (t *Timings) Record(stage string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stages == nil {
+		t.stages = make(map[string]time.Duration)
+	}
+	if _, ok := t.stages[stage]; !ok {
+		t.order = append(t.order, stage)
+	}
+	t.stages[stage] += d
+}
+
+// Since records the time elapsed since start as stage and returns the
+// current time, to chain consecutive stages.
+func (t *Timings) Since(stage string, start time.Time) time.Time {
+	now := time.Now()
+	t.Record(stage, now.Sub(start))
+	return now
+}
+
+// Get returns the recorded duration of stage.
+func (t *Timings) Get(stage string) time.Duration {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stages[stage]
+}
+
+// Each calls fn with every recorded stage, in the order they were first
+// recorded.
+func (t *Timings) Each(fn func(stage string, d time.Duration)) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, stage := range t.order {
+		fn(stage, t.stages[stage])
+	}
+}
+
+// Len returns the number of recorded stages.
+func (t *Timings) Len() int {
+	if t == nil {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.order)
+}
+
+// LogValue logs the stages in the order they were first recorded, in
+// milliseconds.
+func (t *Timings) LogValue() slog.Value {
+	var attrs []slog.Attr
+	t.Each(func(stage string, d time.Duration) {
+		attrs = append(attrs, slog.Float64(stage+"_ms", milliseconds(d)))
+	})
+	return slog.GroupValue(attrs...)
+}
+
+// milliseconds returns d in milliseconds with microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestTimings(t *testing.T) {
+	var timings Timings
+	timings.Record(StageDecode, time.Millisecond)
+	timings.Record(StageFit, 2*time.Millisecond)
+	timings.Record(StageDecode, 500*time.Microsecond)
+	if got := timings.Get(StageDecode); got != 1500*time.Microsecond {
+		t.Errorf("got %s, want repeated stages to add up", got)
+	}
+
+	attrs := timings.LogValue().Group()
+	if len(attrs) != 2 || attrs[0].Key != "decode_ms" || attrs[0].Value.Float64() != 1.5 || attrs[1].Key != "fit_ms" {
+		t.Errorf("unexpected log value %v", attrs)
+	}
+
+	var none *Timings
+	none.Record(StageFit, time.Second)
+	if none.Len() != 0 || none.LogValue().Kind() != slog.KindGroup {
+		t.Error("expected a nil Timings to ignore records")
+	}
+}
+
+func TestProcess_Timings(t *testing.T) {
+	timings := &Timings{}
+	ctx := WithTimings(context.Background(), timings)
+	if TimingsFrom(ctx) != timings || TimingsFrom(context.Background()) != nil {
+		t.Fatal("expected the Timings attached to the context")
+	}
+	if _, err := Process(ctx, waveImage(), Options{Style: DefaultSVGStyle()}); err != nil {
+		t.Fatal(err)
+	}
+	attrs := timings.LogValue().Group()
+	want := []string{"grayscale_ms", "extract_ms", "fit_ms", "render_ms"}
+	if len(attrs) != len(want) {
+		t.Fatalf("got stages %v, want %v", attrs, want)
+	}
+	for i, a := range attrs {
+		if a.Key != want[i] {
+			t.Errorf("stage %d: got %s, want %s", i, a.Key, want[i])
+		}
+	}
+}
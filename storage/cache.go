@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache backends accepted by NewCache.
+const (
+	CacheMemory = "memory" // an LRU in the memory of each instance
+	CacheStore  = "store"  // the storage backend, shared between instances
+	CacheOff    = "off"
+)
+
+// Cache holds processing results by content key.
+type Cache interface {
+	// GetCached returns the value stored at key or ErrNotFound.
+	GetCached(ctx context.Context, key string) ([]byte, error)
+	// SetCached stores value at key for at most ttl. Backends may evict
+	// it earlier.
+	SetCached(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// NewCache returns the cache for the given backend, or nil for CacheOff.
+// maxBytes bounds the memory cache; CacheStore uses the store itself when
+// it implements Cache and falls back to a memory cache otherwise, since
+// the memory store is an in-process store anyway.
+func NewCache(backend string, store Store, maxBytes int64) (Cache, error) {
+	switch backend {
+	case CacheOff:
+		return nil, nil
+	case CacheStore:
+		if c, ok := store.(Cache); ok {
+			return c, nil
+		}
+		return NewLRU(maxBytes), nil
+	case CacheMemory:
+		return NewLRU(maxBytes), nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q: must be %s, %s or %s", backend, CacheMemory, CacheStore, CacheOff)
+}
+
+// LRU is an in-process Cache bounded by the total size of its values.
+// The least recently used entries are evicted first.
+type LRU struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	maxBytes int64
+	size     int64
+	order    *list.List // front is the most recently used
+	entries  map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRU returns an empty cache holding at most maxBytes of values.
+func NewLRU(maxBytes int64) *LRU {
+	return &LRU{
+		now:      time.Now,
+		maxBytes: maxBytes,
+		order:    list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+}
+
+func (c *LRU) GetCached(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e := el.Value.(*lruEntry)
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		return nil, ErrNotFound
+	}
+	c.order.MoveToFront(el)
+	return e.value, nil
+}
+
+// SetCached stores value unless it is larger than the whole cache.
+func (c *LRU) SetCached(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	if int64(len(value)) > c.maxBytes {
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: c.now().Add(ttl)})
+	c.size += int64(len(value))
+	for c.size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of cached entries.
+func (c *LRU) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lruEntry)
+	delete(c.entries, e.key)
+	c.size -= int64(len(e.value))
+}
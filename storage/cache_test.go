@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewCache(t *testing.T) {
+	if c, err := NewCache(CacheOff, NewMemory(), 1); c != nil || err != nil {
+		t.Errorf("off: got %v, %v", c, err)
+	}
+	if c, _ := NewCache(CacheMemory, NewRedis("localhost:0"), 1); c == nil {
+		t.Error("memory: expected an LRU")
+	} else if _, ok := c.(*LRU); !ok {
+		t.Errorf("memory: got %T, want *LRU", c)
+	}
+	if c, _ := NewCache(CacheStore, NewRedis("localhost:0"), 1); c == nil {
+		t.Error("store: expected the Redis store")
+	} else if _, ok := c.(*Redis); !ok {
+		t.Errorf("store: got %T, want *Redis", c)
+	}
+	if c, _ := NewCache(CacheStore, NewMemory(), 1); c == nil {
+		t.Error("store: expected an LRU for the memory store")
+	} else if _, ok := c.(*LRU); !ok {
+		t.Errorf("store: got %T, want *LRU", c)
+	}
+	if _, err := NewCache("disk", NewMemory(), 1); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	c := NewLRU(10)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.SetCached(ctx, "a", []byte("1234"), time.Hour)
+	c.SetCached(ctx, "b", []byte("1234"), time.Hour)
+	if v, err := c.GetCached(ctx, "a"); err != nil || string(v) != "1234" {
+		t.Fatalf("got %q, %v", v, err)
+	}
+	// "b" is now the least recently used and makes room for "c".
+	c.SetCached(ctx, "c", []byte("1234"), time.Hour)
+	if _, err := c.GetCached(ctx, "b"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected b to be evicted, got %v", err)
+	}
+	if c.Len() != 2 || c.size != 8 {
+		t.Errorf("got %d entries of %d bytes, want 2 of 8", c.Len(), c.size)
+	}
+
+	// Replacing an entry updates the size.
+	c.SetCached(ctx, "a", []byte("12"), time.Hour)
+	if c.size != 6 {
+		t.Errorf("got %d bytes, want 6", c.size)
+	}
+
+	// Values larger than the cache are not stored.
+	c.SetCached(ctx, "big", make([]byte, 11), time.Hour)
+	if _, err := c.GetCached(ctx, "big"); !errors.Is(err, ErrNotFound) || c.Len() != 2 {
+		t.Errorf("expected big to be skipped, got %v with %d entries", err, c.Len())
+	}
+
+	now = now.Add(time.Hour)
+	if _, err := c.GetCached(ctx, "a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected a to expire, got %v", err)
+	}
+	if c.Len() != 1 || c.size != 4 {
+		t.Errorf("got %d entries of %d bytes, want 1 of 4", c.Len(), c.size)
+	}
+}
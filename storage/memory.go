@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+	"wave-generator/models"
+)
+
+// Memory is an in-process Store. Data is lost on restart and is not shared
+// between instances, which makes it suitable for development, tests and
+// single-instance deployments.
+type Memory struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	keys    map[string]models.APIKey
+	buckets map[string]bucket
+	calls   int
+	usage   map[string]models.Usage
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Time // when the bucket is full again and can be dropped
+}
+
+// sweepEvery is the number of Allow calls between removals of full
+// buckets, which keeps per-IP buckets from piling up.
+const sweepEvery = 1024
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		now:     time.Now,
+		keys:    make(map[string]models.APIKey),
+		buckets: make(map[string]bucket),
+		usage:   make(map[string]models.Usage),
+	}
+}
+
+func (m *Memory) SaveKey(_ context.Context, key models.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key.Scopes = append([]string(nil), key.Scopes...)
+	m.keys[key.ID] = key
+	return nil
+}
+
+func (m *Memory) GetKey(_ context.Context, id string) (models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return models.APIKey{}, ErrNotFound
+	}
+	return key, nil
+}
+
+func (m *Memory) ListKeys(_ context.Context) ([]models.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]models.APIKey, 0, len(m.keys))
+	for _, k := range m.keys {
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func (m *Memory) TouchKey(_ context.Context, id string, t time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.keys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsed = &t
+	m.keys[id] = key
+	return nil
+}
+
+func (m *Memory) Allow(_ context.Context, name string, limit Limit) (Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	m.calls++
+	if m.calls%sweepEvery == 0 {
+		for k, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+	}
+
+	tokens := float64(limit.Requests)
+	if b, ok := m.buckets[name]; ok {
+		tokens = limit.refill(b.tokens, b.at, now)
+	}
+	allowed := tokens >= 1
+	if allowed {
+		tokens--
+	}
+	d := limit.decide(allowed, tokens)
+	m.buckets[name] = bucket{tokens: tokens, at: now, full: now.Add(d.Reset)}
+	return d, nil
+}
+
+func (m *Memory) RecordUsage(_ context.Context, keyID string, at time.Time, u models.Usage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, period := range []string{at.UTC().Format(dayLayout), at.UTC().Format(monthLayout)} {
+		total := m.usage[keyID+":"+period]
+		total.Date = period
+		total.Add(u)
+		m.usage[keyID+":"+period] = total
+	}
+	return nil
+}
+
+func (m *Memory) Usage(_ context.Context, keyID string, from, to time.Time) ([]models.Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []models.Usage
+	for _, d := range days(from, to) {
+		if u, ok := m.usage[keyID+":"+d.Format(dayLayout)]; ok {
+			out = append(out, u)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) MonthUsage(_ context.Context, keyID string, t time.Time) (models.Usage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	month := t.UTC().Format(monthLayout)
+	u, ok := m.usage[keyID+":"+month]
+	if !ok {
+		u.Date = month
+	}
+	return u, nil
+}
+
+func (m *Memory) Ping(context.Context) error { return nil }
+
+func (m *Memory) Close() error { return nil }
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemory(t *testing.T) {
+	testStore(t, NewMemory())
+}
+
+func TestMemory_Refill(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	m.Allow(ctx, "b", limit)
+	m.Allow(ctx, "b", limit)
+	if d, _ := m.Allow(ctx, "b", limit); d.Allowed {
+		t.Fatal("expected the bucket to be empty")
+	}
+	now = now.Add(30 * time.Second)
+	if d, _ := m.Allow(ctx, "b", limit); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected one token after half the period, got %+v", d)
+	}
+}
+
+func TestMemory_Sweep(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+	limit := Limit{Requests: 10, Period: time.Minute}
+
+	m.Allow(ctx, "idle", limit)
+	now = now.Add(time.Minute)
+	for i := 1; i < sweepEvery; i++ {
+		m.Allow(ctx, "busy", limit)
+	}
+	if _, ok := m.buckets["idle"]; ok {
+		t.Error("expected full buckets to be swept")
+	}
+}
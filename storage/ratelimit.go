@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"math"
+	"time"
+)
+
+// Limit is a token bucket: it holds up to Requests tokens and is refilled
+// continuously at Requests per Period, so a client may burst up to Requests
+// and is then held to the average rate.
+type Limit struct {
+	Requests int64
+	Period   time.Duration
+}
+
+// perMilli returns the refill rate in tokens per millisecond.
+func (l Limit) perMilli() float64 {
+	return float64(l.Requests) / float64(l.Period.Milliseconds())
+}
+
+// Decision is the outcome of taking a token from a bucket.
+type Decision struct {
+	Allowed   bool
+	Limit     int64
+	Remaining int64
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token is available. It is zero
+	// when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// refill returns the tokens in a bucket that held tokens at last, at now.
+func (l Limit) refill(tokens float64, last, now time.Time) float64 {
+	elapsed := float64(now.Sub(last).Milliseconds())
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.Requests), tokens+elapsed*l.perMilli())
+}
+
+// decide builds the Decision for a bucket left with tokens.
+func (l Limit) decide(allowed bool, tokens float64) Decision {
+	rate := l.perMilli()
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     l.Requests,
+		Remaining: int64(math.Floor(tokens)),
+		Reset:     millis((float64(l.Requests) - tokens) / rate),
+	}
+	if !allowed {
+		d.RetryAfter = millis((1 - tokens) / rate)
+	}
+	return d
+}
+
+func millis(ms float64) time.Duration {
+	return time.Duration(math.Ceil(ms)) * time.Millisecond
+}
@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimitRefill(t *testing.T) {
+	l := Limit{Requests: 60, Period: time.Minute}
+	last := time.Now()
+
+	tests := []struct {
+		name    string
+		tokens  float64
+		elapsed time.Duration
+		want    float64
+	}{
+		{"no time passed", 10, 0, 10},
+		{"one token per second", 10, 5 * time.Second, 15},
+		{"capped at capacity", 59, time.Minute, 60},
+		{"clock going backwards", 10, -time.Second, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := l.refill(tt.tokens, last, last.Add(tt.elapsed)); got != tt.want {
+				t.Errorf("refill() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLimitDecide(t *testing.T) {
+	l := Limit{Requests: 60, Period: time.Minute}
+
+	d := l.decide(true, 57.5)
+	if !d.Allowed || d.Remaining != 57 || d.Reset != 2500*time.Millisecond || d.RetryAfter != 0 {
+		t.Errorf("unexpected allowed decision %+v", d)
+	}
+	d = l.decide(false, 0.25)
+	if d.Allowed || d.Remaining != 0 || d.RetryAfter != 750*time.Millisecond || d.Reset != 59750*time.Millisecond {
+		t.Errorf("unexpected denied decision %+v", d)
+	}
+}
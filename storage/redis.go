@@ -0,0 +1,295 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"wave-generator/metrics"
+	"wave-generator/models"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// apiKeyIndex is the Redis set holding the IDs of all stored keys.
+const apiKeyIndex = "apikeys"
+
+// Redis is a Store backed by a Redis server. API keys are hashes at
+// apikey:<id>; rate-limit buckets are hashes updated by a Lua script,
+// usage is kept in hashes at usage:<id>:<day or month> and cached results
+// in strings at cache:<key>.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis connects lazily to the Redis server at addr.
+func NewRedis(addr string) *Redis {
+	return NewRedisClient(redis.NewClient(&redis.Options{Addr: addr}))
+}
+
+// NewRedisClient wraps an existing client, adding a hook that counts its
+// errors in wave_redis_errors_total.
+func NewRedisClient(client *redis.Client) *Redis {
+	client.AddHook(errorHook{})
+	return &Redis{client: client}
+}
+
+func (s *Redis) SaveKey(ctx context.Context, k models.APIKey) error {
+	fields := map[string]any{
+		"hash":       k.Hash,
+		"owner":      k.Owner,
+		"scopes":     strings.Join(k.Scopes, ","),
+		"tier":       k.Tier,
+		"quota":      k.MonthlyQuota,
+		"created_at": k.CreatedAt.Format(time.RFC3339),
+		"last_used":  formatOptionalTime(k.LastUsed),
+		"expires_at": formatOptionalTime(k.ExpiresAt),
+		"revoked_at": formatOptionalTime(k.RevokedAt),
+	}
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.HSet(ctx, "apikey:"+k.ID, fields)
+		p.SAdd(ctx, apiKeyIndex, k.ID)
+		return nil
+	})
+	return err
+}
+
+func (s *Redis) GetKey(ctx context.Context, id string) (models.APIKey, error) {
+	h, err := s.client.HGetAll(ctx, "apikey:"+id).Result()
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if h["hash"] == "" {
+		return models.APIKey{}, ErrNotFound
+	}
+	k := models.APIKey{ID: id, Hash: h["hash"], Owner: h["owner"], Tier: h["tier"]}
+	if h["scopes"] != "" {
+		k.Scopes = strings.Split(h["scopes"], ",")
+	}
+	k.MonthlyQuota, _ = strconv.ParseInt(h["quota"], 10, 64)
+	k.CreatedAt, _ = time.Parse(time.RFC3339, h["created_at"])
+	k.LastUsed = parseOptionalTime(h["last_used"])
+	k.ExpiresAt = parseOptionalTime(h["expires_at"])
+	k.RevokedAt = parseOptionalTime(h["revoked_at"])
+	return k, nil
+}
+
+func (s *Redis) ListKeys(ctx context.Context) ([]models.APIKey, error) {
+	ids, err := s.client.SMembers(ctx, apiKeyIndex).Result()
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]models.APIKey, 0, len(ids))
+	for _, id := range ids {
+		k, err := s.GetKey(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	sortKeys(keys)
+	return keys, nil
+}
+
+func (s *Redis) TouchKey(ctx context.Context, id string, t time.Time) error {
+	return s.client.HSet(ctx, "apikey:"+id, "last_used", t.UTC().Format(time.RFC3339)).Err()
+}
+
+// tokenBucket refills and takes a token from the bucket hash at KEYS[1]
+// in one step. ARGV is the capacity and the refill period in
+// milliseconds. The time is read from the Redis server, so instances with
+// skewed clocks agree on the buckets they share. The hash expires once the
+// bucket would be full again, since a missing bucket is treated as full.
+var tokenBucket = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local period = tonumber(ARGV[2])
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'at')
+local tokens = tonumber(state[1])
+local at = tonumber(state[2])
+if tokens == nil or at == nil then
+	tokens = capacity
+else
+	local elapsed = math.max(0, now - at)
+	tokens = math.min(capacity, tokens + elapsed * capacity / period)
+end
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'at', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) * period / capacity))
+return {allowed, tostring(tokens)}
+`)
+
+func (s *Redis) Allow(ctx context.Context, name string, limit Limit) (Decision, error) {
+	res, err := tokenBucket.Run(ctx, s.client, []string{name},
+		limit.Requests, limit.Period.Milliseconds()).Slice()
+	if err != nil {
+		return Decision{}, err
+	}
+	if len(res) != 2 {
+		return Decision{}, fmt.Errorf("unexpected token bucket reply %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	str, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(str, 64)
+	if err != nil {
+		return Decision{}, fmt.Errorf("unexpected token bucket reply %v", res)
+	}
+	return limit.decide(allowed == 1, tokens), nil
+}
+
+// usageKey is the hash holding the usage of a key for a day or month.
+func usageKey(keyID, period string) string {
+	return "usage:" + keyID + ":" + period
+}
+
+func (s *Redis) RecordUsage(ctx context.Context, keyID string, at time.Time, u models.Usage) error {
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, period := range []string{at.UTC().Format(dayLayout), at.UTC().Format(monthLayout)} {
+			k := usageKey(keyID, period)
+			p.HIncrBy(ctx, k, "requests", u.Requests)
+			p.HIncrBy(ctx, k, "errors", u.Errors)
+			p.HIncrBy(ctx, k, "pixels", u.Pixels)
+			p.HIncrBy(ctx, k, "processing_ms", u.ProcessingMS)
+			p.Expire(ctx, k, usageRetention)
+		}
+		return nil
+	})
+	return err
+}
+
+func (s *Redis) Usage(ctx context.Context, keyID string, from, to time.Time) ([]models.Usage, error) {
+	ds := days(from, to)
+	cmds := make([]*redis.MapStringStringCmd, len(ds))
+	_, err := s.client.Pipelined(ctx, func(p redis.Pipeliner) error {
+		for i, d := range ds {
+			cmds[i] = p.HGetAll(ctx, usageKey(keyID, d.Format(dayLayout)))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []models.Usage
+	for i, cmd := range cmds {
+		if h := cmd.Val(); len(h) > 0 {
+			out = append(out, parseUsage(ds[i].Format(dayLayout), h))
+		}
+	}
+	return out, nil
+}
+
+func (s *Redis) MonthUsage(ctx context.Context, keyID string, t time.Time) (models.Usage, error) {
+	month := t.UTC().Format(monthLayout)
+	h, err := s.client.HGetAll(ctx, usageKey(keyID, month)).Result()
+	if err != nil {
+		return models.Usage{}, err
+	}
+	return parseUsage(month, h), nil
+}
+
+func parseUsage(period string, h map[string]string) models.Usage {
+	field := func(name string) int64 {
+		n, _ := strconv.ParseInt(h[name], 10, 64)
+		return n
+	}
+	return models.Usage{
+		Date:         period,
+		Requests:     field("requests"),
+		Errors:       field("errors"),
+		Pixels:       field("pixels"),
+		ProcessingMS: field("processing_ms"),
+	}
+}
+
+// GetCached and SetCached make Redis a Cache. Entries are strings at
+// cache:<key>; configure a maxmemory eviction policy to bound their size.
+func (s *Redis) GetCached(ctx context.Context, key string) ([]byte, error) {
+	v, err := s.client.Get(ctx, "cache:"+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrNotFound
+	}
+	return v, err
+}
+
+func (s *Redis) SetCached(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, "cache:"+key, value, ttl).Err()
+}
+
+func (s *Redis) Ping(ctx context.Context) error {
+	return s.client.Ping(ctx).Err()
+}
+
+func (s *Redis) Close() error {
+	return s.client.Close()
+}
+
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func parseOptionalTime(s string) *time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+var redisErrors = metrics.Default.Counter("wave_redis_errors_total",
+	"Failed Redis commands and connection attempts (dial) by command.", "command")
+
+// errorHook counts Redis errors. redis.Nil, the reply for missing keys, is
+// not an error.
+type errorHook struct{}
+
+func (errorHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			redisErrors.Inc("dial")
+		}
+		return conn, err
+	}
+}
+
+func (errorHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		countRedisError(cmd, err)
+		return err
+	}
+}
+
+func (errorHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		err := next(ctx, cmds)
+		for _, cmd := range cmds {
+			countRedisError(cmd, nil)
+		}
+		return err
+	}
+}
+
+// countRedisError counts err, or else the error set on cmd.
+func countRedisError(cmd redis.Cmder, err error) {
+	if err == nil {
+		err = cmd.Err()
+	}
+	if err != nil && !errors.Is(err, redis.Nil) {
+		redisErrors.Inc(cmd.Name())
+	}
+}
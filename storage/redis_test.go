@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedis(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRedis(mr.Addr())
+	defer s.Close()
+
+	testStore(t, s)
+
+	if !mr.Exists("apikey:a") || !strings.Contains(mr.Dump(), "hash-a") {
+		t.Error("expected keys to be stored as apikey:<id> hashes")
+	}
+}
+
+func TestRedis_Refill(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRedis(mr.Addr())
+	defer s.Close()
+	// the bucket uses the clock of the Redis server
+	now := time.Now()
+	mr.SetTime(now)
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Period: time.Minute}
+
+	s.Allow(ctx, "b", limit)
+	if ttl := mr.TTL("b"); ttl <= 0 || ttl > 31*time.Second {
+		t.Errorf("expected the bucket to expire once full again, got TTL %v", ttl)
+	}
+	s.Allow(ctx, "b", limit)
+	if d, _ := s.Allow(ctx, "b", limit); d.Allowed {
+		t.Fatal("expected the bucket to be empty")
+	}
+	mr.SetTime(now.Add(30 * time.Second))
+	if d, _ := s.Allow(ctx, "b", limit); !d.Allowed || d.Remaining != 0 {
+		t.Errorf("expected one token after half the period, got %+v", d)
+	}
+}
+
+func TestRedis_Unavailable(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRedis(mr.Addr())
+	defer s.Close()
+	mr.Close()
+
+	ctx := context.Background()
+	pingErrors := redisErrors.Value("ping")
+	if err := s.Ping(ctx); err == nil {
+		t.Error("expected Ping to fail")
+	}
+	if redisErrors.Value("ping") != pingErrors+1 {
+		t.Error("expected the failed command to be counted")
+	}
+	if _, err := s.Allow(ctx, "b", Limit{Requests: 1, Period: time.Minute}); err == nil {
+		t.Error("expected Allow to fail")
+	}
+}
+
+func TestRedis_Cache(t *testing.T) {
+	mr := miniredis.RunT(t)
+	s := NewRedis(mr.Addr())
+	defer s.Close()
+	ctx := context.Background()
+
+	getErrors := redisErrors.Value("get")
+	if _, err := s.GetCached(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("got %v, want ErrNotFound", err)
+	}
+	if redisErrors.Value("get") != getErrors {
+		t.Error("expected a cache miss not to count as an error")
+	}
+	if err := s.SetCached(ctx, "k", []byte("result"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.GetCached(ctx, "k"); err != nil || string(v) != "result" {
+		t.Errorf("got %q, %v", v, err)
+	}
+	if ttl := mr.TTL("cache:k"); ttl != time.Minute {
+		t.Errorf("got TTL %v, want 1m", ttl)
+	}
+	mr.FastForward(time.Minute)
+	if _, err := s.GetCached(ctx, "k"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected the entry to expire, got %v", err)
+	}
+}
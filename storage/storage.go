@@ -0,0 +1,70 @@
+// Package storage persists API keys, rate-limit buckets and usage.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"wave-generator/models"
+)
+
+// Backends accepted by New.
+const (
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
+// Store is the persistence layer used by the HTTP handlers.
+type Store interface {
+	// SaveKey creates or replaces the metadata of an API key.
+	SaveKey(ctx context.Context, key models.APIKey) error
+	// GetKey returns the metadata of an API key or ErrNotFound.
+	GetKey(ctx context.Context, id string) (models.APIKey, error)
+	// ListKeys returns the metadata of every stored key.
+	ListKeys(ctx context.Context) ([]models.APIKey, error)
+	// TouchKey records that the key was used at t.
+	TouchKey(ctx context.Context, id string, t time.Time) error
+	// Allow takes a token from the bucket stored at name, creating a full
+	// bucket if there is none. The update is atomic, so instances sharing
+	// the store share the bucket.
+	Allow(ctx context.Context, name string, limit Limit) (Decision, error)
+	// RecordUsage adds u to the usage of the key on the UTC day and month
+	// of at.
+	RecordUsage(ctx context.Context, keyID string, at time.Time, u models.Usage) error
+	// Usage returns the daily usage of the key from from to to (UTC days,
+	// both included), skipping days without activity.
+	Usage(ctx context.Context, keyID string, from, to time.Time) ([]models.Usage, error)
+	// MonthUsage returns the usage of the key in the calendar month of t.
+	MonthUsage(ctx context.Context, keyID string, t time.Time) (models.Usage, error)
+	// Ping checks that the backend is reachable.
+	Ping(ctx context.Context) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// sortKeys orders keys by creation time, then ID.
+func sortKeys(keys []models.APIKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].CreatedAt.Equal(keys[j].CreatedAt) {
+			return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+		}
+		return keys[i].ID < keys[j].ID
+	})
+}
+
+// New returns the store for the given backend. addr is the Redis address
+// and is ignored by the memory backend.
+func New(backend, addr string) (Store, error) {
+	switch backend {
+	case BackendMemory:
+		return NewMemory(), nil
+	case BackendRedis:
+		return NewRedis(addr), nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q: must be %s or %s", backend, BackendMemory, BackendRedis)
+}
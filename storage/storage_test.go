@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"wave-generator/models"
+)
+
+func TestNew(t *testing.T) {
+	if s, err := New(BackendMemory, ""); err != nil {
+		t.Errorf("memory backend: %v", err)
+	} else if _, ok := s.(*Memory); !ok {
+		t.Errorf("memory backend returned %T", s)
+	}
+	if s, err := New(BackendRedis, "localhost:0"); err != nil {
+		t.Errorf("redis backend: %v", err)
+	} else {
+		_ = s.Close()
+	}
+	if _, err := New("bolt", ""); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+}
+
+// testStore checks the behavior every Store implementation must share.
+func testStore(t *testing.T, s Store) {
+	ctx := context.Background()
+	created := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	expires := created.Add(24 * time.Hour)
+
+	t.Run("keys", func(t *testing.T) {
+		if _, err := s.GetKey(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetKey on a missing key: got %v, want ErrNotFound", err)
+		}
+
+		second := models.APIKey{ID: "b", Hash: "hash-b", CreatedAt: created.Add(time.Hour)}
+		first := models.APIKey{
+			ID:           "a",
+			Hash:         "hash-a",
+			Owner:        "team",
+			Tier:         "pro",
+			MonthlyQuota: 5000,
+			Scopes:       []string{"wave:generate", "other"},
+			CreatedAt:    created,
+			ExpiresAt:    &expires,
+		}
+		for _, k := range []models.APIKey{second, first} {
+			if err := s.SaveKey(ctx, k); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := s.GetKey(ctx, "a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Hash != "hash-a" || got.Owner != "team" || got.Tier != "pro" || got.MonthlyQuota != 5000 || len(got.Scopes) != 2 ||
+			!got.CreatedAt.Equal(created) || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expires) ||
+			got.LastUsed != nil || got.RevokedAt != nil {
+			t.Errorf("unexpected key: %+v", got)
+		}
+
+		used := created.Add(2 * time.Hour)
+		if err := s.TouchKey(ctx, "a", used); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := s.GetKey(ctx, "a"); got.LastUsed == nil || !got.LastUsed.Equal(used) {
+			t.Errorf("expected last used %v, got %v", used, got.LastUsed)
+		}
+
+		keys, err := s.ListKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 2 || keys[0].ID != "a" || keys[1].ID != "b" {
+			t.Errorf("expected keys ordered by creation, got %+v", keys)
+		}
+	})
+
+	t.Run("buckets", func(t *testing.T) {
+		limit := Limit{Requests: 3, Period: time.Hour}
+		for want := int64(2); want >= 0; want-- {
+			d, err := s.Allow(ctx, "bucket", limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !d.Allowed || d.Remaining != want || d.Limit != 3 {
+				t.Errorf("got %+v, want allowed with %d remaining", d, want)
+			}
+			if d.Reset <= 0 || d.Reset > time.Hour {
+				t.Errorf("expected the bucket to refill within an hour, got %v", d.Reset)
+			}
+		}
+		d, err := s.Allow(ctx, "bucket", limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d.Allowed || d.Remaining != 0 {
+			t.Errorf("expected an empty bucket to deny, got %+v", d)
+		}
+		if d.RetryAfter <= 19*time.Minute || d.RetryAfter > 20*time.Minute {
+			t.Errorf("expected a token within 20 minutes, got %v", d.RetryAfter)
+		}
+		if d, _ := s.Allow(ctx, "other", limit); !d.Allowed || d.Remaining != 2 {
+			t.Errorf("buckets must be independent, got %+v", d)
+		}
+	})
+
+	t.Run("usage", func(t *testing.T) {
+		may1 := time.Date(2025, 5, 1, 23, 30, 0, 0, time.UTC)
+		may3 := time.Date(2025, 5, 3, 8, 0, 0, 0, time.UTC)
+		june := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+		records := []struct {
+			at time.Time
+			u  models.Usage
+		}{
+			{may1, models.Usage{Requests: 1, Pixels: 100, ProcessingMS: 5}},
+			{may1.Add(10 * time.Minute), models.Usage{Requests: 1, Errors: 1, ProcessingMS: 1}},
+			{may3, models.Usage{Requests: 1, Pixels: 50, ProcessingMS: 2}},
+			{june, models.Usage{Requests: 1, Pixels: 10}},
+		}
+		for _, r := range records {
+			if err := s.RecordUsage(ctx, "a", r.at, r.u); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		daily, err := s.Usage(ctx, "a", time.Date(2025, 4, 30, 0, 0, 0, 0, time.UTC), may3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []models.Usage{
+			{Date: "2025-05-01", Requests: 2, Errors: 1, Pixels: 100, ProcessingMS: 6},
+			{Date: "2025-05-03", Requests: 1, Pixels: 50, ProcessingMS: 2},
+		}
+		if len(daily) != len(want) {
+			t.Fatalf("got %+v, want %+v", daily, want)
+		}
+		for i := range want {
+			if daily[i] != want[i] {
+				t.Errorf("day %d: got %+v, want %+v", i, daily[i], want[i])
+			}
+		}
+
+		month, err := s.MonthUsage(ctx, "a", may3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if month != (models.Usage{Date: "2025-05", Requests: 3, Errors: 1, Pixels: 150, ProcessingMS: 8}) {
+			t.Errorf("unexpected month usage %+v", month)
+		}
+		if empty, _ := s.MonthUsage(ctx, "b", may3); empty != (models.Usage{Date: "2025-05"}) {
+			t.Errorf("expected no usage for another key, got %+v", empty)
+		}
+	})
+
+	if err := s.Ping(ctx); err != nil {
+		t.Errorf("Ping: %v", err)
+	}
+}
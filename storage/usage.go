@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"time"
+)
+
+// Usage is kept per day and per calendar month, both in UTC, so reports
+// can pick any range of days and quotas can be checked with one read.
+const (
+	dayLayout   = "2006-01-02"
+	monthLayout = "2006-01"
+	// usageRetention is how long daily and monthly usage is kept.
+	usageRetention = 400 * 24 * time.Hour
+	// MaxUsageDays bounds the range of a usage query.
+	MaxUsageDays = 366
+)
+
+// Day truncates t to the start of its UTC day.
+func Day(t time.Time) time.Time {
+	y, m, d := t.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+// MonthStart returns the start of the UTC calendar month containing t.
+func MonthStart(t time.Time) time.Time {
+	y, m, _ := t.UTC().Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// days returns the UTC days from from to to, both included.
+func days(from, to time.Time) []time.Time {
+	var out []time.Time
+	for d := Day(from); !d.After(Day(to)) && len(out) < MaxUsageDays; d = d.AddDate(0, 0, 1) {
+		out = append(out, d)
+	}
+	return out
+}
@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDays(t *testing.T) {
+	from := time.Date(2025, 2, 27, 15, 0, 0, 0, time.UTC)
+	to := time.Date(2025, 3, 2, 1, 0, 0, 0, time.UTC)
+	got := days(from, to)
+	want := []string{"2025-02-27", "2025-02-28", "2025-03-01", "2025-03-02"}
+	if len(got) != len(want) {
+		t.Fatalf("got %d days, want %d", len(got), len(want))
+	}
+	for i, d := range got {
+		if d.Format(dayLayout) != want[i] {
+			t.Errorf("day %d: got %s, want %s", i, d.Format(dayLayout), want[i])
+		}
+	}
+
+	if n := len(days(to, from)); n != 0 {
+		t.Errorf("expected no days for an inverted range, got %d", n)
+	}
+	if n := len(days(from, from.AddDate(5, 0, 0))); n != MaxUsageDays {
+		t.Errorf("expected the range to be capped at %d days, got %d", MaxUsageDays, n)
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	est := time.FixedZone("EST", -5*3600)
+	// 2025-05-31 22:00 EST is already June in UTC
+	got := MonthStart(time.Date(2025, 5, 31, 22, 0, 0, 0, est))
+	if want := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}